@@ -1,42 +1,372 @@
 package ecql
 
-import "github.com/gocql/gocql"
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+)
 
 type Batch interface {
 	Add(s ...Statement) Batch
 	Apply() error
+	ApplyContext(ctx context.Context) error
 	ApplyCAS() (bool, error)
+	ApplyCASContext(ctx context.Context) (bool, error)
+	MapApplyCAS() (bool, []map[string]interface{}, error)
+	MapApplyCASContext(ctx context.Context) (bool, []map[string]interface{}, error)
+	TypeApplyCAS(dest interface{}) (bool, error)
+	TypeApplyCASContext(ctx context.Context, dest interface{}) (bool, error)
+	Consistency(c gocql.Consistency) Batch
+	SerialConsistency(c gocql.SerialConsistency) Batch
+	Idempotent(value bool) Batch
+	RetryPolicy(policy gocql.RetryPolicy) Batch
+	Timeout(d time.Duration) Batch
+	Timestamp(microseconds int64) Batch
+	Size() int
+	BuildQuery() (string, []interface{})
+	Err() error
 }
 
 type BatchImpl struct {
-	session *SessionImpl
-	batch   *gocql.Batch
+	session           Session
+	typ               gocql.BatchType
+	entries           []gocql.BatchEntry
+	consistency       *gocql.Consistency
+	serialConsistency *gocql.SerialConsistency
+	idempotent        bool
+	retryPolicy       gocql.RetryPolicy
+	timeout           time.Duration
+	timestamp         int64
+	err               error
 }
 
-func NewBatch(sess *SessionImpl, typ gocql.BatchType) Batch {
+// NewBatch creates a batch of the given type. The batch can always be built,
+// but it can only be applied if the session is a *SessionImpl, or a type
+// embedding it; otherwise Apply returns ErrInvalidSession.
+func NewBatch(sess Session, typ gocql.BatchType) Batch {
 	return &BatchImpl{
 		session: sess,
-		batch:   sess.NewBatch(typ),
+		typ:     typ,
 	}
 }
 
+// Add adds the statements to the batch. If a statement is not valid, the
+// batch will return its error when applied.
 func (b *BatchImpl) Add(s ...Statement) Batch {
 	for i := range s {
-		stmt, args := s[i].BuildQuery()
-		b.batch.Query(stmt, args...)
+		stmt, args, err := s[i].BuildQueryE()
+		if err != nil {
+			if b.err == nil {
+				b.err = err
+			}
+			continue
+		}
+		entry := gocql.BatchEntry{Stmt: stmt, Args: args}
+		if impl, ok := s[i].(*StatementImpl); ok {
+			entry.Idempotent = impl.IdempotentValue
+		}
+		b.entries = append(b.entries, entry)
 	}
 	return b
 }
 
+// Consistency sets the consistency level of the batch.
+func (b *BatchImpl) Consistency(c gocql.Consistency) Batch {
+	b.consistency = &c
+	return b
+}
+
+// SerialConsistency sets the consistency level for the serial phase of
+// conditional batches.
+func (b *BatchImpl) SerialConsistency(c gocql.SerialConsistency) Batch {
+	b.serialConsistency = &c
+	return b
+}
+
+// Idempotent marks all the statements in the batch as idempotent, so it can
+// be retried by gocql.
+func (b *BatchImpl) Idempotent(value bool) Batch {
+	b.idempotent = value
+	return b
+}
+
+// RetryPolicy sets the gocql retry policy used by the batch.
+func (b *BatchImpl) RetryPolicy(policy gocql.RetryPolicy) Batch {
+	b.retryPolicy = policy
+	return b
+}
+
+// Timeout sets the maximum duration of the batch, after it the context of
+// the batch will be canceled.
+func (b *BatchImpl) Timeout(d time.Duration) Batch {
+	b.timeout = d
+	return b
+}
+
+// Timestamp sets the timestamp in microseconds of all the statements in the
+// batch, as USING TIMESTAMP does.
+func (b *BatchImpl) Timestamp(microseconds int64) Batch {
+	b.timestamp = microseconds
+	return b
+}
+
+// Size returns the number of statements in the batch.
+func (b *BatchImpl) Size() int {
+	return len(b.entries)
+}
+
+// BuildQuery returns the CQL of the batch and the values of all its
+// statements, it is meant to inspect the batch, as the statements are sent
+// individually by gocql:
+// 	BEGIN [UNLOGGED|COUNTER] BATCH [USING TIMESTAMP n] stmt1; stmt2; APPLY BATCH
+func (b *BatchImpl) BuildQuery() (string, []interface{}) {
+	cql := []string{"BEGIN"}
+	switch b.typ {
+	case gocql.UnloggedBatch:
+		cql = append(cql, "UNLOGGED")
+	case gocql.CounterBatch:
+		cql = append(cql, "COUNTER")
+	}
+	cql = append(cql, "BATCH")
+	if b.timestamp > 0 {
+		cql = append(cql, fmt.Sprintf("USING TIMESTAMP %d", b.timestamp))
+	}
+
+	var args []interface{}
+	for _, entry := range b.entries {
+		cql = append(cql, entry.Stmt+";")
+		args = append(args, entry.Args...)
+	}
+	cql = append(cql, "APPLY BATCH")
+
+	return strings.Join(cql, " "), args
+}
+
+// Err returns the error of the first statement added to the batch that was
+// not valid.
+func (b *BatchImpl) Err() error {
+	return b.err
+}
+
 func (b *BatchImpl) Apply() error {
-	return b.session.ExecuteBatch(b.batch)
+	return b.ApplyContext(context.Background())
+}
+
+// ApplyContext is like Apply but the batch will be executed with the given
+// context.
+func (b *BatchImpl) ApplyContext(ctx context.Context) error {
+	if b.err != nil {
+		return b.err
+	}
+
+	ctx, cancel := b.withTimeout(ctx)
+	defer cancel()
+
+	query, err := b.query(ctx)
+	if err != nil {
+		return err
+	}
+	return query.Exec()
 }
 
 func (b *BatchImpl) ApplyCAS() (bool, error) {
-	mapping := make(map[string]interface{})
-	applied, iter, err := b.session.MapExecuteBatchCAS(b.batch, mapping)
-	if iter != nil {
-		iter.Close()
+	return b.ApplyCASContext(context.Background())
+}
+
+// ApplyCASContext is like ApplyCAS but the batch will be executed with the
+// given context.
+func (b *BatchImpl) ApplyCASContext(ctx context.Context) (bool, error) {
+	next := func() map[string]interface{} {
+		return make(map[string]interface{})
+	}
+	done := func(map[string]interface{}) {}
+	return b.applyCAS(ctx, next, done)
+}
+
+// MapApplyCAS executes a conditional batch like ApplyCAS, and if it is not
+// applied it returns the current values of the rows that were read to check
+// the conditions. Each map contains the primary key and the columns used in
+// the conditions of one row:
+// 	applied, rows, err := sess.Batch().Add(stmt1, stmt2).MapApplyCAS()
+// 	if err == nil && !applied {
+// 		for _, row := range rows {
+// 			...
+// 		}
+// 	}
+func (b *BatchImpl) MapApplyCAS() (bool, []map[string]interface{}, error) {
+	return b.MapApplyCASContext(context.Background())
+}
+
+// MapApplyCASContext is like MapApplyCAS but the batch will be executed with
+// the given context.
+func (b *BatchImpl) MapApplyCASContext(ctx context.Context) (bool, []map[string]interface{}, error) {
+	var rows []map[string]interface{}
+	next := func() map[string]interface{} {
+		return make(map[string]interface{})
+	}
+	done := func(m map[string]interface{}) {
+		if len(m) > 0 {
+			rows = append(rows, m)
+		}
+	}
+	applied, err := b.applyCAS(ctx, next, done)
+	return applied, rows, err
+}
+
+// TypeApplyCAS is like MapApplyCAS but the current values are scanned into a
+// slice of registered structs. The destination must be a pointer to a slice
+// of structs, or pointers to structs, of the type of the table used in the
+// conditions:
+// 	var current []Tweet
+// 	applied, err := sess.Batch().Add(stmt1, stmt2).TypeApplyCAS(&current)
+//
+// Only the primary key and the columns used in the conditions are set. It
+// returns a *StatementError wrapping ErrInvalidDestination if dest is not a
+// pointer to a slice.
+func (b *BatchImpl) TypeApplyCAS(dest interface{}) (bool, error) {
+	return b.TypeApplyCASContext(context.Background(), dest)
+}
+
+// TypeApplyCASContext is like TypeApplyCAS but the batch will be executed
+// with the given context.
+func (b *BatchImpl) TypeApplyCASContext(ctx context.Context, dest interface{}) (bool, error) {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Slice {
+		return false, &StatementError{Command: BatchCmd, Detail: fmt.Sprintf("%T", dest), Err: ErrInvalidDestination}
+	}
+
+	slice := v.Elem()
+	elemType := slice.Type().Elem()
+	isPtr := elemType.Kind() == reflect.Ptr
+	if isPtr {
+		elemType = elemType.Elem()
+	}
+
+	var elem reflect.Value
+	var fields map[string]interface{}
+	rows := reflect.MakeSlice(slice.Type(), 0, 0)
+	next := func() map[string]interface{} {
+		elem = reflect.New(elemType)
+		fields = Map(elem.Interface())
+		m := make(map[string]interface{}, len(fields))
+		for k, v := range fields {
+			m[k] = v
+		}
+		return m
+	}
+	done := func(m map[string]interface{}) {
+		if !scanned(m, fields) {
+			return
+		}
+		if isPtr {
+			rows = reflect.Append(rows, elem)
+		} else {
+			rows = reflect.Append(rows, elem.Elem())
+		}
+	}
+
+	applied, err := b.applyCAS(ctx, next, done)
+	if err != nil {
+		return false, err
+	}
+	slice.Set(rows)
+	return applied, nil
+}
+
+// applyCAS executes a conditional batch, each row returned is scanned into a
+// mapping created by next, and done is called with it after the scan.
+func (b *BatchImpl) applyCAS(ctx context.Context, next func() map[string]interface{}, done func(map[string]interface{})) (bool, error) {
+	if b.err != nil {
+		return false, b.err
+	}
+
+	ctx, cancel := b.withTimeout(ctx)
+	defer cancel()
+
+	query, err := b.query(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	m := next()
+	applied, iter, err := query.MapExecCAS(m)
+	if err != nil {
+		if iter != nil {
+			iter.Close()
+		}
+		return false, err
+	}
+	done(m)
+	if iter == nil {
+		return applied, nil
+	}
+
+	for m = next(); iter.MapScan(m); m = next() {
+		delete(m, "[applied]")
+		done(m)
+	}
+	if err := iter.Close(); err != nil {
+		return false, err
+	}
+	return applied, nil
+}
+
+// scanned returns true if any of the pointers to the fields of a struct in
+// the mapping m has been replaced by a scanned value.
+func scanned(m, fields map[string]interface{}) bool {
+	for col, ptr := range fields {
+		if reflect.TypeOf(m[col]) != reflect.TypeOf(ptr) {
+			return true
+		}
+	}
+	return false
+}
+
+// withTimeout returns a context with the timeout of the batch, if any.
+func (b *BatchImpl) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if b.timeout > 0 {
+		return context.WithTimeout(ctx, b.timeout)
+	}
+	return ctx, func() {}
+}
+
+// executor returns the Executor of the session used by the batch.
+func (b *BatchImpl) executor() (Executor, error) {
+	return SessionExecutor(b.session)
+}
+
+// query creates the batch query with the options of the batch.
+func (b *BatchImpl) query(ctx context.Context) (BatchQuery, error) {
+	exec, err := b.executor()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := b.entries
+	if b.idempotent {
+		entries = make([]gocql.BatchEntry, len(b.entries))
+		for i := range b.entries {
+			entries[i] = b.entries[i]
+			entries[i].Idempotent = true
+		}
+	}
+
+	query := exec.Batch(ctx, b.typ, entries)
+	if b.consistency != nil {
+		query = query.Consistency(*b.consistency)
+	}
+	if b.serialConsistency != nil {
+		query = query.SerialConsistency(*b.serialConsistency)
+	}
+	if b.retryPolicy != nil {
+		query = query.RetryPolicy(b.retryPolicy)
+	}
+	if b.timestamp > 0 {
+		query = query.WithTimestamp(b.timestamp)
 	}
-	return applied, err
+	return query, nil
 }
@@ -0,0 +1,127 @@
+package ecql
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchBuildQuery(t *testing.T) {
+	DeleteRegistry()
+
+	sess := &SessionImpl{}
+	v := testConsistencyStruct{ID: "foo", Text: "bar"}
+	var tests = []struct {
+		batch Batch
+		cql   string
+		args  []interface{}
+	}{
+		{
+			sess.Batch(),
+			"BEGIN BATCH APPLY BATCH",
+			nil,
+		},
+		{
+			sess.Batch().Add(sess.Insert(v), sess.Delete(v)),
+			"BEGIN BATCH INSERT INTO consistent (id,text) VALUES (?,?); DELETE FROM consistent WHERE id = ?; APPLY BATCH",
+			[]interface{}{"foo", "bar", "foo"},
+		},
+		{
+			sess.UnloggedBatch().Add(sess.Update(v).Columns("text")).Timestamp(1462800000000000),
+			"BEGIN UNLOGGED BATCH USING TIMESTAMP 1462800000000000 UPDATE consistent SET text = ? WHERE id = ?; APPLY BATCH",
+			[]interface{}{"bar", "foo"},
+		},
+		{
+			sess.CounterBatch().Add(NewStatement(sess).Do(UpdateCmd).From("counters").Set("n", Inc(1)).Where(Eq("id", "foo"))),
+			"BEGIN COUNTER BATCH UPDATE counters SET n = n + ? WHERE id = ?; APPLY BATCH",
+			[]interface{}{int64(1), "foo"},
+		},
+	}
+
+	for _, tc := range tests {
+		cql, args := tc.batch.BuildQuery()
+		assert.Equal(t, tc.cql, cql)
+		assert.Equal(t, tc.args, args)
+	}
+}
+
+func TestBatchSize(t *testing.T) {
+	DeleteRegistry()
+
+	sess := &SessionImpl{}
+	v := testConsistencyStruct{ID: "foo", Text: "bar"}
+
+	b := sess.Batch()
+	assert.Equal(t, 0, b.Size())
+	b.Add(sess.Insert(v))
+	assert.Equal(t, 1, b.Size())
+	b.Add(sess.Update(v).Columns("text"), sess.Delete(v))
+	assert.Equal(t, 3, b.Size())
+	assert.NoError(t, b.Err())
+
+	// Invalid statements are not added
+	b.Add(sess.Update(v))
+	assert.Equal(t, 3, b.Size())
+	assert.True(t, errors.Is(b.Err(), ErrMissingAssignments))
+}
+
+// wrappedSession is a session that embeds a *SessionImpl.
+type wrappedSession struct {
+	*SessionImpl
+}
+
+// customSession is a session that does not embed a *SessionImpl.
+type customSession struct {
+	Session
+}
+
+func TestNewBatch(t *testing.T) {
+	DeleteRegistry()
+
+	e := &optionsExecutor{}
+	v := testConsistencyStruct{ID: "foo", Text: "bar"}
+	impl := NewWithExecutor(e).(*SessionImpl)
+
+	// Sessions embedding a *SessionImpl can apply batches
+	sess := wrappedSession{impl}
+	assert.NoError(t, NewBatch(sess, gocql.UnloggedBatch).Add(sess.Insert(v)).Apply())
+	assert.Len(t, e.entries, 1)
+
+	// Other sessions can only build them
+	for _, sess := range []Session{customSession{impl}, (*SessionImpl)(nil), nil} {
+		b := NewBatch(sess, gocql.LoggedBatch).Add(impl.Insert(v))
+		cql, _ := b.BuildQuery()
+		assert.Equal(t, "BEGIN BATCH INSERT INTO consistent (id,text) VALUES (?,?); APPLY BATCH", cql)
+		assert.Equal(t, ErrInvalidSession, b.Apply())
+		_, err := b.ApplyCAS()
+		assert.Equal(t, ErrInvalidSession, err)
+		_, _, err = b.MapApplyCAS()
+		assert.Equal(t, ErrInvalidSession, err)
+		var rows []testConsistencyStruct
+		_, err = b.TypeApplyCAS(&rows)
+		assert.Equal(t, ErrInvalidSession, err)
+	}
+}
+
+func TestScanned(t *testing.T) {
+	DeleteRegistry()
+
+	var v testConsistencyStruct
+	fields := Map(&v)
+	m := map[string]interface{}{"id": fields["id"], "text": fields["text"], "[applied]": false}
+	assert.False(t, scanned(m, fields))
+	m["id"] = "foo"
+	assert.True(t, scanned(m, fields))
+
+	var rows []testConsistencyStruct
+	b := NewBatch(&SessionImpl{}, gocql.LoggedBatch)
+	_, err := b.TypeApplyCAS(rows)
+	assert.Equal(t, &StatementError{Command: BatchCmd, Detail: "[]ecql.testConsistencyStruct", Err: ErrInvalidDestination}, err)
+	assert.Equal(t, "invalid BATCH statement: destination is not a pointer to a slice []ecql.testConsistencyStruct", err.Error())
+	_, err = b.TypeApplyCAS(&v)
+	var serr *StatementError
+	assert.True(t, errors.As(err, &serr))
+	assert.True(t, errors.Is(err, ErrInvalidDestination))
+}
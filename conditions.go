@@ -2,6 +2,7 @@ package ecql
 
 import (
 	"fmt"
+	"strings"
 )
 
 type OrderType string
@@ -26,24 +27,43 @@ func Desc(col string) OrderBy {
 
 type PredicateType int
 
+// Condition is a relation used in WHERE and IF clauses. Conditions that are
+// not valid, like tuple relations with a wrong number of values, carry an
+// error that is returned by Statement.Err when they are used.
 type Condition struct {
 	CQLFragment string
 	Values      []interface{}
+	err         error
+	detail      string
+	equals      []equality
+}
+
+// equality is a column = value relation created with Eq, it is used to find
+// the partition key of a statement without parsing the CQL fragment.
+type equality struct {
+	column string
+	value  interface{}
 }
 
 func And(lhs Condition, list ...Condition) Condition {
 	cqlfragment := lhs.CQLFragment
 	values := lhs.Values
+	err, detail := lhs.err, lhs.detail
+	equals := lhs.equals
 	for _, rhs := range list {
 		cqlfragment += " AND " + rhs.CQLFragment
 		values = append(values, rhs.Values...)
+		equals = append(equals, rhs.equals...)
+		if err == nil {
+			err, detail = rhs.err, rhs.detail
+		}
 	}
-	return Condition{CQLFragment: cqlfragment, Values: values}
+	return Condition{CQLFragment: cqlfragment, Values: values, err: err, detail: detail, equals: equals}
 }
 
 func Eq(col string, v interface{}) Condition {
 	return Condition{CQLFragment: fmt.Sprintf("%s = ?", col),
-		Values: []interface{}{v}}
+		Values: []interface{}{v}, equals: []equality{{col, v}}}
 }
 
 func Gt(col string, v interface{}) Condition {
@@ -71,6 +91,88 @@ func In(col string, v ...interface{}) Condition {
 		Values: v}
 }
 
+// TupleEq creates the multi-column relation '(col1, col2, ...) = (?, ?, ...)'.
+// If the number of values does not match the number of columns, the
+// statement using the condition returns an error wrapping ErrInvalidTuple.
+func TupleEq(cols []string, v ...interface{}) Condition {
+	return tupleRelation(cols, "=", v)
+}
+
+// TupleGt creates the multi-column relation '(col1, col2, ...) > (?, ?, ...)'
+// on clustering columns. It allows to seek through the rows of a partition
+// sorted by a compound clustering key:
+// 	Where(And(Eq("timeline", "ecql"), TupleGt([]string{"time", "id"}, last.Time, last.ID)))
+func TupleGt(cols []string, v ...interface{}) Condition {
+	return tupleRelation(cols, ">", v)
+}
+
+// TupleGe creates the multi-column relation '(col1, col2, ...) >= (?, ?, ...)'.
+func TupleGe(cols []string, v ...interface{}) Condition {
+	return tupleRelation(cols, ">=", v)
+}
+
+// TupleLt creates the multi-column relation '(col1, col2, ...) < (?, ?, ...)'.
+func TupleLt(cols []string, v ...interface{}) Condition {
+	return tupleRelation(cols, "<", v)
+}
+
+// TupleLe creates the multi-column relation '(col1, col2, ...) <= (?, ?, ...)'.
+func TupleLe(cols []string, v ...interface{}) Condition {
+	return tupleRelation(cols, "<=", v)
+}
+
+// TupleIn creates the multi-column relation
+// '(col1, col2, ...) IN ((?, ?, ...), (?, ?, ...))' with one tuple of values
+// per element. If there are no tuples or the number of values of any tuple
+// does not match the number of columns, the statement using the condition
+// returns an error wrapping ErrInvalidTuple.
+// 	TupleIn([]string{"a", "b"}, []interface{}{1, "x"}, []interface{}{2, "y"})
+func TupleIn(cols []string, tuples ...[]interface{}) Condition {
+	var values []interface{}
+	fragments := make([]string, len(tuples))
+	cond := Condition{}
+	if len(tuples) == 0 {
+		cond.err, cond.detail = ErrInvalidTuple, fmt.Sprintf("(%s) IN without values", strings.Join(cols, ", "))
+	}
+	for i, tuple := range tuples {
+		if cond.err == nil {
+			cond.detail, cond.err = checkTuple(cols, tuple)
+		}
+		fragments[i] = "(" + tupleQms(len(tuple)) + ")"
+		values = append(values, tuple...)
+	}
+	cond.CQLFragment = fmt.Sprintf("(%s) IN (%s)", strings.Join(cols, ", "), strings.Join(fragments, ", "))
+	cond.Values = values
+	return cond
+}
+
+func tupleRelation(cols []string, op string, v []interface{}) Condition {
+	detail, err := checkTuple(cols, v)
+	return Condition{
+		CQLFragment: fmt.Sprintf("(%s) %s (%s)", strings.Join(cols, ", "), op, tupleQms(len(v))),
+		Values:      v,
+		err:         err,
+		detail:      detail,
+	}
+}
+
+// checkTuple returns the detail of the error and ErrInvalidTuple if the
+// columns and values of a tuple relation do not have the same length.
+func checkTuple(cols []string, v []interface{}) (string, error) {
+	if len(cols) == 0 {
+		return "without columns", ErrInvalidTuple
+	}
+	if len(v) != len(cols) {
+		return fmt.Sprintf("(%s) expects %d values, got %d", strings.Join(cols, ", "), len(cols), len(v)), ErrInvalidTuple
+	}
+	return "", nil
+}
+
+// tupleQms returns n question marks separated by ", ".
+func tupleQms(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
 // EqInt takes is interested in the CQL indexes of the provided struct as a condition
 // For convenience, that struct is assumed to follow the same rules as other mappings
 func EqInt(i interface{}) Condition {
@@ -90,6 +192,28 @@ func EqInt(i interface{}) Condition {
 	return condition
 }
 
+// EqPartition creates the condition to filter by the partition key of the
+// provided struct, it can be used to get all the rows in a partition.
+func EqPartition(i interface{}) Condition {
+	values, table := MapTable(i)
+	conditions := make([]Condition, len(table.PartitionKey))
+	for i, column := range table.PartitionKey {
+		conditions[i] = Eq(column, values[column])
+	}
+	return And(conditions[0], conditions[1:]...)
+}
+
+// TokenRange creates the condition 'token(partition_key) > from AND
+// token(partition_key) <= to' using the partition key of the table defined by
+// i. It allows to scan a table by ranges of tokens.
+func TokenRange(i interface{}, from, to int64) Condition {
+	token := fmt.Sprintf("token(%s)", strings.Join(GetTable(i).PartitionKey, ", "))
+	return Condition{
+		CQLFragment: fmt.Sprintf("%s > ? AND %s <= ?", token, token),
+		Values:      []interface{}{from, to},
+	}
+}
+
 func True() Condition {
 	return Condition{CQLFragment: "true"}
 }
@@ -1,6 +1,7 @@
 package ecql
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -52,7 +53,7 @@ func TestAndWith3Elements(t *testing.T) {
 
 func TestEq(t *testing.T) {
 	for col, val := range mockOpData {
-		expected := Condition{CQLFragment: col + " = ?", Values: []interface{}{val}}
+		expected := Condition{CQLFragment: col + " = ?", Values: []interface{}{val}, equals: []equality{{col, val}}}
 		result := Eq(col, val)
 		assert.Equal(t, expected, result)
 	}
@@ -99,8 +100,89 @@ func TestIn(t *testing.T) {
 
 func TestEqInt(t *testing.T) {
 	mockInt := MockModel{MockKey2: "second part", MockKey1: "first part", Mockval: "ignore this"}
-	expected := Condition{CQLFragment: "key1 = ? AND key2 = ?", Values: []interface{}{"first part", "second part"}}
+	expected := Condition{CQLFragment: "key1 = ? AND key2 = ?", Values: []interface{}{"first part", "second part"},
+		equals: []equality{{"key1", "first part"}, {"key2", "second part"}}}
 	result := EqInt(mockInt)
 	assert.Equal(t, expected, result)
 
 }
+
+type mockPartitionModel struct {
+	Tenant string `cql:"tenant" cqlkey:"(tenant,bucket),id"`
+	Bucket int    `cql:"bucket"`
+	ID     string `cql:"id"`
+}
+
+func TestEqPartition(t *testing.T) {
+	mockInt := MockModel{MockKey2: "second part", MockKey1: "first part", Mockval: "ignore this"}
+	expected := Condition{CQLFragment: "key1 = ?", Values: []interface{}{"first part"}, equals: []equality{{"key1", "first part"}}}
+	result := EqPartition(mockInt)
+	assert.Equal(t, expected, result)
+
+	mockPartition := mockPartitionModel{Tenant: "tenant", Bucket: 3, ID: "id"}
+	expected = Condition{CQLFragment: "tenant = ? AND bucket = ?", Values: []interface{}{"tenant", 3},
+		equals: []equality{{"tenant", "tenant"}, {"bucket", 3}}}
+	result = EqPartition(mockPartition)
+	assert.Equal(t, expected, result)
+}
+
+func TestTokenRange(t *testing.T) {
+	expected := Condition{CQLFragment: "token(tenant, bucket) > ? AND token(tenant, bucket) <= ?", Values: []interface{}{int64(-10), int64(10)}}
+	result := TokenRange(mockPartitionModel{}, -10, 10)
+	assert.Equal(t, expected, result)
+}
+
+func TestTupleRelations(t *testing.T) {
+	cols := []string{"time", "id"}
+	var tests = []struct {
+		result   Condition
+		fragment string
+	}{
+		{TupleEq(cols, 1, "a"), "(time, id) = (?, ?)"},
+		{TupleGt(cols, 1, "a"), "(time, id) > (?, ?)"},
+		{TupleGe(cols, 1, "a"), "(time, id) >= (?, ?)"},
+		{TupleLt(cols, 1, "a"), "(time, id) < (?, ?)"},
+		{TupleLe(cols, 1, "a"), "(time, id) <= (?, ?)"},
+	}
+	for _, tc := range tests {
+		assert.Equal(t, Condition{CQLFragment: tc.fragment, Values: []interface{}{1, "a"}}, tc.result)
+	}
+
+	expected := Condition{CQLFragment: "(time) > (?)", Values: []interface{}{1}}
+	assert.Equal(t, expected, TupleGt([]string{"time"}, 1))
+
+	sess := &SessionImpl{}
+	for _, tc := range []struct {
+		cond   Condition
+		detail string
+	}{
+		{TupleGt(cols, 1), "(time, id) expects 2 values, got 1"},
+		{TupleLe(cols, 1, "a", 2), "(time, id) expects 2 values, got 3"},
+		{TupleEq(nil), "without columns"},
+	} {
+		err := sess.Select(testStruct{}).Where(Eq("f1", 1), tc.cond).Err()
+		assert.Equal(t, &StatementError{Command: SelectCmd, Table: "mytable", Detail: tc.detail, Err: ErrInvalidTuple}, err)
+		_, _, err = sess.Delete(testStruct{}).If(tc.cond).BuildQueryE()
+		assert.True(t, errors.Is(err, ErrInvalidTuple))
+	}
+}
+
+func TestTupleIn(t *testing.T) {
+	cols := []string{"time", "id"}
+	expected := Condition{CQLFragment: "(time, id) IN ((?, ?), (?, ?))", Values: []interface{}{1, "a", 2, "b"}}
+	result := TupleIn(cols, []interface{}{1, "a"}, []interface{}{2, "b"})
+	assert.Equal(t, expected, result)
+
+	sess := &SessionImpl{}
+	for _, tc := range []struct {
+		cond   Condition
+		detail string
+	}{
+		{TupleIn(cols), "(time, id) IN without values"},
+		{TupleIn(cols, []interface{}{1, "a"}, []interface{}{2}), "(time, id) expects 2 values, got 1"},
+		{TupleIn(nil, []interface{}{}), "without columns"},
+	} {
+		err := sess.Select(testStruct{}).Where(tc.cond).Err()
+		assert.Equal(t, &StatementError{Command: SelectCmd, Table: "mytable", Detail: tc.detail, Err: ErrInvalidTuple}, err)
+	}
+}
@@ -1,7 +1,10 @@
 package ecql
 
 import (
+	"context"
+	"fmt"
 	"os"
+	"reflect"
 
 	"github.com/gocql/gocql"
 )
@@ -13,20 +16,28 @@ var ErrNotFound = gocql.ErrNotFound
 // Session is the interface used by users to interact with the database.
 type Session interface {
 	Get(i interface{}, keys ...interface{}) error
+	GetContext(ctx context.Context, i interface{}, keys ...interface{}) error
 	Set(i interface{}) error
+	SetContext(ctx context.Context, i interface{}) error
 	Del(i interface{}) error
+	DelContext(ctx context.Context, i interface{}) error
 	Exists(i interface{}) (bool, error)
+	ExistsContext(ctx context.Context, i interface{}) (bool, error)
 	Select(i interface{}) Statement
 	Insert(i interface{}) Statement
 	Delete(i interface{}) Statement
 	Update(i interface{}) Statement
 	Count(i interface{}) Statement
 	Batch() Batch
+	UnloggedBatch() Batch
+	CounterBatch() Batch
 	Query(stmt string, args ...interface{}) *gocql.Query
+	ValidateSchema(keyspace string) error
 }
 
 type SessionImpl struct {
 	*gocql.Session
+	executor Executor
 }
 
 // New creates a ecql.Session from an already existent gocql.Session.
@@ -36,6 +47,14 @@ func New(s *gocql.Session) Session {
 	}
 }
 
+// NewWithExecutor creates a ecql.Session that executes the statements using
+// the given Executor. The method Query is not supported by these sessions.
+func NewWithExecutor(e Executor) Session {
+	return &SessionImpl{
+		executor: e,
+	}
+}
+
 // NewSession initializes a new ecql.Session with gocql.ConsterConfig.
 func NewSession(cfg gocql.ClusterConfig) (Session, error) {
 	s, err := gocql.NewSession(cfg)
@@ -46,31 +65,130 @@ func NewSession(cfg gocql.ClusterConfig) (Session, error) {
 	return New(s), nil
 }
 
+// exec returns the Executor used by the session.
+func (s *SessionImpl) exec() Executor {
+	if s.executor == nil {
+		return gocqlExecutor{s.Session}
+	}
+	return s.executor
+}
+
+// query creates a query using the default consistency levels of the table.
+func (s *SessionImpl) query(ctx context.Context, table Table, stmt string, args ...interface{}) Query {
+	query := s.exec().Query(ctx, stmt, args...)
+	if table.Consistency != nil {
+		query = query.Consistency(*table.Consistency)
+	}
+	if table.SerialConsistency != nil {
+		query = query.SerialConsistency(*table.SerialConsistency)
+	}
+	return query
+}
+
 // Get executes a SELECT statements on the table defined in i and sets the
 // fields on i with the information present in the database.
 func (s *SessionImpl) Get(i interface{}, keys ...interface{}) error {
+	return s.GetContext(context.Background(), i, keys...)
+}
+
+// GetContext is like Get but the query will be executed with the given
+// context.
+func (s *SessionImpl) GetContext(ctx context.Context, i interface{}, keys ...interface{}) error {
+	if !isStruct(i) {
+		return typeError(SelectCmd, i)
+	}
 	m, table := MapTable(i)
 	if cql, err := table.BuildQuery(selectQuery); err != nil {
 		return err
 	} else {
-		return s.Query(cql, keys...).MapScan(m)
+		return s.query(ctx, table, cql, keys...).MapScan(m)
 	}
 }
 
 // Set executes an INSERT statement on the the table defined in i and
 // saves the information of i in the dtabase.
+//
+// If the type of i defines a version column, Set will perform an INSERT IF
+// NOT EXISTS if the version is zero or an UPDATE conditioned by the version
+// in i. On success the version in i is incremented, so i must be a pointer,
+// ErrNotPointer is returned if it is not. ErrConcurrentModification is
+// returned if the statement is not applied.
 func (s *SessionImpl) Set(i interface{}) error {
+	return s.SetContext(context.Background(), i)
+}
+
+// SetContext is like Set but the query will be executed with the given
+// context.
+func (s *SessionImpl) SetContext(ctx context.Context, i interface{}) error {
+	if !isStruct(i) {
+		return typeError(InsertCmd, i)
+	}
 	v, _, table := BindTable(i)
+	if table.VersionColumn != "" {
+		return s.setVersion(ctx, i, v, table)
+	}
+
 	if cql, err := table.BuildQuery(insertQuery); err != nil {
 		return err
 	} else {
-		return s.Query(cql, v...).Exec()
+		return s.query(ctx, table, cql, v...).Exec()
 	}
 }
 
+// setVersion saves i on a table with a version column. If the version is the
+// zero value an INSERT IF NOT EXISTS is performed, if not, an UPDATE of the
+// non-key columns conditioned by the current version is executed.
+func (s *SessionImpl) setVersion(ctx context.Context, i interface{}, values []interface{}, table Table) error {
+	if reflect.ValueOf(i).Kind() != reflect.Ptr {
+		return ErrNotPointer
+	}
+	ver, err := versionOf(i)
+	if err != nil {
+		return err
+	}
+	if !reflect.ValueOf(ver.Current).IsZero() {
+		var columns []string
+		for _, col := range table.Columns {
+			if col.Name != table.VersionColumn && !table.isKey(col.Name) {
+				columns = append(columns, col.Name)
+			}
+		}
+		return s.Update(i).Columns(columns...).ExecContext(ctx)
+	}
+
+	cql, err := table.BuildQuery(insertQuery)
+	if err != nil {
+		return err
+	}
+
+	for j, col := range table.Columns {
+		if col.Name == ver.Column {
+			values[j] = ver.Next
+		}
+	}
+
+	current := make(map[string]interface{})
+	if applied, err := s.query(ctx, table, cql+" IF NOT EXISTS", values...).MapScanCAS(current); err != nil {
+		return err
+	} else if applied == false {
+		return ErrConcurrentModification
+	}
+	ver.increment()
+	return nil
+}
+
 // Del extecutes a delete statement on the table defined in i to
 // remove the object i from the database.
 func (s *SessionImpl) Del(i interface{}) error {
+	return s.DelContext(context.Background(), i)
+}
+
+// DelContext is like Del but the query will be executed with the given
+// context.
+func (s *SessionImpl) DelContext(ctx context.Context, i interface{}) error {
+	if !isStruct(i) {
+		return typeError(DeleteCmd, i)
+	}
 	m, table := MapTable(i)
 	if cql, err := table.BuildQuery(deleteQuery); err != nil {
 		return err
@@ -79,13 +197,22 @@ func (s *SessionImpl) Del(i interface{}) error {
 		for i, name := range table.KeyColumns {
 			keys[i] = m[name]
 		}
-		return s.Query(cql, keys...).Exec()
+		return s.query(ctx, table, cql, keys...).Exec()
 	}
 }
 
 // Exists executes a count statement on the table defined in i and
 // returns if the object i exists in the database.
 func (s *SessionImpl) Exists(i interface{}) (bool, error) {
+	return s.ExistsContext(context.Background(), i)
+}
+
+// ExistsContext is like Exists but the query will be executed with the
+// given context.
+func (s *SessionImpl) ExistsContext(ctx context.Context, i interface{}) (bool, error) {
+	if !isStruct(i) {
+		return false, typeError(CountCmd, i)
+	}
 	m, table := MapTable(i)
 	if cql, err := table.BuildQuery(countQuery); err != nil {
 		return false, err
@@ -95,11 +222,17 @@ func (s *SessionImpl) Exists(i interface{}) (bool, error) {
 			keys[i] = m[name]
 		}
 		var count int
-		err = s.Query(cql, keys...).Scan(&count)
+		err = s.query(ctx, table, cql, keys...).Scan(&count)
 		return count > 0, err
 	}
 }
 
+// typeError returns the *StatementError returned by the methods of the
+// session if i is not a struct.
+func typeError(cmd Command, i interface{}) error {
+	return &StatementError{Command: cmd, Detail: fmt.Sprintf("%T", i), Err: ErrInvalidType}
+}
+
 // Select initializes a SELECT statement.
 func (s *SessionImpl) Select(i interface{}) Statement {
 	return NewStatement(s).Do(SelectCmd).Map(i)
@@ -112,12 +245,31 @@ func (s *SessionImpl) Insert(i interface{}) Statement {
 
 // Select initializes an DELETE statement.
 func (s *SessionImpl) Delete(i interface{}) Statement {
-	return NewStatement(s).Do(DeleteCmd).FromType(i).Where(EqInt(i))
+	stmt := NewStatement(s).Do(DeleteCmd).FromType(i)
+	if !isStruct(i) {
+		return stmt
+	}
+	return stmt.Where(EqInt(i))
 }
 
 // Update initializes an UPDATE statement.
+//
+// If the type of i defines a version column, the statement will be executed
+// only if the version in the database matches the version in i, the version
+// will be incremented and ErrConcurrentModification will be returned if the
+// versions do not match.
 func (s *SessionImpl) Update(i interface{}) Statement {
-	return NewStatement(s).Do(UpdateCmd).Bind(i).Where(EqInt(i))
+	stmt := &StatementImpl{session: s}
+	if !isStruct(i) {
+		return stmt.Do(UpdateCmd).Bind(i)
+	}
+	stmt.Do(UpdateCmd).Bind(i).Where(EqInt(i))
+	if ver, err := versionOf(i); err != nil {
+		stmt.setError(err, stmt.Table.VersionColumn)
+	} else {
+		stmt.version = ver
+	}
+	return stmt
 }
 
 // Count initializes a SELECT COUNT(1) statement from the table defined by i.
@@ -130,3 +282,16 @@ func (s *SessionImpl) Count(i interface{}) Statement {
 func (s *SessionImpl) Batch() Batch {
 	return NewBatch(s, gocql.LoggedBatch)
 }
+
+// UnloggedBatch initializes a new UNLOGGED BATCH, it skips the batch log, so
+// it is faster but it is not guaranteed that all the statements are applied if
+// they affect multiple partitions.
+func (s *SessionImpl) UnloggedBatch() Batch {
+	return NewBatch(s, gocql.UnloggedBatch)
+}
+
+// CounterBatch initializes a new COUNTER BATCH, the only kind of batch that
+// can contain counter updates.
+func (s *SessionImpl) CounterBatch() Batch {
+	return NewBatch(s, gocql.CounterBatch)
+}
@@ -1,6 +1,11 @@
 package ecqltest
 
 import (
+	"context"
+	"time"
+
+	"github.com/gocql/gocql"
+
 	"github.com/maraino/ecql"
 	"github.com/maraino/go-mock"
 )
@@ -24,6 +29,13 @@ func (m *Batch) Apply() error {
 	return ret0
 }
 
+// ApplyContext is mocks a call to this method.
+func (m *Batch) ApplyContext(ctx context.Context) error {
+	ret := m.Called(ctx)
+	ret0, _ := ret.Get(0).(error)
+	return ret0
+}
+
 // ApplyCAS is mocks a call to this method.
 func (m *Batch) ApplyCAS() (bool, error) {
 	ret := m.Called()
@@ -31,3 +43,109 @@ func (m *Batch) ApplyCAS() (bool, error) {
 	ret1, _ := ret.Get(1).(error)
 	return ret0, ret1
 }
+
+// ApplyCASContext is mocks a call to this method.
+func (m *Batch) ApplyCASContext(ctx context.Context) (bool, error) {
+	ret := m.Called(ctx)
+	ret0, _ := ret.Get(0).(bool)
+	ret1, _ := ret.Get(1).(error)
+	return ret0, ret1
+}
+
+// Consistency is mocks a call to this method.
+func (m *Batch) Consistency(c gocql.Consistency) ecql.Batch {
+	ret := m.Called(c)
+	ret0, _ := ret.Get(0).(ecql.Batch)
+	return ret0
+}
+
+// SerialConsistency is mocks a call to this method.
+func (m *Batch) SerialConsistency(c gocql.SerialConsistency) ecql.Batch {
+	ret := m.Called(c)
+	ret0, _ := ret.Get(0).(ecql.Batch)
+	return ret0
+}
+
+// Idempotent is mocks a call to this method.
+func (m *Batch) Idempotent(value bool) ecql.Batch {
+	ret := m.Called(value)
+	ret0, _ := ret.Get(0).(ecql.Batch)
+	return ret0
+}
+
+// RetryPolicy is mocks a call to this method.
+func (m *Batch) RetryPolicy(policy gocql.RetryPolicy) ecql.Batch {
+	ret := m.Called(policy)
+	ret0, _ := ret.Get(0).(ecql.Batch)
+	return ret0
+}
+
+// Timeout is mocks a call to this method.
+func (m *Batch) Timeout(d time.Duration) ecql.Batch {
+	ret := m.Called(d)
+	ret0, _ := ret.Get(0).(ecql.Batch)
+	return ret0
+}
+
+// Timestamp is mocks a call to this method.
+func (m *Batch) Timestamp(microseconds int64) ecql.Batch {
+	ret := m.Called(microseconds)
+	ret0, _ := ret.Get(0).(ecql.Batch)
+	return ret0
+}
+
+// Size is mocks a call to this method.
+func (m *Batch) Size() int {
+	ret := m.Called()
+	ret0, _ := ret.Get(0).(int)
+	return ret0
+}
+
+// BuildQuery is mocks a call to this method.
+func (m *Batch) BuildQuery() (string, []interface{}) {
+	ret := m.Called()
+	ret0, _ := ret.Get(0).(string)
+	ret1, _ := ret.Get(1).([]interface{})
+	return ret0, ret1
+}
+
+// Err is mocks a call to this method.
+func (m *Batch) Err() error {
+	ret := m.Called()
+	ret0, _ := ret.Get(0).(error)
+	return ret0
+}
+
+// MapApplyCAS is mocks a call to this method.
+func (m *Batch) MapApplyCAS() (bool, []map[string]interface{}, error) {
+	ret := m.Called()
+	ret0, _ := ret.Get(0).(bool)
+	ret1, _ := ret.Get(1).([]map[string]interface{})
+	ret2, _ := ret.Get(2).(error)
+	return ret0, ret1, ret2
+}
+
+// MapApplyCASContext is mocks a call to this method.
+func (m *Batch) MapApplyCASContext(ctx context.Context) (bool, []map[string]interface{}, error) {
+	ret := m.Called(ctx)
+	ret0, _ := ret.Get(0).(bool)
+	ret1, _ := ret.Get(1).([]map[string]interface{})
+	ret2, _ := ret.Get(2).(error)
+	return ret0, ret1, ret2
+}
+
+// TypeApplyCAS is mocks a call to this method.
+func (m *Batch) TypeApplyCAS(dest interface{}) (bool, error) {
+	ret := m.Called(dest)
+	ret0, _ := ret.Get(0).(bool)
+	ret1, _ := ret.Get(1).(error)
+	return ret0, ret1
+}
+
+// TypeApplyCASContext is mocks a call to this method.
+func (m *Batch) TypeApplyCASContext(ctx context.Context, dest interface{}) (bool, error) {
+	ret := m.Called(ctx, dest)
+	ret0, _ := ret.Get(0).(bool)
+	ret1, _ := ret.Get(1).(error)
+	return ret0, ret1
+}
@@ -18,6 +18,17 @@ func (m *Iter) TypeScan(i interface{}) bool {
 	return result.Bool(0)
 }
 
+func (m *Iter) Scan(i ...interface{}) bool {
+	result := m.Called(i...)
+	return result.Bool(0)
+}
+
+func (m *Iter) PageState() []byte {
+	result := m.Called()
+	state, _ := result.Get(0).([]byte)
+	return state
+}
+
 func (m *Iter) Close() error {
 	result := m.Called()
 	return result.Error(0)
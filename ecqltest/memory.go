@@ -0,0 +1,1746 @@
+package ecqltest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/maraino/ecql"
+)
+
+// Memory is an in-memory ecql.Executor that interprets the statements built
+// by ecql. It allows to test code using an ecql.Session without a Cassandra
+// cluster:
+// 	m := ecqltest.NewMemory()
+// 	if err := m.CreateTable(Tweet{}); err != nil {
+// 		...
+// 	}
+// 	session := m.Session()
+//
+// Tables and user-defined types must be created before using them with
+// CreateTable and CreateType, or executing the CQL statements with Exec.
+//
+// Memory supports SELECT, SELECT DISTINCT, SELECT JSON, INSERT, INSERT JSON,
+// UPDATE, DELETE and BATCH statements with conditions on the primary key,
+// GROUP BY, ORDER BY, LIMIT, PER PARTITION LIMIT, ALLOW FILTERING, TTL,
+// multi-column relations on clustering columns, counters, collection
+// operations, the WRITETIME and TTL functions, the COUNT, MIN, MAX, SUM and
+// AVG aggregates, and IF, IF EXISTS and IF NOT EXISTS conditions.
+// Partitions are sorted by the value of the partition key instead of by its
+// token, USING TIMESTAMP is ignored, and token relations are not supported.
+type Memory struct {
+	// Now returns the current time, it is used to expire the values written
+	// with a TTL. It defaults to time.Now.
+	Now func() time.Time
+
+	mu         sync.Mutex
+	tables     map[string]*memTable
+	types      map[string]gocql.UDTTypeInfo
+	statements map[string]*statement
+}
+
+// NewMemory creates a new Memory without tables.
+func NewMemory() *Memory {
+	return &Memory{
+		Now:        time.Now,
+		tables:     make(map[string]*memTable),
+		types:      make(map[string]gocql.UDTTypeInfo),
+		statements: make(map[string]*statement),
+	}
+}
+
+// Session returns an ecql.Session that stores the data in m.
+func (m *Memory) Session() ecql.Session {
+	return ecql.NewWithExecutor(m)
+}
+
+// CreateTable creates the tables for the given types using ecql.CreateTable.
+func (m *Memory) CreateTable(i ...interface{}) error {
+	for _, v := range i {
+		if cql, err := ecql.CreateTable(v); err != nil {
+			return err
+		} else if err := m.Exec(cql); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateType creates the user-defined types for the given types using
+// ecql.CreateType.
+func (m *Memory) CreateType(i ...interface{}) error {
+	for _, v := range i {
+		if cql, err := ecql.CreateType(v); err != nil {
+			return err
+		} else if err := m.Exec(cql); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Exec executes the given CQL statement.
+func (m *Memory) Exec(stmt string, args ...interface{}) error {
+	_, err := m.execute(context.Background(), stmt, args)
+	return err
+}
+
+// Query implements ecql.Executor.
+func (m *Memory) Query(ctx context.Context, stmt string, args ...interface{}) ecql.Query {
+	return &memQuery{memory: m, ctx: ctx, stmt: stmt, args: args}
+}
+
+// Batch implements ecql.Executor.
+func (m *Memory) Batch(ctx context.Context, typ gocql.BatchType, entries []gocql.BatchEntry) ecql.BatchQuery {
+	return &memBatch{memory: m, ctx: ctx, typ: typ, entries: entries}
+}
+
+func (m *Memory) now() time.Time {
+	if m.Now != nil {
+		return m.Now()
+	}
+	return time.Now()
+}
+
+// parse returns the parsed statement, the statements are cached.
+func (m *Memory) parse(cql string) (*statement, error) {
+	if stmt, ok := m.statements[cql]; ok {
+		return stmt, nil
+	}
+	stmt, err := parse(cql)
+	if err != nil {
+		return nil, err
+	}
+	m.statements[cql] = stmt
+	return stmt, nil
+}
+
+func (m *Memory) table(name string) (*memTable, error) {
+	if t, ok := m.tables[name]; ok {
+		return t, nil
+	}
+	return nil, fmt.Errorf("ecqltest: unconfigured table %s", name)
+}
+
+func (m *Memory) execute(ctx context.Context, cql string, args []interface{}) (*result, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stmt, err := m.parse(cql)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) != stmt.binds {
+		return nil, fmt.Errorf("ecqltest: expected %d values but got %d in %q", stmt.binds, len(args), cql)
+	}
+
+	switch stmt.typ {
+	case createTableStatement:
+		return nil, m.createTable(stmt)
+	case createTypeStatement:
+		return nil, m.createType(stmt)
+	case truncateStatement:
+		t, err := m.table(stmt.table)
+		if err != nil {
+			return nil, err
+		}
+		t.partitions = nil
+		return nil, nil
+	case dropTableStatement:
+		if _, ok := m.tables[stmt.table]; !ok && !stmt.ifExists {
+			return nil, fmt.Errorf("ecqltest: unconfigured table %s", stmt.table)
+		}
+		delete(m.tables, stmt.table)
+		return nil, nil
+	case selectStatement:
+		return m.selectRows(stmt, args)
+	}
+
+	mut, err := m.prepare(stmt, args)
+	if err != nil {
+		return nil, err
+	}
+
+	now := m.now()
+	if err := mut.validate(now); err != nil {
+		return nil, err
+	}
+	if mut.conditional() {
+		if res, ok := mut.check(now); !ok {
+			return res, nil
+		}
+		mut.apply(now)
+		return appliedResult(true), nil
+	}
+
+	mut.apply(now)
+	return nil, nil
+}
+
+func (m *Memory) executeBatch(ctx context.Context, typ gocql.BatchType, entries []gocql.BatchEntry) (bool, *result, error) {
+	if err := ctx.Err(); err != nil {
+		return false, nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	conditional := false
+	mutations := make([]*mutation, len(entries))
+	for i, e := range entries {
+		stmt, err := m.parse(e.Stmt)
+		if err != nil {
+			return false, nil, err
+		}
+		if stmt.typ != insertStatement && stmt.typ != updateStatement && stmt.typ != deleteStatement {
+			return false, nil, fmt.Errorf("ecqltest: only INSERT, UPDATE and DELETE statements are allowed in batches")
+		}
+		if len(e.Args) != stmt.binds {
+			return false, nil, fmt.Errorf("ecqltest: expected %d values but got %d in %q", stmt.binds, len(e.Args), e.Stmt)
+		}
+		if mutations[i], err = m.prepare(stmt, e.Args); err != nil {
+			return false, nil, err
+		}
+		conditional = conditional || mutations[i].conditional()
+	}
+	if err := checkBatchType(typ, mutations); err != nil {
+		return false, nil, err
+	}
+
+	// All conditions must be met to apply the batch.
+	now := m.now()
+	for _, mut := range mutations {
+		if err := mut.validate(now); err != nil {
+			return false, nil, err
+		}
+	}
+	var res *result
+	if conditional {
+		if err := checkConditionalBatch(mutations); err != nil {
+			return false, nil, err
+		}
+		for _, mut := range mutations {
+			if !mut.conditional() {
+				continue
+			}
+			if _, ok := mut.check(now); !ok {
+				return false, batchValues(mutations, now), nil
+			}
+		}
+		res = appliedResult(true)
+	}
+
+	for _, mut := range mutations {
+		mut.apply(now)
+	}
+	return true, res, nil
+}
+
+func (m *Memory) createTable(stmt *statement) error {
+	if _, ok := m.tables[stmt.table]; ok {
+		if stmt.ifNotExists {
+			return nil
+		}
+		return fmt.Errorf("ecqltest: table %s already exists", stmt.table)
+	}
+
+	t := &memTable{
+		name:         stmt.table,
+		columns:      make(map[string]gocql.TypeInfo),
+		static:       make(map[string]bool),
+		partitionKey: stmt.partitionKey,
+		clustering:   stmt.clustering,
+		desc:         make([]bool, len(stmt.clustering)),
+	}
+
+	var regular []string
+	for _, def := range stmt.definitions {
+		info, err := m.typeInfo(def.typ)
+		if err != nil {
+			return err
+		}
+		t.columns[def.name] = info
+		t.static[def.name] = def.static
+		if !t.isKey(def.name) {
+			regular = append(regular, def.name)
+		}
+	}
+
+	if len(t.partitionKey) == 0 {
+		return fmt.Errorf("ecqltest: table %s has no primary key", t.name)
+	}
+	for _, col := range append(append([]string{}, t.partitionKey...), t.clustering...) {
+		if _, ok := t.columns[col]; !ok {
+			return fmt.Errorf("ecqltest: unknown definition %s referenced in PRIMARY KEY", col)
+		}
+	}
+	// Like Cassandra, the clustering order must list all the clustering
+	// columns in the order of the primary key.
+	for i, o := range stmt.orders {
+		j := index(t.clustering, o.column)
+		if j < 0 {
+			return fmt.Errorf("ecqltest: only clustering key columns can be defined in CLUSTERING ORDER directive, got %s", o.column)
+		}
+		if i != j {
+			return fmt.Errorf("ecqltest: the order of columns in the CLUSTERING ORDER directive must match that of the clustering columns (%s)", strings.Join(t.clustering, ", "))
+		}
+		t.desc[j] = o.desc
+	}
+	if len(stmt.orders) > 0 && len(stmt.orders) < len(t.clustering) {
+		return fmt.Errorf("ecqltest: missing CLUSTERING ORDER for column %s", t.clustering[len(stmt.orders)])
+	}
+
+	// SELECT * returns the key columns and then the rest in alphabetical
+	// order.
+	sort.Strings(regular)
+	t.names = append(append(append(t.names, t.partitionKey...), t.clustering...), regular...)
+
+	m.tables[t.name] = t
+	return nil
+}
+
+func (m *Memory) createType(stmt *statement) error {
+	if _, ok := m.types[stmt.table]; ok {
+		if stmt.ifNotExists {
+			return nil
+		}
+		return fmt.Errorf("ecqltest: type %s already exists", stmt.table)
+	}
+
+	udt := gocql.UDTTypeInfo{
+		NativeType: gocql.NewNativeType(protoVersion, gocql.TypeUDT, ""),
+		Name:       stmt.table,
+	}
+	for _, def := range stmt.definitions {
+		info, err := m.typeInfo(def.typ)
+		if err != nil {
+			return err
+		}
+		udt.Elements = append(udt.Elements, gocql.UDTField{Name: def.name, Type: info})
+	}
+
+	m.types[udt.Name] = udt
+	return nil
+}
+
+func (m *Memory) selectRows(stmt *statement, args []interface{}) (*result, error) {
+	t, err := m.table(stmt.table)
+	if err != nil {
+		return nil, err
+	}
+
+	relations, err := t.bind(stmt.where, args)
+	if err != nil {
+		return nil, err
+	}
+	if !stmt.allowFiltering && t.needsFiltering(relations) {
+		return nil, fmt.Errorf("ecqltest: cannot execute this query as it might involve data filtering, use ALLOW FILTERING")
+	}
+
+	selectors := stmt.selectors
+	if len(selectors) == 0 {
+		for _, col := range t.names {
+			selectors = append(selectors, selector{column: col})
+		}
+	}
+	res := &result{columns: make([]string, len(selectors)), types: make([]gocql.TypeInfo, len(selectors))}
+	aggregate := false
+	for i, s := range selectors {
+		if s.column == "*" {
+			res.columns[i], res.types[i] = s.name(), bigintType
+			aggregate = true
+			continue
+		}
+		info, ok := t.columns[s.column]
+		if !ok {
+			return nil, fmt.Errorf("ecqltest: undefined column name %s", s.column)
+		}
+		switch s.fn {
+		case "":
+		case "writetime", "ttl":
+			if t.isKey(s.column) {
+				return nil, fmt.Errorf("ecqltest: cannot use selection function %s on PRIMARY KEY part %s", s.fn, s.column)
+			}
+			if info = bigintType; s.fn == "ttl" {
+				info = intType
+			}
+		case "count":
+			info = bigintType
+			aggregate = true
+		case "min", "max", "sum", "avg":
+			aggregate = true
+		default:
+			return nil, fmt.Errorf("ecqltest: unsupported function %s", s.fn)
+		}
+		if stmt.distinct && (s.fn != "" || (index(t.partitionKey, s.column) < 0 && !t.static[s.column])) {
+			return nil, fmt.Errorf("ecqltest: SELECT DISTINCT queries must only request partition key columns and/or static columns, got %s", s.name())
+		}
+		res.columns[i] = s.name()
+		res.types[i] = info
+	}
+
+	// GROUP BY must use a prefix of the primary key including the
+	// partition key.
+	key := append(append([]string{}, t.partitionKey...), t.clustering...)
+	if len(stmt.groupBy) > 0 && len(stmt.groupBy) < len(t.partitionKey) || len(stmt.groupBy) > len(key) {
+		return nil, fmt.Errorf("ecqltest: group by currently only support groups of columns following their declared order in the PRIMARY KEY")
+	}
+	for i, col := range stmt.groupBy {
+		if col != key[i] {
+			return nil, fmt.Errorf("ecqltest: group by currently only support groups of columns following their declared order in the PRIMARY KEY")
+		}
+	}
+
+	limit, err := bindLimit(stmt.limit, args)
+	if err != nil {
+		return nil, err
+	}
+	perPartitionLimit, err := bindLimit(stmt.perPartitionLimit, args)
+	if err != nil {
+		return nil, err
+	}
+
+	reverse := false
+	if len(stmt.orders) > 0 {
+		i := index(t.clustering, stmt.orders[0].column)
+		if i < 0 {
+			return nil, fmt.Errorf("ecqltest: order by is only supported on clustering columns, got %s", stmt.orders[0].column)
+		}
+		reverse = stmt.orders[0].desc != t.desc[i]
+	}
+
+	now := m.now()
+	var matches []memMatch
+	for _, p := range t.partitions {
+		n := 0
+		for i := range p.rows {
+			r := p.rows[i]
+			if reverse {
+				r = p.rows[len(p.rows)-1-i]
+			}
+			if !r.alive(now) || !t.match(p, r, relations, now) {
+				continue
+			}
+			if perPartitionLimit > 0 && n == perPartitionLimit {
+				break
+			}
+			n++
+			matches = append(matches, memMatch{p, r})
+			if stmt.distinct {
+				break
+			}
+		}
+	}
+
+	if aggregate || len(stmt.groupBy) > 0 {
+		groups := t.group(matches, stmt.groupBy, now)
+		for _, group := range groups {
+			values := make([]interface{}, len(selectors))
+			for j, s := range selectors {
+				if values[j], err = t.aggregateValue(group, s, res.types[j], now); err != nil {
+					return nil, err
+				}
+			}
+			res.rows = append(res.rows, values)
+		}
+	} else {
+		for _, match := range matches {
+			values := make([]interface{}, len(selectors))
+			for j, s := range selectors {
+				values[j] = t.selectValue(match.p, match.r, s, now)
+			}
+			res.rows = append(res.rows, values)
+		}
+	}
+
+	if limit > 0 && len(res.rows) > limit {
+		res.rows = res.rows[:limit]
+	}
+	if stmt.json {
+		return res.toJSON()
+	}
+	return res, nil
+}
+
+// memMatch is a row matching the conditions of a SELECT statement.
+type memMatch struct {
+	p *memPartition
+	r *memRow
+}
+
+// group splits the matching rows in groups with the same values in the given
+// columns. Without columns all the rows are in one group.
+func (t *memTable) group(matches []memMatch, columns []string, now time.Time) [][]memMatch {
+	if len(columns) == 0 {
+		return [][]memMatch{matches}
+	}
+
+	var groups [][]memMatch
+	var last []interface{}
+	for _, match := range matches {
+		key := make([]interface{}, len(columns))
+		for i, col := range columns {
+			key[i] = t.value(match.p, match.r, col, now)
+		}
+		if len(groups) == 0 || compareKeys(last, key, nil) != 0 {
+			groups = append(groups, nil)
+			last = key
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], match)
+	}
+	return groups
+}
+
+// aggregateValue returns the value of a selector in a group of rows. Selectors
+// that are not aggregates return the value of the first row.
+func (t *memTable) aggregateValue(group []memMatch, s selector, info gocql.TypeInfo, now time.Time) (interface{}, error) {
+	switch s.fn {
+	case "count", "min", "max", "sum", "avg":
+	default:
+		if len(group) == 0 {
+			return nil, nil
+		}
+		return t.selectValue(group[0].p, group[0].r, s, now), nil
+	}
+
+	values := make([]interface{}, len(group))
+	for i, match := range group {
+		if s.column == "*" {
+			values[i] = true
+		} else {
+			values[i] = t.value(match.p, match.r, s.column, now)
+		}
+	}
+	return aggregate(s.fn, info, values)
+}
+
+// bindLimit returns the value of a LIMIT clause, or 0 if it is not set.
+func bindLimit(limit *term, args []interface{}) (int, error) {
+	if limit == nil {
+		return 0, nil
+	}
+	v, err := bindValue(bigintType, *limit, args)
+	if err != nil {
+		return 0, err
+	}
+	return int(v.(int64)), nil
+}
+
+// prepare binds the values of an INSERT, UPDATE or DELETE statement.
+func (m *Memory) prepare(stmt *statement, args []interface{}) (*mutation, error) {
+	t, err := m.table(stmt.table)
+	if err != nil {
+		return nil, err
+	}
+
+	mut := &mutation{stmt: stmt, table: t}
+	var relations []boundRelation
+	switch stmt.typ {
+	case insertStatement:
+		columns, values, err := t.insertValues(stmt, args)
+		if err != nil {
+			return nil, err
+		}
+		for i, col := range columns {
+			if values[i] == gocql.UnsetValue {
+				if t.isKey(col) {
+					return nil, fmt.Errorf("ecqltest: invalid unset value for column %s", col)
+				}
+				continue
+			}
+			if t.isKey(col) {
+				relations = append(relations, boundRelation{column: col, op: "=", values: []interface{}{values[i]}})
+			} else {
+				mut.assignments = append(mut.assignments, boundAssignment{column: col, op: "=", value: values[i]})
+			}
+		}
+	case updateStatement:
+		for _, a := range stmt.assignments {
+			info, ok := t.columns[a.column]
+			if !ok {
+				return nil, fmt.Errorf("ecqltest: undefined column name %s", a.column)
+			}
+			if t.isKey(a.column) {
+				return nil, fmt.Errorf("ecqltest: PRIMARY KEY part %s found in SET part", a.column)
+			}
+			b, err := bindAssignment(info, a, args)
+			if err != nil {
+				return nil, err
+			}
+			// Unset values leave the column unchanged.
+			if b.value == gocql.UnsetValue || b.key == gocql.UnsetValue {
+				continue
+			}
+			mut.assignments = append(mut.assignments, b)
+		}
+	case deleteStatement:
+		for _, col := range stmt.columns {
+			if _, ok := t.columns[col]; !ok {
+				return nil, fmt.Errorf("ecqltest: undefined column name %s", col)
+			}
+			if t.isKey(col) {
+				return nil, fmt.Errorf("ecqltest: invalid identifier %s for deletion", col)
+			}
+		}
+	}
+
+	if stmt.typ != insertStatement {
+		if hasTuple(stmt.where) || hasTuple(stmt.conditions) {
+			return nil, fmt.Errorf("ecqltest: multi-column relations are only supported on SELECT statements")
+		}
+		if relations, err = t.bind(stmt.where, args); err != nil {
+			return nil, err
+		}
+	}
+
+	partition := make([][]interface{}, len(t.partitionKey))
+	clustering := make([][]interface{}, len(t.clustering))
+	for _, rel := range relations {
+		i, j := index(t.partitionKey, rel.column), index(t.clustering, rel.column)
+		switch {
+		case i < 0 && j < 0:
+			return nil, fmt.Errorf("ecqltest: non PRIMARY KEY column %s found in where clause", rel.column)
+		case stmt.typ == deleteStatement && j >= 0:
+			mut.filters = append(mut.filters, rel)
+			if rel.op == "=" {
+				clustering[j] = rel.values
+			}
+		case rel.op != "=" && rel.op != "IN":
+			return nil, fmt.Errorf("ecqltest: only EQ and IN relations are supported on the primary key of %s", rel.column)
+		case i >= 0:
+			partition[i] = rel.values
+		default:
+			clustering[j] = rel.values
+		}
+		for _, v := range rel.values {
+			if v == nil {
+				return nil, fmt.Errorf("ecqltest: invalid null value for primary key part %s", rel.column)
+			}
+		}
+	}
+
+	for i, values := range partition {
+		if values == nil {
+			return nil, fmt.Errorf("ecqltest: missing mandatory PRIMARY KEY part %s", t.partitionKey[i])
+		}
+	}
+	mut.keys = product(partition)
+
+	// Updates must define the full primary key, deletes with conditions too.
+	if stmt.typ != deleteStatement || mut.conditional() {
+		for i, values := range clustering {
+			if values == nil {
+				return nil, fmt.Errorf("ecqltest: missing mandatory PRIMARY KEY part %s", t.clustering[i])
+			}
+		}
+		mut.clustering = product(clustering)
+	}
+
+	if mut.conditional() {
+		if len(mut.keys) != 1 || len(mut.clustering) != 1 {
+			return nil, fmt.Errorf("ecqltest: IN on the primary key is not supported with conditional statements")
+		}
+		if mut.conditions, err = t.bind(stmt.conditions, args); err != nil {
+			return nil, err
+		}
+	}
+
+	if stmt.ttl != nil {
+		v, err := bindValue(bigintType, *stmt.ttl, args)
+		if err != nil {
+			return nil, err
+		}
+		mut.ttl = time.Duration(v.(int64)) * time.Second
+	}
+
+	return mut, nil
+}
+
+// memTable contains the definition and the data of a table. The partitions
+// are sorted by the partition key and the rows by the clustering columns.
+type memTable struct {
+	name         string
+	columns      map[string]gocql.TypeInfo
+	names        []string
+	partitionKey []string
+	clustering   []string
+	desc         []bool
+	static       map[string]bool
+	partitions   []*memPartition
+}
+
+type memPartition struct {
+	key    []interface{}
+	static map[string]*memCell
+	rows   []*memRow
+}
+
+// memRow is a row in a partition. The marker is set by INSERT statements, and
+// a row exists while the marker or any of its cells are alive.
+type memRow struct {
+	key    []interface{}
+	marker *memCell
+	cells  map[string]*memCell
+}
+
+type memCell struct {
+	value   interface{}
+	expires time.Time
+	written int64
+}
+
+func (c *memCell) alive(now time.Time) bool {
+	return c != nil && (c.expires.IsZero() || now.Before(c.expires))
+}
+
+func (r *memRow) alive(now time.Time) bool {
+	if r.marker.alive(now) {
+		return true
+	}
+	for _, c := range r.cells {
+		if c.alive(now) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *memTable) isKey(col string) bool {
+	return index(t.partitionKey, col) >= 0 || index(t.clustering, col) >= 0
+}
+
+// isCounter returns true if the table has counter columns.
+func (t *memTable) isCounter() bool {
+	for _, info := range t.columns {
+		if info.Type() == gocql.TypeCounter {
+			return true
+		}
+	}
+	return false
+}
+
+// partition returns the partition with the given key, creating it if create
+// is true.
+func (t *memTable) partition(key []interface{}, create bool) *memPartition {
+	i := sort.Search(len(t.partitions), func(i int) bool {
+		return compareKeys(t.partitions[i].key, key, nil) >= 0
+	})
+	if i < len(t.partitions) && compareKeys(t.partitions[i].key, key, nil) == 0 {
+		return t.partitions[i]
+	}
+	if !create {
+		return nil
+	}
+
+	p := &memPartition{key: key, static: make(map[string]*memCell)}
+	t.partitions = append(t.partitions, nil)
+	copy(t.partitions[i+1:], t.partitions[i:])
+	t.partitions[i] = p
+	return p
+}
+
+func (t *memTable) removePartition(p *memPartition) {
+	for i := range t.partitions {
+		if t.partitions[i] == p {
+			t.partitions = append(t.partitions[:i], t.partitions[i+1:]...)
+			return
+		}
+	}
+}
+
+// row returns the row with the given clustering key, creating it if create
+// is true.
+func (t *memTable) row(p *memPartition, key []interface{}, create bool) *memRow {
+	i := sort.Search(len(p.rows), func(i int) bool {
+		return compareKeys(p.rows[i].key, key, t.desc) >= 0
+	})
+	if i < len(p.rows) && compareKeys(p.rows[i].key, key, t.desc) == 0 {
+		return p.rows[i]
+	}
+	if !create {
+		return nil
+	}
+
+	r := &memRow{key: key, cells: make(map[string]*memCell)}
+	p.rows = append(p.rows, nil)
+	copy(p.rows[i+1:], p.rows[i:])
+	p.rows[i] = r
+	return r
+}
+
+// value returns the value of a column in a row.
+func (t *memTable) value(p *memPartition, r *memRow, col string, now time.Time) interface{} {
+	if i := index(t.partitionKey, col); i >= 0 {
+		return p.key[i]
+	}
+	if i := index(t.clustering, col); i >= 0 {
+		return r.key[i]
+	}
+
+	if c := t.cell(p, r, col, now); c != nil {
+		return c.value
+	}
+	return nil
+}
+
+// cell returns the cell of a regular or static column if it is alive.
+func (t *memTable) cell(p *memPartition, r *memRow, col string, now time.Time) *memCell {
+	var c *memCell
+	if t.static[col] {
+		c = p.static[col]
+	} else if r != nil {
+		c = r.cells[col]
+	}
+	if c.alive(now) {
+		return c
+	}
+	return nil
+}
+
+// selectValue returns the value of a selector in a row.
+func (t *memTable) selectValue(p *memPartition, r *memRow, s selector, now time.Time) interface{} {
+	switch s.fn {
+	case "writetime":
+		if c := t.cell(p, r, s.column, now); c != nil {
+			return c.written
+		}
+		return nil
+	case "ttl":
+		if c := t.cell(p, r, s.column, now); c != nil && !c.expires.IsZero() {
+			return int(math.Ceil(c.expires.Sub(now).Seconds()))
+		}
+		return nil
+	default:
+		return t.value(p, r, s.column, now)
+	}
+}
+
+func (t *memTable) match(p *memPartition, r *memRow, relations []boundRelation, now time.Time) bool {
+	for _, rel := range relations {
+		var v interface{}
+		if rel.tuple != nil {
+			values := make([]interface{}, len(rel.tuple))
+			for i, col := range rel.tuple {
+				values[i] = t.value(p, r, col, now)
+			}
+			v = values
+		} else {
+			v = t.value(p, r, rel.column, now)
+		}
+		if !rel.match(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// needsFiltering returns true if the relations require ALLOW FILTERING.
+// CONTAINS relations are assumed to use a secondary index.
+func (t *memTable) needsFiltering(relations []boundRelation) bool {
+	partition, clustering := make(map[string]bool), false
+	for _, rel := range relations {
+		switch {
+		case rel.tuple != nil:
+			clustering = true
+		case index(t.partitionKey, rel.column) >= 0:
+			if rel.op != "=" && rel.op != "IN" {
+				return true
+			}
+			partition[rel.column] = true
+		case index(t.clustering, rel.column) >= 0:
+			clustering = true
+		case rel.op == "CONTAINS" || rel.op == "CONTAINS KEY":
+		default:
+			return true
+		}
+	}
+	return (len(partition) > 0 || clustering) && len(partition) != len(t.partitionKey)
+}
+
+// bind converts the values in the relations to the types of the columns.
+func (t *memTable) bind(relations []relation, args []interface{}) ([]boundRelation, error) {
+	bound := make([]boundRelation, len(relations))
+	for i, rel := range relations {
+		if rel.tuple != nil {
+			b, err := t.bindTuple(rel, args)
+			if err != nil {
+				return nil, err
+			}
+			bound[i] = b
+			continue
+		}
+
+		info, ok := t.columns[rel.column]
+		if !ok {
+			return nil, fmt.Errorf("ecqltest: undefined column name %s", rel.column)
+		}
+
+		var err error
+		switch rel.op {
+		case "CONTAINS":
+			info, err = elemInfo(info, false)
+		case "CONTAINS KEY":
+			info, err = elemInfo(info, true)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		bound[i] = boundRelation{column: rel.column, op: rel.op, values: make([]interface{}, len(rel.terms))}
+		for j := range rel.terms {
+			if bound[i].values[j], err = bindValue(info, rel.terms[j], args); err != nil {
+				return nil, err
+			}
+			if bound[i].values[j] == gocql.UnsetValue {
+				return nil, fmt.Errorf("ecqltest: invalid unset value for column %s", rel.column)
+			}
+		}
+	}
+	return bound, nil
+}
+
+// bindTuple converts the values in a multi-column relation to the types of
+// the columns. The columns must be clustering columns in the order of the
+// PRIMARY KEY.
+func (t *memTable) bindTuple(rel relation, args []interface{}) (boundRelation, error) {
+	b := boundRelation{column: rel.column, op: rel.op, tuple: rel.tuple, values: make([]interface{}, len(rel.tuples))}
+	first := -1
+	for i, col := range rel.tuple {
+		if _, ok := t.columns[col]; !ok {
+			return b, fmt.Errorf("ecqltest: undefined column name %s", col)
+		}
+		j := index(t.clustering, col)
+		if j < 0 {
+			return b, fmt.Errorf("ecqltest: multi-column relations can only be applied to clustering columns but was applied to %s", col)
+		}
+		if i == 0 {
+			first = j
+		} else if j != first+i {
+			return b, fmt.Errorf("ecqltest: clustering columns must appear in the PRIMARY KEY order in multi-column relations: (%s)", rel.column)
+		}
+	}
+
+	for i, terms := range rel.tuples {
+		values := make([]interface{}, len(terms))
+		for j := range terms {
+			var err error
+			if values[j], err = bindValue(t.columns[rel.tuple[j]], terms[j], args); err != nil {
+				return b, err
+			}
+			if values[j] == nil || values[j] == gocql.UnsetValue {
+				return b, fmt.Errorf("ecqltest: invalid null value in condition for column %s", rel.tuple[j])
+			}
+		}
+		b.values[i] = values
+	}
+	return b, nil
+}
+
+// hasTuple returns true if any of the relations is a multi-column relation.
+func hasTuple(relations []relation) bool {
+	for _, rel := range relations {
+		if rel.tuple != nil {
+			return true
+		}
+	}
+	return false
+}
+
+type boundRelation struct {
+	column string
+	op     string
+	tuple  []string
+	values []interface{}
+}
+
+// compare compares a value with one of the values of the relation, the
+// values of multi-column relations are compared element by element.
+func (rel boundRelation) compare(v, value interface{}) int {
+	if rel.tuple == nil {
+		return compareValues(v, value)
+	}
+	a, b := v.([]interface{}), value.([]interface{})
+	for i := range a {
+		if c := compareValues(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func (rel boundRelation) match(v interface{}) bool {
+	switch rel.op {
+	case "=":
+		return rel.compare(v, rel.values[0]) == 0
+	case "!=":
+		return compareValues(v, rel.values[0]) != 0
+	case "IN":
+		for _, value := range rel.values {
+			if rel.compare(v, value) == 0 {
+				return true
+			}
+		}
+		return false
+	case "CONTAINS", "CONTAINS KEY":
+		if v == nil {
+			return false
+		}
+		rv := reflect.ValueOf(v)
+		switch {
+		case rv.Kind() == reflect.Map && rel.op == "CONTAINS KEY":
+			for _, k := range rv.MapKeys() {
+				if compareValues(k.Interface(), rel.values[0]) == 0 {
+					return true
+				}
+			}
+		case rv.Kind() == reflect.Map:
+			for _, k := range rv.MapKeys() {
+				if compareValues(rv.MapIndex(k).Interface(), rel.values[0]) == 0 {
+					return true
+				}
+			}
+		case rv.Kind() == reflect.Slice:
+			for i := 0; i < rv.Len(); i++ {
+				if compareValues(rv.Index(i).Interface(), rel.values[0]) == 0 {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	if v == nil || rel.values[0] == nil {
+		return false
+	}
+	c := rel.compare(v, rel.values[0])
+	switch rel.op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	default:
+		return c >= 0
+	}
+}
+
+type boundAssignment struct {
+	column string
+	op     string
+	key    interface{}
+	value  interface{}
+}
+
+var intType = gocql.NewNativeType(protoVersion, gocql.TypeInt, "")
+
+// bindAssignment binds the values of an assignment checking that the
+// operation is valid for the type of the column.
+func bindAssignment(info gocql.TypeInfo, a assignment, args []interface{}) (boundAssignment, error) {
+	var err error
+	b := boundAssignment{column: a.column, op: a.op}
+	typ := info.Type()
+
+	switch {
+	case a.key != nil:
+		// Element of a list or a map: c[?] = ?
+		keyInfo, elem := gocql.TypeInfo(intType), info
+		switch typ {
+		case gocql.TypeList:
+		case gocql.TypeMap:
+			if keyInfo, err = elemInfo(info, true); err != nil {
+				return b, err
+			}
+		default:
+			return b, fmt.Errorf("ecqltest: invalid operation on non list or map column %s", a.column)
+		}
+		if elem, err = elemInfo(info, false); err != nil {
+			return b, err
+		}
+		if b.key, err = bindValue(keyInfo, *a.key, args); err != nil {
+			return b, err
+		} else if b.key == nil {
+			return b, fmt.Errorf("ecqltest: invalid null key for column %s", a.column)
+		}
+		b.op = "[]"
+		b.value, err = bindValue(elem, a.term, args)
+		return b, err
+	case a.op == "=", typ == gocql.TypeCounter && a.op != "prepend":
+	case a.op == "prepend" && typ == gocql.TypeList:
+	case a.op == "-" && typ == gocql.TypeMap:
+		// Map keys are removed with a set of keys.
+		keyInfo, err := elemInfo(info, true)
+		if err != nil {
+			return b, err
+		}
+		info = gocql.CollectionType{NativeType: gocql.NewNativeType(protoVersion, gocql.TypeSet, ""), Elem: keyInfo}
+	case a.op != "prepend" && (typ == gocql.TypeList || typ == gocql.TypeSet || typ == gocql.TypeMap):
+	default:
+		return b, fmt.Errorf("ecqltest: invalid operation on column %s", a.column)
+	}
+
+	b.value, err = bindValue(info, a.term, args)
+	return b, err
+}
+
+// insertValues returns the columns and the values of an INSERT statement.
+func (t *memTable) insertValues(stmt *statement, args []interface{}) ([]string, []interface{}, error) {
+	if stmt.json {
+		return t.jsonValues(stmt, args)
+	}
+
+	if len(stmt.columns) != len(stmt.values) {
+		return nil, nil, fmt.Errorf("ecqltest: unmatched column names and values")
+	}
+	values := make([]interface{}, len(stmt.columns))
+	for i, col := range stmt.columns {
+		info, ok := t.columns[col]
+		if !ok {
+			return nil, nil, fmt.Errorf("ecqltest: undefined column name %s", col)
+		}
+		v, err := bindValue(info, stmt.values[i], args)
+		if err != nil {
+			return nil, nil, err
+		}
+		values[i] = v
+	}
+	return stmt.columns, values, nil
+}
+
+// jsonValues returns the columns and the values of an INSERT JSON statement.
+// With DEFAULT NULL the columns not present in the document are set to null.
+func (t *memTable) jsonValues(stmt *statement, args []interface{}) ([]string, []interface{}, error) {
+	v, err := bindValue(textType, stmt.values[0], args)
+	if err != nil {
+		return nil, nil, err
+	}
+	s, _ := v.(string)
+
+	var doc map[string]interface{}
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, nil, fmt.Errorf("ecqltest: could not decode JSON string '%s': %s", s, err)
+	}
+
+	var columns []string
+	var values []interface{}
+	for _, col := range t.names {
+		raw, ok := doc[col]
+		if !ok && stmt.defaultUnset {
+			continue
+		}
+		value, err := fromJSON(t.columns[col], raw)
+		if err != nil {
+			return nil, nil, fmt.Errorf("ecqltest: error decoding JSON value for %s: %s", col, err)
+		}
+		columns = append(columns, col)
+		values = append(values, value)
+		delete(doc, col)
+	}
+	for col := range doc {
+		return nil, nil, fmt.Errorf("ecqltest: JSON values map contains unrecognized column: %s", col)
+	}
+	return columns, values, nil
+}
+
+// mutation is a bound INSERT, UPDATE or DELETE statement.
+type mutation struct {
+	stmt        *statement
+	table       *memTable
+	keys        [][]interface{}
+	clustering  [][]interface{}
+	filters     []boundRelation
+	assignments []boundAssignment
+	conditions  []boundRelation
+	ttl         time.Duration
+}
+
+func (mut *mutation) conditional() bool {
+	return mut.stmt.ifExists || mut.stmt.ifNotExists || len(mut.stmt.conditions) > 0
+}
+
+// check verifies the conditions of the statement, if they are not met it
+// returns the result with the current values.
+func (mut *mutation) check(now time.Time) (*result, bool) {
+	t := mut.table
+	var r *memRow
+	p := t.partition(mut.keys[0], false)
+	if p != nil {
+		if r = t.row(p, mut.clustering[0], false); r != nil && !r.alive(now) {
+			r = nil
+		}
+	}
+
+	switch {
+	case mut.stmt.ifNotExists:
+		if r == nil {
+			return nil, true
+		}
+		return t.currentValues(p, r, t.names, now), false
+	case mut.stmt.ifExists:
+		return appliedResult(false), r != nil
+	}
+
+	if r != nil && t.match(p, r, mut.conditions, now) {
+		return nil, true
+	}
+	if r == nil {
+		return appliedResult(false), false
+	}
+
+	var columns []string
+	for _, rel := range mut.conditions {
+		if index(columns, rel.column) < 0 {
+			columns = append(columns, rel.column)
+		}
+	}
+	return t.currentValues(p, r, columns, now), false
+}
+
+// currentValues returns the result of a statement not applied with the values
+// of the given columns.
+func (t *memTable) currentValues(p *memPartition, r *memRow, columns []string, now time.Time) *result {
+	res := appliedResult(false)
+	for _, col := range columns {
+		res.columns = append(res.columns, col)
+		res.types = append(res.types, t.columns[col])
+		res.rows[0] = append(res.rows[0], t.value(p, r, col, now))
+	}
+	return res
+}
+
+func (mut *mutation) apply(now time.Time) {
+	t := mut.table
+	var expires time.Time
+	if mut.ttl > 0 {
+		expires = now.Add(mut.ttl)
+	}
+	written := now.UnixNano() / 1000
+
+	if mut.stmt.typ == deleteStatement {
+		for _, key := range mut.keys {
+			if p := t.partition(key, false); p != nil {
+				mut.delete(p, now)
+			}
+		}
+		return
+	}
+
+	for _, key := range mut.keys {
+		p := t.partition(key, true)
+		for _, ck := range mut.clustering {
+			r := t.row(p, ck, true)
+			if mut.stmt.typ == insertStatement {
+				r.marker = &memCell{expires: expires, written: written}
+			}
+			for _, a := range mut.assignments {
+				cells := r.cells
+				if t.static[a.column] {
+					cells = p.static
+				}
+				switch a.op {
+				case "=":
+					if a.value == nil {
+						delete(cells, a.column)
+					} else {
+						cells[a.column] = &memCell{value: a.value, expires: expires, written: written}
+					}
+				case "+", "-":
+					if t.columns[a.column].Type() != gocql.TypeCounter {
+						mut.update(cells, a, expires, now)
+						continue
+					}
+					var n int64
+					if c := cells[a.column]; c.alive(now) {
+						n = c.value.(int64)
+					}
+					if v, ok := a.value.(int64); ok && a.op == "+" {
+						n += v
+					} else if ok {
+						n -= v
+					}
+					cells[a.column] = &memCell{value: n, written: written}
+				default:
+					mut.update(cells, a, expires, now)
+				}
+			}
+		}
+	}
+}
+
+// update applies an operation on a collection.
+func (mut *mutation) update(cells map[string]*memCell, a boundAssignment, expires, now time.Time) {
+	var current interface{}
+	if c := cells[a.column]; c.alive(now) {
+		current = c.value
+	}
+	if v := updateCollection(mut.table.columns[a.column], current, a); v == nil {
+		delete(cells, a.column)
+	} else {
+		cells[a.column] = &memCell{value: v, expires: expires, written: now.UnixNano() / 1000}
+	}
+}
+
+// validate verifies that the list elements set by index exist.
+func (mut *mutation) validate(now time.Time) error {
+	t := mut.table
+	for _, a := range mut.assignments {
+		if a.op != "[]" || t.columns[a.column].Type() != gocql.TypeList {
+			continue
+		}
+		i := a.key.(int)
+		for _, key := range mut.keys {
+			p := t.partition(key, false)
+			for _, ck := range mut.clustering {
+				var r *memRow
+				if p != nil {
+					r = t.row(p, ck, false)
+				}
+				size := 0
+				if p != nil && (r != nil || t.static[a.column]) {
+					if v := t.value(p, r, a.column, now); v != nil {
+						size = reflect.ValueOf(v).Len()
+					}
+				}
+				if i < 0 || i >= size {
+					return fmt.Errorf("ecqltest: list index %d out of bound, list has size %d", i, size)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// delete removes the rows or the columns in the partition matching the
+// clustering columns relations.
+func (mut *mutation) delete(p *memPartition, now time.Time) {
+	t := mut.table
+	columns := mut.stmt.columns
+	if len(columns) == 0 && len(mut.filters) == 0 {
+		t.removePartition(p)
+		return
+	}
+
+	for _, col := range columns {
+		if t.static[col] {
+			delete(p.static, col)
+		}
+	}
+
+	rows := p.rows[:0]
+	for _, r := range p.rows {
+		if !t.match(p, r, mut.filters, now) {
+			rows = append(rows, r)
+			continue
+		}
+		if len(columns) > 0 {
+			for _, col := range columns {
+				delete(r.cells, col)
+			}
+			rows = append(rows, r)
+		}
+	}
+	p.rows = rows
+}
+
+// result contains the rows returned by a statement.
+type result struct {
+	columns []string
+	types   []gocql.TypeInfo
+	rows    [][]interface{}
+}
+
+// toJSON returns a result with the rows encoded as JSON documents in the
+// column [json], as SELECT JSON statements do.
+func (r *result) toJSON() (*result, error) {
+	res := &result{columns: []string{"[json]"}, types: []gocql.TypeInfo{textType}}
+	for _, row := range r.rows {
+		var buf bytes.Buffer
+		buf.WriteByte('{')
+		for i, v := range row {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			name, _ := json.Marshal(r.columns[i])
+			value, err := json.Marshal(jsonValue(r.types[i], v))
+			if err != nil {
+				return nil, err
+			}
+			buf.Write(name)
+			buf.WriteString(": ")
+			buf.Write(value)
+		}
+		buf.WriteByte('}')
+		res.rows = append(res.rows, []interface{}{buf.String()})
+	}
+	return res, nil
+}
+
+func appliedResult(applied bool) *result {
+	return &result{
+		columns: []string{"[applied]"},
+		types:   []gocql.TypeInfo{booleanType},
+		rows:    [][]interface{}{{applied}},
+	}
+}
+
+func (r *result) applied() bool {
+	return r != nil && len(r.rows) > 0 && r.columns[0] == "[applied]" && r.rows[0][0] == true
+}
+
+// scan sets the values of a row in dest, as gocql the number of columns and
+// destinations must match.
+func (r *result) scan(row []interface{}, dest []interface{}) error {
+	if len(dest) != len(row) {
+		return fmt.Errorf("gocql: not enough columns to scan into: have %d want %d", len(dest), len(row))
+	}
+	for i := range dest {
+		if dest[i] == nil {
+			continue
+		}
+		if err := scanValue(r.types[i], row[i], dest[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mapScan sets the values of a row in m, as gocql the values in m are used
+// as destinations if they are present, and they are replaced by the values.
+func (r *result) mapScan(row []interface{}, m map[string]interface{}) error {
+	for i, col := range r.columns {
+		dest, ok := m[col]
+		if !ok || dest == nil || reflect.ValueOf(dest).Kind() != reflect.Ptr {
+			dest = r.types[i].New()
+		}
+		if err := scanValue(r.types[i], row[i], dest); err != nil {
+			return err
+		}
+		m[col] = reflect.ValueOf(dest).Elem().Interface()
+	}
+	return nil
+}
+
+func index(list []string, s string) int {
+	for i := range list {
+		if list[i] == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// memQuery implements ecql.Query.
+type memQuery struct {
+	memory    *Memory
+	ctx       context.Context
+	stmt      string
+	args      []interface{}
+	pageSize  int
+	pageState []byte
+	paging    bool
+}
+
+func (q *memQuery) Exec() error {
+	_, err := q.memory.execute(q.ctx, q.stmt, q.args)
+	return err
+}
+
+func (q *memQuery) Scan(dest ...interface{}) error {
+	res, err := q.memory.execute(q.ctx, q.stmt, q.args)
+	if err != nil {
+		return err
+	}
+	if res == nil || len(res.rows) == 0 {
+		return ecql.ErrNotFound
+	}
+	return res.scan(res.rows[0], dest)
+}
+
+func (q *memQuery) MapScan(m map[string]interface{}) error {
+	res, err := q.memory.execute(q.ctx, q.stmt, q.args)
+	if err != nil {
+		return err
+	}
+	if res == nil || len(res.rows) == 0 {
+		return ecql.ErrNotFound
+	}
+	return res.mapScan(res.rows[0], m)
+}
+
+func (q *memQuery) ScanCAS(dest ...interface{}) (bool, error) {
+	res, err := q.memory.execute(q.ctx, q.stmt, q.args)
+	if err != nil {
+		return false, err
+	}
+	if res == nil || len(res.rows) == 0 {
+		return false, ecql.ErrNotFound
+	}
+	if len(res.columns) > 1 {
+		return res.applied(), res.scan(res.rows[0], append([]interface{}{nil}, dest...))
+	}
+	return res.applied(), nil
+}
+
+func (q *memQuery) MapScanCAS(dest map[string]interface{}) (bool, error) {
+	res, err := q.memory.execute(q.ctx, q.stmt, q.args)
+	if err != nil {
+		return false, err
+	}
+	if res == nil || len(res.rows) == 0 {
+		return false, ecql.ErrNotFound
+	}
+	err = res.mapScan(res.rows[0], dest)
+	delete(dest, "[applied]")
+	return res.applied(), err
+}
+
+// Iter returns the rows of the query. If a page size is set the paging state
+// is the offset of the next page, and if a paging state is set only one page
+// is returned as gocql does.
+func (q *memQuery) Iter() ecql.Rows {
+	res, err := q.memory.execute(q.ctx, q.stmt, q.args)
+	if err != nil || res == nil || q.pageSize <= 0 {
+		return &memRows{result: res, err: err}
+	}
+
+	offset := 0
+	if len(q.pageState) > 0 {
+		if offset, err = strconv.Atoi(string(q.pageState)); err != nil || offset < 0 || offset > len(res.rows) {
+			return &memRows{err: fmt.Errorf("ecqltest: invalid paging state")}
+		}
+	}
+
+	rows := &memRows{result: res, pos: offset}
+	if next := offset + q.pageSize; next < len(res.rows) {
+		rows.state = []byte(strconv.Itoa(next))
+		if q.paging {
+			res.rows = res.rows[:next]
+		}
+	}
+	return rows
+}
+
+func (q *memQuery) PageSize(n int) ecql.Query {
+	q.pageSize = n
+	return q
+}
+
+func (q *memQuery) PageState(state []byte) ecql.Query {
+	q.pageState = state
+	q.paging = true
+	return q
+}
+
+// Consistency is a no-op, there is only one replica in memory.
+func (q *memQuery) Consistency(c gocql.Consistency) ecql.Query {
+	return q
+}
+
+// SerialConsistency is a no-op, there is only one replica in memory.
+func (q *memQuery) SerialConsistency(c gocql.SerialConsistency) ecql.Query {
+	return q
+}
+
+// Idempotent is a no-op, queries in memory are never retried.
+func (q *memQuery) Idempotent(value bool) ecql.Query {
+	return q
+}
+
+// RetryPolicy is a no-op, queries in memory are never retried.
+func (q *memQuery) RetryPolicy(policy gocql.RetryPolicy) ecql.Query {
+	return q
+}
+
+// memRows implements ecql.Rows.
+type memRows struct {
+	result *result
+	pos    int
+	state  []byte
+	err    error
+}
+
+func (r *memRows) PageState() []byte {
+	return r.state
+}
+
+func (r *memRows) Scan(dest ...interface{}) bool {
+	if r.err != nil || r.result == nil || r.pos >= len(r.result.rows) {
+		return false
+	}
+	r.err = r.result.scan(r.result.rows[r.pos], dest)
+	r.pos++
+	return r.err == nil
+}
+
+func (r *memRows) MapScan(m map[string]interface{}) bool {
+	if r.err != nil || r.result == nil || r.pos >= len(r.result.rows) {
+		return false
+	}
+	r.err = r.result.mapScan(r.result.rows[r.pos], m)
+	r.pos++
+	return r.err == nil
+}
+
+func (r *memRows) Close() error {
+	return r.err
+}
+
+// checkConditionalBatch returns an error if the mutations of a batch with
+// conditions span multiple tables.
+func checkConditionalBatch(mutations []*mutation) error {
+	for _, mut := range mutations {
+		if mut.table != mutations[0].table {
+			return fmt.Errorf("ecqltest: batch with conditions cannot span multiple tables")
+		}
+	}
+	return nil
+}
+
+// batchValues returns the result of a batch with conditions not applied. Like
+// in Cassandra, it has a row for each existing row read by the conditional
+// statements, with the primary key and the columns used in the conditions.
+func batchValues(mutations []*mutation, now time.Time) *result {
+	t := mutations[0].table
+	columns := append(append([]string{}, t.partitionKey...), t.clustering...)
+	for _, mut := range mutations {
+		switch {
+		case mut.stmt.ifNotExists:
+			columns = t.names
+		case len(mut.conditions) > 0 && len(columns) < len(t.names):
+			for _, rel := range mut.conditions {
+				if index(columns, rel.column) < 0 {
+					columns = append(columns, rel.column)
+				}
+			}
+		}
+	}
+
+	// Rows are returned in the order they are stored.
+	type read struct {
+		p *memPartition
+		r *memRow
+	}
+	var reads []read
+	for _, mut := range mutations {
+		if !mut.conditional() {
+			continue
+		}
+		p := t.partition(mut.keys[0], false)
+		if p == nil {
+			continue
+		}
+		if r := t.row(p, mut.clustering[0], false); r != nil && r.alive(now) {
+			reads = append(reads, read{p, r})
+		}
+	}
+	sort.SliceStable(reads, func(i, j int) bool {
+		if c := compareKeys(reads[i].p.key, reads[j].p.key, nil); c != 0 {
+			return c < 0
+		}
+		return compareKeys(reads[i].r.key, reads[j].r.key, t.desc) < 0
+	})
+
+	res := appliedResult(false)
+	if len(reads) == 0 {
+		return res
+	}
+	for _, col := range columns {
+		res.columns = append(res.columns, col)
+		res.types = append(res.types, t.columns[col])
+	}
+	res.rows = nil
+	for i, rd := range reads {
+		if i > 0 && rd.r == reads[i-1].r {
+			continue
+		}
+		row := []interface{}{false}
+		for _, col := range columns {
+			row = append(row, t.value(rd.p, rd.r, col, now))
+		}
+		res.rows = append(res.rows, row)
+	}
+	return res
+}
+
+// checkBatchType returns an error if the mutations cannot be executed in a
+// batch of the given type. Counter mutations are only allowed in COUNTER
+// batches, and they cannot be mixed with other mutations.
+func checkBatchType(typ gocql.BatchType, mutations []*mutation) error {
+	counters := 0
+	for _, mut := range mutations {
+		if mut.table.isCounter() {
+			counters++
+		}
+	}
+	switch {
+	case typ == gocql.CounterBatch && counters != len(mutations):
+		return fmt.Errorf("ecqltest: only counter mutations are allowed in COUNTER batches")
+	case typ == gocql.LoggedBatch && counters > 0:
+		return fmt.Errorf("ecqltest: cannot include a counter statement in a logged batch")
+	case counters > 0 && counters != len(mutations):
+		return fmt.Errorf("ecqltest: counter and non-counter mutations cannot exist in the same batch")
+	}
+	return nil
+}
+
+// memBatch implements ecql.BatchQuery.
+type memBatch struct {
+	memory  *Memory
+	ctx     context.Context
+	typ     gocql.BatchType
+	entries []gocql.BatchEntry
+}
+
+func (b *memBatch) Exec() error {
+	_, _, err := b.memory.executeBatch(b.ctx, b.typ, b.entries)
+	return err
+}
+
+func (b *memBatch) MapExecCAS(dest map[string]interface{}) (bool, ecql.Rows, error) {
+	applied, res, err := b.memory.executeBatch(b.ctx, b.typ, b.entries)
+	if err != nil {
+		return false, nil, err
+	}
+	if res == nil {
+		res = appliedResult(applied)
+	}
+	rows := &memRows{result: res}
+	rows.MapScan(dest)
+	delete(dest, "[applied]")
+	return applied, rows, rows.err
+}
+
+// Consistency is a no-op, there is only one replica in memory.
+func (b *memBatch) Consistency(c gocql.Consistency) ecql.BatchQuery {
+	return b
+}
+
+// SerialConsistency is a no-op, there is only one replica in memory.
+func (b *memBatch) SerialConsistency(c gocql.SerialConsistency) ecql.BatchQuery {
+	return b
+}
+
+// RetryPolicy is a no-op, batches in memory are never retried.
+func (b *memBatch) RetryPolicy(policy gocql.RetryPolicy) ecql.BatchQuery {
+	return b
+}
+
+// WithTimestamp is a no-op, USING TIMESTAMP is ignored in memory.
+func (b *memBatch) WithTimestamp(timestamp int64) ecql.BatchQuery {
+	return b
+}
@@ -0,0 +1,880 @@
+package ecqltest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/maraino/ecql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memUser struct {
+	ID        string            `cql:"id" cqltable:"users" cqlkey:"id"`
+	Following []string          `cql:"following"`
+	Details   map[string]string `cql:"details"`
+	Tags      []string          `cql:"tags" cqltype:"set<text>"`
+}
+
+type memTweet struct {
+	ID       gocql.UUID `cql:"id" cqltable:"tweet" cqlkey:"id"`
+	Timeline string     `cql:"timeline"`
+	Text     string     `cql:"text"`
+	Time     time.Time  `cql:"time"`
+}
+
+type memTimeline struct {
+	ID    string     `cql:"id" cqltable:"timeline" cqlkey:"id,time"`
+	Time  time.Time  `cql:"time,desc"`
+	Tweet gocql.UUID `cql:"tweet"`
+}
+
+type memViews struct {
+	ID      string `cql:"id" cqltable:"views" cqlkey:"id"`
+	Counter int64  `cql:"counter" cqltype:"counter"`
+}
+
+type memDocument struct {
+	ID      string `cql:"id" cqltable:"documents" cqlkey:"id" cqlversion:"version"`
+	Text    string `cql:"text"`
+	Version int    `cql:"version"`
+}
+
+type memAddress struct {
+	Street string `cql:"street" cqltable:"address"`
+	City   string `cql:"city"`
+}
+
+type memPlace struct {
+	ID      string     `cql:"id" cqltable:"places" cqlkey:"id"`
+	Address memAddress `cql:"address"`
+}
+
+func newMemory(t *testing.T) *Memory {
+	m := NewMemory()
+	require.NoError(t, m.CreateType(memAddress{}))
+	require.NoError(t, m.CreateTable(memUser{}, memTweet{}, memTimeline{}, memViews{}, memDocument{}, memPlace{}))
+	for _, stmt := range []string{
+		"INSERT INTO users (id, following, details) VALUES ('ecql', ['foo','bar'], {'handle':'@ecql','url':'https://github.com/maraino/ecql'})",
+		"INSERT INTO tweet (id, timeline, text, time) VALUES (a5450908-17d7-11e6-b9ec-542696d5770f, 'ecql', 'hello world!', '2016-01-01 00:00:00-0000')",
+		"INSERT INTO tweet (id, timeline, text, time) VALUES (619f33d2-1952-11e6-9f53-542696d5770f, 'ecql', 'ciao world!', '2016-01-01 11:11:11-0000')",
+		"INSERT INTO timeline (id, time, tweet) VALUES ('ecql', '2016-01-01 00:00:00-0000', a5450908-17d7-11e6-b9ec-542696d5770f)",
+		"INSERT INTO timeline (id, time, tweet) VALUES ('ecql', '2016-01-01 11:11:11-0000', 619f33d2-1952-11e6-9f53-542696d5770f)",
+	} {
+		require.NoError(t, m.Exec(stmt), stmt)
+	}
+	return m
+}
+
+func TestMemoryGetSetDel(t *testing.T) {
+	s := newMemory(t).Session()
+
+	var u memUser
+	assert.NoError(t, s.Get(&u, "ecql"))
+	assert.Equal(t, memUser{
+		ID:        "ecql",
+		Following: []string{"foo", "bar"},
+		Details:   map[string]string{"handle": "@ecql", "url": "https://github.com/maraino/ecql"},
+	}, u)
+
+	tw := memTweet{ID: gocql.TimeUUID(), Timeline: "ecql", Text: "new tweet", Time: time.Unix(1462800000, 0).UTC()}
+	assert.NoError(t, s.Set(tw))
+
+	var got memTweet
+	assert.NoError(t, s.Get(&got, tw.ID))
+	assert.Equal(t, tw, got)
+
+	ok, err := s.Exists(tw)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	assert.NoError(t, s.Del(tw))
+	assert.Equal(t, ecql.ErrNotFound, s.Get(&got, tw.ID))
+
+	ok, err = s.Exists(tw)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestMemorySelect(t *testing.T) {
+	s := newMemory(t).Session()
+
+	// Clustering order is desc
+	var tl memTimeline
+	var tweets []string
+	iter := s.Select(&tl).Where(ecql.Eq("id", "ecql")).Iter()
+	for iter.TypeScan(&tl) {
+		tweets = append(tweets, tl.Tweet.String())
+	}
+	assert.NoError(t, iter.Close())
+	assert.Equal(t, []string{"619f33d2-1952-11e6-9f53-542696d5770f", "a5450908-17d7-11e6-b9ec-542696d5770f"}, tweets)
+
+	// Order by and limit
+	err := s.Select(&tl).Where(ecql.Eq("id", "ecql")).OrderBy(ecql.Asc("time")).Limit(1).TypeScan()
+	assert.NoError(t, err)
+	assert.Equal(t, "a5450908-17d7-11e6-b9ec-542696d5770f", tl.Tweet.String())
+
+	// Range on clustering columns
+	var count int
+	err = s.Count(&tl).Where(ecql.Eq("id", "ecql"), ecql.Gt("time", time.Date(2016, 1, 1, 1, 0, 0, 0, time.UTC))).Scan(&count)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	// Columns and IN
+	var text string
+	err = s.Select(memTweet{}).Columns("text").Where(ecql.In("id", "619f33d2-1952-11e6-9f53-542696d5770f", "00000000-0000-0000-0000-000000000000")).Scan(&text)
+	assert.NoError(t, err)
+	assert.Equal(t, "ciao world!", text)
+
+	// Filtering
+	var tw memTweet
+	err = s.Select(&tw).Where(ecql.Eq("text", "hello world!")).TypeScan()
+	assert.Error(t, err)
+	err = s.Select(&tw).Where(ecql.Eq("text", "hello world!")).AllowFiltering().TypeScan()
+	assert.NoError(t, err)
+	assert.Equal(t, "a5450908-17d7-11e6-b9ec-542696d5770f", tw.ID.String())
+
+	// Contains
+	var u memUser
+	err = s.Select(&u).Where(ecql.Contains("following", "bar")).TypeScan()
+	assert.NoError(t, err)
+	assert.Equal(t, "ecql", u.ID)
+	err = s.Select(&u).Where(ecql.ContainsKey("details", "email")).TypeScan()
+	assert.Equal(t, ecql.ErrNotFound, err)
+}
+
+func TestMemoryAggregates(t *testing.T) {
+	type score struct {
+		Player string  `cql:"player" cqltable:"scores" cqlkey:"player,game"`
+		Game   int     `cql:"game"`
+		Points int     `cql:"points"`
+		Time   float64 `cql:"time"`
+	}
+
+	m := newMemory(t)
+	require.NoError(t, m.CreateTable(score{}))
+	s := m.Session()
+	for _, sc := range []score{
+		{"alice", 1, 10, 1.5}, {"alice", 2, 30, 2.5}, {"alice", 3, 20, 3.5},
+		{"bob", 1, 5, 1}, {"bob", 2, 15, 2},
+	} {
+		require.NoError(t, s.Set(sc))
+	}
+
+	// Scalars
+	var min, max, sum, avg int
+	var count int64
+	var avgTime float64
+	err := s.Select(score{}).Columns(ecql.Min("points"), ecql.Max("points"), ecql.Sum("points"), ecql.Avg("points"), ecql.CountOf("points"), ecql.Avg("time")).
+		Where(ecql.Eq("player", "alice")).Scan(&min, &max, &sum, &avg, &count, &avgTime)
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{10, 30, 60, 20, int64(3), 2.5}, []interface{}{min, max, sum, avg, count, avgTime})
+
+	// Empty results
+	err = s.Select(score{}).Columns(ecql.CountOf("points"), ecql.Sum("points")).Where(ecql.Eq("player", "carol")).Scan(&count, &sum)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), count)
+	assert.Equal(t, 0, sum)
+
+	// Group by into structs
+	var sc score
+	var totals []score
+	iter := s.Select(score{}).Columns("player", ecql.As(ecql.Sum("points"), "points")).GroupBy("player").Iter()
+	for iter.TypeScan(&sc) {
+		totals = append(totals, sc)
+	}
+	assert.NoError(t, iter.Close())
+	assert.Equal(t, []score{{Player: "alice", Points: 60}, {Player: "bob", Points: 20}}, totals)
+
+	// Distinct and per partition limit
+	var players []string
+	iter = s.Select(score{}).Distinct().Iter()
+	for iter.TypeScan(&sc) {
+		players = append(players, sc.Player)
+	}
+	assert.NoError(t, iter.Close())
+	assert.Equal(t, []string{"alice", "bob"}, players)
+
+	var games []score
+	iter = s.Select(score{}).Columns("player", "game").PerPartitionLimit(1).OrderBy(ecql.Desc("game")).Where(ecql.In("player", "alice", "bob")).Iter()
+	for sc = (score{}); iter.TypeScan(&sc); sc = (score{}) {
+		games = append(games, sc)
+	}
+	assert.NoError(t, iter.Close())
+	assert.Equal(t, []score{{Player: "alice", Game: 3}, {Player: "bob", Game: 2}}, games)
+
+	// Invalid queries
+	assert.Error(t, s.Select(score{}).Columns("player").GroupBy("game").Scan(&sc.Player))
+	assert.Error(t, s.Select(score{}).Columns("points").Distinct().Scan(&sc.Points))
+}
+
+func TestMemoryTupleRelations(t *testing.T) {
+	type memEvent struct {
+		Stream string `cql:"stream" cqltable:"events" cqlkey:"stream,day,seq"`
+		Day    int    `cql:"day"`
+		Seq    int    `cql:"seq"`
+		Text   string `cql:"text"`
+	}
+
+	m := newMemory(t)
+	require.NoError(t, m.CreateTable(memEvent{}))
+	s := m.Session()
+	for day := 1; day <= 3; day++ {
+		for seq := 1; seq <= 3; seq++ {
+			require.NoError(t, s.Insert(memEvent{Stream: "ecql", Day: day, Seq: seq}).Exec())
+		}
+	}
+
+	// Seek pagination
+	var keys [][]int
+	last := memEvent{Stream: "ecql"}
+	for {
+		var page []memEvent
+		iter := s.Select(memEvent{}).Where(ecql.Eq("stream", "ecql"), ecql.TupleGt([]string{"day", "seq"}, last.Day, last.Seq)).Limit(4).Iter()
+		var ev memEvent
+		for iter.TypeScan(&ev) {
+			page = append(page, ev)
+		}
+		require.NoError(t, iter.Close())
+		if len(page) == 0 {
+			break
+		}
+		for _, ev := range page {
+			keys = append(keys, []int{ev.Day, ev.Seq})
+		}
+		last = page[len(page)-1]
+	}
+	assert.Equal(t, [][]int{{1, 1}, {1, 2}, {1, 3}, {2, 1}, {2, 2}, {2, 3}, {3, 1}, {3, 2}, {3, 3}}, keys)
+
+	count := func(cond ecql.Condition) int {
+		var n int
+		require.NoError(t, s.Count(memEvent{}).Where(ecql.Eq("stream", "ecql"), cond).Scan(&n))
+		return n
+	}
+	assert.Equal(t, 5, count(ecql.TupleGe([]string{"day", "seq"}, 2, 2)))
+	assert.Equal(t, 3, count(ecql.TupleLt([]string{"day", "seq"}, 2, 1)))
+	assert.Equal(t, 4, count(ecql.TupleLe([]string{"day", "seq"}, 2, 1)))
+	assert.Equal(t, 1, count(ecql.TupleEq([]string{"day", "seq"}, 2, 1)))
+	assert.Equal(t, 3, count(ecql.TupleGt([]string{"day"}, 2)))
+	assert.Equal(t, 2, count(ecql.TupleIn([]string{"day", "seq"}, []interface{}{1, 3}, []interface{}{3, 1}, []interface{}{4, 1})))
+	assert.Equal(t, 2, count(ecql.And(ecql.TupleGt([]string{"day", "seq"}, 1, 1), ecql.TupleLt([]string{"day", "seq"}, 2, 1))))
+
+	// Invalid relations
+	where := func(cond ecql.Condition) error {
+		var ev memEvent
+		return s.Select(memEvent{}).Where(ecql.Eq("stream", "ecql"), cond).Map(&ev).TypeScan()
+	}
+	for _, cond := range []ecql.Condition{
+		ecql.TupleGt([]string{"stream", "day"}, "ecql", 1),
+		ecql.TupleGt([]string{"seq", "day"}, 1, 1),
+		ecql.TupleGt([]string{"day", "text"}, 1, "text"),
+		ecql.TupleGt([]string{"day", "seq"}, 1, nil),
+		ecql.Raw("(day, seq) > (?)", 1),
+	} {
+		err := where(cond)
+		assert.Error(t, err, cond.CQLFragment)
+		assert.NotEqual(t, ecql.ErrNotFound, err, cond.CQLFragment)
+	}
+	assert.Error(t, s.Delete(memEvent{}).Where(ecql.Eq("stream", "ecql"), ecql.TupleEq([]string{"day", "seq"}, 1, 1)).Exec())
+}
+
+func TestMemoryTemplate(t *testing.T) {
+	s := newMemory(t).Session()
+
+	insert, err := ecql.NewTemplate(s.Insert(memTweet{}).Columns("id", "timeline", "text"))
+	require.NoError(t, err)
+	get, err := ecql.NewTemplate(s.Select(memTweet{}).Where(ecql.Eq("id", nil)))
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id := gocql.TimeUUID()
+			text := fmt.Sprintf("tweet %d", i)
+			assert.NoError(t, insert.Bind(id, "template", text).Exec())
+			var tw memTweet
+			assert.NoError(t, get.Bind(id).Map(&tw).TypeScan())
+			assert.Equal(t, memTweet{ID: id, Timeline: "template", Text: text}, tw)
+		}(i)
+	}
+	wg.Wait()
+
+	var count int
+	assert.NoError(t, s.Count(memTweet{}).Where(ecql.Eq("timeline", "template")).AllowFiltering().Scan(&count))
+	assert.Equal(t, 10, count)
+	assert.Error(t, get.Bind().Map(&memTweet{}).TypeScan())
+}
+
+func TestMemoryPage(t *testing.T) {
+	s := newMemory(t).Session()
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, s.Set(memTimeline{ID: "paging", Time: time.Unix(int64(i), 0).UTC(), Tweet: gocql.TimeUUID()}))
+	}
+
+	var pages [][]time.Time
+	var cursor string
+	for {
+		var rows []*memTimeline
+		next, err := s.Select(memTimeline{}).Where(ecql.Eq("id", "paging")).PageSize(2).Page(&rows, cursor)
+		if !assert.NoError(t, err) {
+			return
+		}
+		var times []time.Time
+		for _, r := range rows {
+			times = append(times, r.Time)
+		}
+		pages = append(pages, times)
+		if cursor = next; cursor == "" {
+			break
+		}
+	}
+	assert.Equal(t, [][]time.Time{
+		{time.Unix(4, 0).UTC(), time.Unix(3, 0).UTC()},
+		{time.Unix(2, 0).UTC(), time.Unix(1, 0).UTC()},
+		{time.Unix(0, 0).UTC()},
+	}, pages)
+
+	// Page does not modify the statement, Iter reads all the pages
+	var rows []memTimeline
+	stmt := s.Select(memTimeline{}).Where(ecql.Eq("id", "paging")).PageSize(2)
+	cursor, err := stmt.Page(&rows, "")
+	assert.NoError(t, err)
+	assert.Len(t, rows, 2)
+	_, err = stmt.Page(&rows, cursor)
+	assert.NoError(t, err)
+	var count int
+	var tl memTimeline
+	iter := stmt.Iter()
+	for iter.TypeScan(&tl) {
+		count++
+	}
+	assert.NoError(t, iter.Close())
+	assert.Equal(t, 5, count)
+
+	_, err = s.Select(memTimeline{}).Page(&rows, "not a cursor!")
+	assert.Equal(t, ecql.ErrInvalidCursor, err)
+}
+
+func TestMemoryInsert(t *testing.T) {
+	m := newMemory(t)
+	s := m.Session()
+
+	tw := memTweet{ID: gocql.TimeUUID(), Text: "first"}
+	assert.NoError(t, s.Insert(tw).IfNotExists().Exec())
+
+	// Insert if not exists does not return an error as gocql
+	tw.Text = "second"
+	assert.NoError(t, s.Insert(tw).IfNotExists().Exec())
+	var got memTweet
+	assert.NoError(t, s.Get(&got, tw.ID))
+	assert.Equal(t, "first", got.Text)
+
+	// TTL
+	now := time.Now()
+	m.Now = func() time.Time { return now }
+	tw = memTweet{ID: gocql.TimeUUID(), Text: "ttl"}
+	assert.NoError(t, s.Insert(tw).TTL(60).Exec())
+	assert.NoError(t, s.Get(&got, tw.ID))
+
+	now = now.Add(time.Minute)
+	assert.Equal(t, ecql.ErrNotFound, s.Get(&got, tw.ID))
+}
+
+func TestMemorySelectors(t *testing.T) {
+	type tweetMeta struct {
+		ID      gocql.UUID `cql:"id" cqltable:"tweet" cqlkey:"id"`
+		Text    string     `cql:"text"`
+		Written int64      `cql:",writetime=text"`
+		TTL     *int       `cql:",ttl=text"`
+	}
+
+	m := newMemory(t)
+	s := m.Session()
+	now := time.Now()
+	m.Now = func() time.Time { return now }
+
+	tw := memTweet{ID: gocql.TimeUUID(), Text: "meta"}
+	assert.NoError(t, s.Insert(tw).TTL(60).Exec())
+	now = now.Add(10 * time.Second)
+
+	var meta tweetMeta
+	assert.NoError(t, s.Get(&meta, tw.ID))
+	assert.Equal(t, "meta", meta.Text)
+	assert.Equal(t, now.Add(-10*time.Second).UnixNano()/1000, meta.Written)
+	if assert.NotNil(t, meta.TTL) {
+		assert.Equal(t, 50, *meta.TTL)
+	}
+
+	var ttl int
+	var written int64
+	err := s.Select(tw).Columns(ecql.As(ecql.TTLOf("text"), "ttl"), ecql.WriteTime("text")).Where(ecql.EqInt(tw)).Scan(&ttl, &written)
+	assert.NoError(t, err)
+	assert.Equal(t, 50, ttl)
+	assert.Equal(t, meta.Written, written)
+
+	// Columns without TTL
+	assert.NoError(t, s.Update(tw).Set("text", "updated").Exec())
+	assert.NoError(t, s.Get(&meta, tw.ID))
+	assert.Equal(t, now.UnixNano()/1000, meta.Written)
+	assert.Nil(t, meta.TTL)
+
+	// Invalid selectors
+	assert.Error(t, s.Select(tw).Columns(ecql.WriteTime("id")).Where(ecql.EqInt(tw)).Scan(&written))
+	assert.Error(t, s.Select(tw).Columns(ecql.Token("id")).Where(ecql.EqInt(tw)).Scan(&written))
+}
+
+func TestMemoryJSON(t *testing.T) {
+	s := newMemory(t).Session()
+
+	// SELECT JSON
+	var doc json.RawMessage
+	tw := memTweet{ID: ecql.MustUUID("a5450908-17d7-11e6-b9ec-542696d5770f")}
+	assert.NoError(t, s.Select(tw).JSON().Where(ecql.EqInt(tw)).Scan(&doc))
+	assert.JSONEq(t, `{"id": "a5450908-17d7-11e6-b9ec-542696d5770f", "timeline": "ecql", "text": "hello world!", "time": "2016-01-01 00:00:00.000Z"}`, string(doc))
+
+	var docs []string
+	iter := s.Select(memUser{}).JSON().Columns("id", "following", "details").Iter()
+	for iter.Scan(&doc) {
+		docs = append(docs, string(doc))
+	}
+	assert.NoError(t, iter.Close())
+	if assert.Len(t, docs, 1) {
+		assert.Equal(t, `{"id": "ecql", "following": ["foo","bar"], "details": {"handle":"@ecql","url":"https://github.com/maraino/ecql"}}`, docs[0])
+	}
+
+	// INSERT JSON
+	now := time.Unix(1462800000, 123000000).UTC()
+	tw = memTweet{ID: gocql.TimeUUID(), Timeline: "json", Text: "json tweet", Time: now}
+	assert.NoError(t, s.Insert(tw).JSON().Exec())
+	var got memTweet
+	assert.NoError(t, s.Get(&got, tw.ID))
+	assert.Equal(t, tw, got)
+
+	// Columns not in the document are not changed
+	tw.Text = "updated"
+	tw.Timeline = "ignored"
+	assert.NoError(t, s.Insert(tw).Columns("id", "text").JSON().Exec())
+	assert.NoError(t, s.Get(&got, tw.ID))
+	assert.Equal(t, "updated", got.Text)
+	assert.Equal(t, "json", got.Timeline)
+
+	// Raw documents
+	raw := json.RawMessage(`{"id": "raw", "following": ["ecql"], "tags": ["a", "b"]}`)
+	assert.NoError(t, s.Insert(memUser{}).BindJSON(raw).Exec())
+	var user memUser
+	assert.NoError(t, s.Get(&user, "raw"))
+	assert.Equal(t, memUser{ID: "raw", Following: []string{"ecql"}, Tags: []string{"a", "b"}}, user)
+
+	// Unknown columns
+	raw = json.RawMessage(`{"id": "raw", "unknown": 1}`)
+	assert.Error(t, s.Insert(memUser{}).BindJSON(raw).Exec())
+}
+
+func TestMemoryOmitEmpty(t *testing.T) {
+	type partialTweet struct {
+		ID       gocql.UUID `cql:"id" cqltable:"tweet" cqlkey:"id"`
+		Timeline string     `cql:"timeline,omitempty"`
+		Text     string     `cql:"text,omitempty"`
+		Time     time.Time  `cql:"time,omitempty"`
+	}
+
+	m := newMemory(t)
+	s := m.Session()
+	now := time.Unix(1462800000, 0).UTC()
+	tw := memTweet{ID: gocql.TimeUUID(), Timeline: "ecql", Text: "omitempty", Time: now}
+	require.NoError(t, s.Set(tw))
+
+	// Tags
+	var got memTweet
+	assert.NoError(t, s.Set(partialTweet{ID: tw.ID, Text: "set"}))
+	assert.NoError(t, s.Get(&got, tw.ID))
+	assert.Equal(t, memTweet{ID: tw.ID, Timeline: "ecql", Text: "set", Time: now}, got)
+
+	assert.NoError(t, s.Insert(partialTweet{ID: tw.ID, Timeline: "insert"}).Exec())
+	assert.NoError(t, s.Update(partialTweet{ID: tw.ID, Text: "update"}).Columns("timeline", "text", "time").Exec())
+	assert.NoError(t, s.Get(&got, tw.ID))
+	assert.Equal(t, memTweet{ID: tw.ID, Timeline: "insert", Text: "update", Time: now}, got)
+
+	// Statement mode
+	assert.NoError(t, s.Insert(memTweet{ID: tw.ID, Text: "mode"}).OmitEmpty().Exec())
+	assert.NoError(t, s.Update(memTweet{ID: tw.ID, Timeline: "mode"}).Columns("timeline", "time").OmitEmpty().Exec())
+	assert.NoError(t, s.Get(&got, tw.ID))
+	assert.Equal(t, memTweet{ID: tw.ID, Timeline: "mode", Text: "mode", Time: now}, got)
+
+	// Without omitempty values are set to null
+	assert.NoError(t, s.Insert(memTweet{ID: tw.ID, Text: "null"}).Exec())
+	assert.NoError(t, s.Get(&got, tw.ID))
+	assert.Equal(t, memTweet{ID: tw.ID, Text: "null"}, got)
+
+	// Unset values are not valid on keys
+	assert.Error(t, m.Exec("INSERT INTO tweet (id, text) VALUES (?, ?)", gocql.UnsetValue, "text"))
+	assert.Error(t, m.Exec("SELECT * FROM tweet WHERE id = ?", gocql.UnsetValue))
+}
+
+func TestMemoryUpdate(t *testing.T) {
+	s := newMemory(t).Session()
+
+	tw := memTweet{ID: ecql.MustUUID("a5450908-17d7-11e6-b9ec-542696d5770f")}
+	err := s.Update(tw).Set("text", "foobar tweet").If(ecql.Eq("text", "bad text")).Exec()
+	if assert.IsType(t, &ecql.NotAppliedError{}, err) {
+		assert.Equal(t, "hello world!", err.(*ecql.NotAppliedError).Values["text"])
+	}
+
+	err = s.Update(tw).Set("text", "foobar tweet").If(ecql.Eq("text", "hello world!")).Exec()
+	assert.NoError(t, err)
+	assert.NoError(t, s.Get(&tw, tw.ID))
+	assert.Equal(t, "foobar tweet", tw.Text)
+
+	// If exists
+	err = s.Update(memTweet{ID: gocql.TimeUUID()}).Set("text", "foobar tweet").IfExists().Exec()
+	assert.Equal(t, ecql.ErrNotFound, err)
+	err = s.Delete(memTweet{ID: gocql.TimeUUID()}).IfExists().Exec()
+	assert.Equal(t, ecql.ErrNotFound, err)
+	err = s.Delete(tw).IfExists().Exec()
+	assert.NoError(t, err)
+	assert.Equal(t, ecql.ErrNotFound, s.Get(&tw, tw.ID))
+
+	// Counters
+	v := memViews{ID: "ecql"}
+	assert.NoError(t, s.Update(v).Set("counter", ecql.Inc(5)).Exec())
+	assert.NoError(t, s.Update(v).Set("counter", ecql.Dec(2)).Exec())
+	assert.NoError(t, s.Get(&v, "ecql"))
+	assert.Equal(t, int64(3), v.Counter)
+}
+
+func TestMemoryCollections(t *testing.T) {
+	s := newMemory(t).Session()
+
+	u := memUser{ID: "ecql"}
+	for _, value := range []interface{}{
+		ecql.Append([]string{"zar"}),
+		ecql.Prepend([]string{"zoo", "bar"}),
+		ecql.Index(1, "fox"),
+		ecql.Remove([]string{"bar"}),
+	} {
+		assert.NoError(t, s.Update(u).Set("following", value).Exec())
+	}
+	for _, value := range []interface{}{
+		ecql.Put(map[string]string{"name": "ecql"}),
+		ecql.Key("handle", "@maraino"),
+		ecql.RemoveKeys([]string{"url"}),
+	} {
+		assert.NoError(t, s.Update(u).Set("details", value).Exec())
+	}
+	for _, value := range []interface{}{
+		ecql.Add([]string{"go", "cassandra"}),
+		ecql.Add([]string{"cql", "go"}),
+		ecql.Remove([]string{"cql"}),
+	} {
+		assert.NoError(t, s.Update(u).Set("tags", value).Exec())
+	}
+
+	assert.NoError(t, s.Get(&u, "ecql"))
+	assert.Equal(t, []string{"zoo", "fox", "foo", "zar"}, u.Following)
+	assert.Equal(t, map[string]string{"handle": "@maraino", "name": "ecql"}, u.Details)
+	assert.Equal(t, []string{"cassandra", "go"}, u.Tags)
+
+	// Remove all the elements
+	assert.NoError(t, s.Update(u).Set("tags", ecql.Remove([]string{"cassandra", "go"})).Exec())
+	assert.NoError(t, s.Update(u).Set("details", ecql.Key("handle", nil)).Exec())
+	assert.NoError(t, s.Get(&u, "ecql"))
+	assert.Nil(t, u.Tags)
+	assert.Equal(t, map[string]string{"name": "ecql"}, u.Details)
+
+	// Invalid operations
+	assert.Error(t, s.Update(u).Set("following", ecql.Index(4, "fox")).Exec())
+	assert.Error(t, s.Update(memUser{ID: "missing"}).Set("following", ecql.Index(0, "fox")).Exec())
+	assert.Error(t, s.Update(u).Set("tags", ecql.Prepend([]string{"go"})).Exec())
+	assert.Error(t, s.Update(u).Set("id", ecql.Key("go", "go")).Exec())
+}
+
+func TestMemoryVersion(t *testing.T) {
+	s := newMemory(t).Session()
+
+	doc := memDocument{ID: "doc", Text: "first"}
+	assert.NoError(t, s.Set(&doc))
+	assert.Equal(t, 1, doc.Version)
+
+	stale := memDocument{ID: doc.ID, Text: "stale"}
+	assert.Equal(t, ecql.ErrConcurrentModification, s.Set(&stale))
+
+	assert.NoError(t, s.Update(&doc).Set("text", "second").Exec())
+	assert.Equal(t, 2, doc.Version)
+
+	stale.Version = 1
+	assert.Equal(t, ecql.ErrConcurrentModification, s.Update(&stale).Set("text", "stale").Exec())
+
+	var d memDocument
+	assert.NoError(t, s.Get(&d, doc.ID))
+	assert.Equal(t, memDocument{ID: doc.ID, Text: "second", Version: 2}, d)
+}
+
+func TestMemoryTrack(t *testing.T) {
+	s := newMemory(t).Session()
+
+	var tw memTweet
+	require.NoError(t, s.Get(&tw, ecql.MustUUID("a5450908-17d7-11e6-b9ec-542696d5770f")))
+	tracker, err := ecql.Track(&tw)
+	require.NoError(t, err)
+	assert.NoError(t, tracker.Save(s))
+
+	// Only the modified columns are written
+	tw.Text = "tracked"
+	assert.Equal(t, []string{"text"}, tracker.Changes())
+	assert.NoError(t, s.Update(memTweet{ID: tw.ID, Timeline: "concurrent"}).Columns("timeline").Exec())
+	assert.NoError(t, tracker.Save(s))
+	assert.Empty(t, tracker.Changes())
+
+	var got memTweet
+	assert.NoError(t, s.Get(&got, tw.ID))
+	assert.Equal(t, "tracked", got.Text)
+	assert.Equal(t, "concurrent", got.Timeline)
+
+	// Cleared omitempty fields are written
+	type partialTweet struct {
+		ID   gocql.UUID `cql:"id" cqltable:"tweet" cqlkey:"id"`
+		Text string     `cql:"text,omitempty"`
+	}
+	ptw := partialTweet{ID: tw.ID, Text: "tracked"}
+	tracker, err = ecql.Track(&ptw)
+	require.NoError(t, err)
+	ptw.Text = ""
+	assert.NoError(t, tracker.Save(s))
+	assert.NoError(t, s.Get(&got, tw.ID))
+	assert.Equal(t, "", got.Text)
+
+	// Keys cannot be modified
+	ptw.ID = gocql.TimeUUID()
+	assert.True(t, errors.Is(tracker.Save(s), ecql.ErrKeyModified))
+
+	// Versioned types
+	doc := memDocument{ID: "doc", Text: "first"}
+	require.NoError(t, s.Set(&doc))
+	tracker, err = ecql.Track(&doc)
+	require.NoError(t, err)
+	doc.Text = "second"
+	assert.NoError(t, tracker.Save(s))
+	assert.Equal(t, 2, doc.Version)
+	assert.Empty(t, tracker.Changes())
+
+	stale := memDocument{ID: "doc", Text: "first", Version: 1}
+	tracker, err = ecql.Track(&stale)
+	require.NoError(t, err)
+	stale.Text = "stale"
+	assert.Equal(t, ecql.ErrConcurrentModification, tracker.Save(s))
+	assert.Equal(t, []string{"text"}, tracker.Changes())
+}
+
+func TestMemoryBatch(t *testing.T) {
+	s := newMemory(t).Session()
+
+	tw1 := memTweet{ID: gocql.TimeUUID(), Text: "tweet 1"}
+	tw2 := memTweet{ID: gocql.TimeUUID(), Text: "tweet 2"}
+	err := s.Batch().Add(s.Insert(tw1), s.Insert(tw2), s.Delete(memTweet{ID: ecql.MustUUID("a5450908-17d7-11e6-b9ec-542696d5770f")})).Apply()
+	assert.NoError(t, err)
+
+	var count int
+	assert.NoError(t, s.Count(memTweet{}).Scan(&count))
+	assert.Equal(t, 3, count)
+
+	// The batch is not applied if a condition fails
+	applied, err := s.Batch().Add(
+		s.Update(tw1).Set("text", "updated").If(ecql.Eq("text", "tweet 1")),
+		s.Update(tw2).Set("text", "updated").If(ecql.Eq("text", "bad text")),
+	).ApplyCAS()
+	assert.NoError(t, err)
+	assert.False(t, applied)
+	assert.NoError(t, s.Get(&tw1, tw1.ID))
+	assert.Equal(t, "tweet 1", tw1.Text)
+
+	applied, err = s.Batch().Add(s.Update(tw1).Set("text", "updated").If(ecql.Eq("text", "tweet 1"))).ApplyCAS()
+	assert.NoError(t, err)
+	assert.True(t, applied)
+	assert.NoError(t, s.Get(&tw1, tw1.ID))
+	assert.Equal(t, "updated", tw1.Text)
+}
+
+func TestMemoryBatchCAS(t *testing.T) {
+	s := newMemory(t).Session()
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	tl1 := memTimeline{ID: "ecql", Time: now, Tweet: gocql.TimeUUID()}
+	tl2 := memTimeline{ID: "ecql", Time: now.Add(time.Second), Tweet: gocql.TimeUUID()}
+	assert.NoError(t, s.Set(tl1))
+	assert.NoError(t, s.Set(tl2))
+
+	// Applied batches do not return rows
+	applied, rows, err := s.Batch().Add(s.Update(tl1).Set("tweet", tl1.Tweet).If(ecql.Eq("tweet", tl1.Tweet))).MapApplyCAS()
+	assert.NoError(t, err)
+	assert.True(t, applied)
+	assert.Empty(t, rows)
+
+	// The current values of the rows are returned in clustering order
+	other := gocql.TimeUUID()
+	batch := s.Batch().Add(
+		s.Update(tl1).Set("tweet", other).If(ecql.Eq("tweet", other)),
+		s.Update(tl2).Set("tweet", other).If(ecql.Eq("tweet", tl2.Tweet)),
+		s.Update(tl2).Set("tweet", other).If(ecql.Eq("tweet", tl2.Tweet)),
+	)
+	applied, rows, err = batch.MapApplyCAS()
+	assert.NoError(t, err)
+	assert.False(t, applied)
+	assert.Equal(t, []map[string]interface{}{
+		{"id": "ecql", "time": tl2.Time, "tweet": tl2.Tweet},
+		{"id": "ecql", "time": tl1.Time, "tweet": tl1.Tweet},
+	}, rows)
+
+	var timelines []memTimeline
+	applied, err = batch.TypeApplyCAS(&timelines)
+	assert.NoError(t, err)
+	assert.False(t, applied)
+	assert.Equal(t, []memTimeline{tl2, tl1}, timelines)
+
+	// Only the primary key and the columns in the conditions are returned
+	tw := memTweet{ID: gocql.TimeUUID(), Timeline: "ecql", Text: "tweet", Time: now}
+	assert.NoError(t, s.Set(tw))
+	var tweets []*memTweet
+	applied, err = s.Batch().Add(s.Update(tw).Set("timeline", "other").If(ecql.Eq("text", "other"))).TypeApplyCAS(&tweets)
+	assert.NoError(t, err)
+	assert.False(t, applied)
+	assert.Equal(t, []*memTweet{{ID: tw.ID, Text: "tweet"}}, tweets)
+
+	tweets = nil
+	applied, err = s.Batch().Add(s.Insert(tw).IfNotExists()).TypeApplyCAS(&tweets)
+	assert.NoError(t, err)
+	assert.False(t, applied)
+	assert.Equal(t, []*memTweet{&tw}, tweets)
+
+	// Rows that do not exist are not returned
+	missing := memTweet{ID: gocql.TimeUUID()}
+	applied, rows, err = s.Batch().Add(s.Update(missing).Set("text", "text").If(ecql.Eq("text", "other"))).MapApplyCAS()
+	assert.NoError(t, err)
+	assert.False(t, applied)
+	assert.Empty(t, rows)
+
+	// Conditional batches cannot span multiple tables
+	_, _, err = s.Batch().Add(s.Insert(tw).IfNotExists(), s.Insert(tl1)).MapApplyCAS()
+	assert.Error(t, err)
+}
+
+func TestMemoryBatchTypes(t *testing.T) {
+	s := newMemory(t).Session()
+
+	tw := memTweet{ID: gocql.TimeUUID(), Text: "tweet"}
+	v1, v2 := memViews{ID: "one"}, memViews{ID: "two"}
+	inc := func(v memViews, n int64) ecql.Statement {
+		return s.Update(v).Set("counter", ecql.Inc(n))
+	}
+
+	// Counter updates only in COUNTER batches
+	b := s.CounterBatch().Add(inc(v1, 2), inc(v2, 3), inc(v1, 1)).Timestamp(1462800000000000)
+	assert.Equal(t, 3, b.Size())
+	assert.NoError(t, b.Apply())
+	assert.NoError(t, s.Get(&v1, "one"))
+	assert.Equal(t, int64(3), v1.Counter)
+	assert.NoError(t, s.Get(&v2, "two"))
+	assert.Equal(t, int64(3), v2.Counter)
+
+	assert.Error(t, s.Batch().Add(inc(v1, 1)).Apply())
+	assert.Error(t, s.UnloggedBatch().Add(s.Insert(tw), inc(v1, 1)).Apply())
+	assert.Error(t, s.CounterBatch().Add(s.Insert(tw), inc(v1, 1)).Apply())
+	assert.NoError(t, s.Get(&v1, "one"))
+	assert.Equal(t, int64(3), v1.Counter)
+
+	// Unlogged batches
+	assert.NoError(t, s.UnloggedBatch().Add(s.Insert(tw)).Apply())
+	assert.NoError(t, s.UnloggedBatch().Add(inc(v1, 1)).Apply())
+	var got memTweet
+	assert.NoError(t, s.Get(&got, tw.ID))
+	assert.Equal(t, tw, got)
+	assert.NoError(t, s.Get(&v1, "one"))
+	assert.Equal(t, int64(4), v1.Counter)
+}
+
+func TestMemoryBatchWriter(t *testing.T) {
+	s := newMemory(t).Session()
+
+	w := ecql.NewBatchWriter(s).MaxStatements(10).Concurrency(3)
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 100; i++ {
+		tl := memTimeline{ID: fmt.Sprintf("user%d", i%3), Time: start.Add(time.Duration(i) * time.Second), Tweet: gocql.TimeUUID()}
+		assert.NoError(t, w.Write(s.Insert(tl)))
+		assert.NoError(t, w.Write(s.Update(memViews{ID: tl.ID}).Set("counter", ecql.Inc(1))))
+	}
+
+	// Statements on the same partition are applied in order
+	tl := memTimeline{ID: "user0", Time: start}
+	assert.NoError(t, w.Write(s.Delete(tl), s.Insert(tl)))
+
+	missing := s.Update(memTweet{ID: gocql.TimeUUID()}).Set("text", "text").IfExists()
+	assert.NoError(t, w.Write(missing))
+	err := w.Close()
+	if errs, ok := err.(ecql.WriteErrors); assert.True(t, ok) && assert.Len(t, errs, 1) {
+		assert.Equal(t, missing, errs[0].Statement)
+		assert.Equal(t, ecql.ErrNotFound, errs[0].Err)
+	}
+
+	for i, n := range []int64{34, 33, 33} {
+		id := fmt.Sprintf("user%d", i)
+		var count int
+		assert.NoError(t, s.Count(memTimeline{}).Where(ecql.Eq("id", id)).Scan(&count))
+		assert.Equal(t, int(n), count)
+		var v memViews
+		assert.NoError(t, s.Get(&v, id))
+		assert.Equal(t, n, v.Counter)
+	}
+}
+
+func TestMemoryUserDefinedTypes(t *testing.T) {
+	s := newMemory(t).Session()
+
+	p := memPlace{ID: "home", Address: memAddress{Street: "Main St", City: "Springfield"}}
+	assert.NoError(t, s.Set(p))
+
+	var got memPlace
+	assert.NoError(t, s.Get(&got, "home"))
+	assert.Equal(t, p, got)
+}
+
+func TestMemoryContext(t *testing.T) {
+	s := newMemory(t).Session()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var u memUser
+	assert.Equal(t, context.Canceled, s.GetContext(ctx, &u, "ecql"))
+	iter := s.Select(&u).IterContext(ctx)
+	assert.False(t, iter.TypeScan(&u))
+	assert.Equal(t, context.Canceled, iter.Close())
+}
+
+func TestMemoryErrors(t *testing.T) {
+	m := newMemory(t)
+
+	assert.Error(t, m.Exec("SELECT * FROM unknown"))
+	assert.Error(t, m.Exec("SELECT unknown FROM tweet"))
+	assert.Error(t, m.Exec("SELECT * FROM tweet WHERE id = ?"))
+	assert.Error(t, m.Exec("INSERT INTO tweet (text) VALUES ('no key')"))
+	assert.Error(t, m.Exec("CREATE TABLE tweet (id uuid PRIMARY KEY)"))
+	assert.NoError(t, m.Exec("CREATE TABLE IF NOT EXISTS tweet (id uuid PRIMARY KEY)"))
+	assert.NoError(t, m.Exec("TRUNCATE tweet"))
+
+	// Clustering order must list all the clustering columns in order
+	assert.Error(t, m.Exec("CREATE TABLE c1 (id int, a int, b int, PRIMARY KEY (id, a, b)) WITH CLUSTERING ORDER BY (b DESC)"))
+	assert.Error(t, m.Exec("CREATE TABLE c2 (id int, a int, b int, PRIMARY KEY (id, a, b)) WITH CLUSTERING ORDER BY (b DESC, a ASC)"))
+	assert.Error(t, m.Exec("CREATE TABLE c3 (id int, a int, b int, PRIMARY KEY (id, a, b)) WITH CLUSTERING ORDER BY (id DESC)"))
+	assert.NoError(t, m.Exec("CREATE TABLE c4 (id int, a int, b int, PRIMARY KEY (id, a, b)) WITH CLUSTERING ORDER BY (a ASC, b DESC)"))
+
+	var count int
+	assert.NoError(t, m.Session().Count(memTweet{}).Scan(&count))
+	assert.Equal(t, 0, count)
+}
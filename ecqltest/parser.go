@@ -0,0 +1,998 @@
+package ecqltest
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type tokenType int
+
+const (
+	identToken tokenType = iota
+	quotedToken
+	stringToken
+	numberToken
+	uuidToken
+	bindToken
+	symbolToken
+	eofToken
+)
+
+type token struct {
+	typ  tokenType
+	text string
+}
+
+var uuidRegexp = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`)
+
+// tokenize splits a CQL statement in tokens. Unquoted identifiers and
+// keywords are returned in lowercase.
+func tokenize(cql string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(cql); {
+		c := cql[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ';':
+			i++
+		case isHex(c) && uuidRegexp.MatchString(cql[i:]):
+			tokens = append(tokens, token{uuidToken, cql[i : i+36]})
+			i += 36
+		case c == '\'' || c == '"':
+			var s []byte
+			j := i + 1
+			for ; j < len(cql); j++ {
+				if cql[j] == c {
+					if j+1 < len(cql) && cql[j+1] == c {
+						s = append(s, c)
+						j++
+						continue
+					}
+					break
+				}
+				s = append(s, cql[j])
+			}
+			if j == len(cql) {
+				return nil, fmt.Errorf("ecqltest: unterminated string in %q", cql)
+			}
+			typ := stringToken
+			if c == '"' {
+				typ = quotedToken
+			}
+			tokens = append(tokens, token{typ, string(s)})
+			i = j + 1
+		case isDigit(c) || (c == '-' && i+1 < len(cql) && isDigit(cql[i+1]) && !afterValue(tokens)):
+			j := i + 1
+			for j < len(cql) && (isDigit(cql[j]) || cql[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, token{numberToken, cql[i:j]})
+			i = j
+		case isLetter(c):
+			j := i + 1
+			for j < len(cql) && (isLetter(cql[j]) || isDigit(cql[j]) || cql[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, token{identToken, strings.ToLower(cql[i:j])})
+			i = j
+		case c == '?':
+			tokens = append(tokens, token{bindToken, "?"})
+			i++
+		case (c == '<' || c == '>' || c == '!') && i+1 < len(cql) && cql[i+1] == '=':
+			tokens = append(tokens, token{symbolToken, cql[i : i+2]})
+			i += 2
+		case strings.IndexByte("(),=<>+-[]{}:*", c) >= 0:
+			tokens = append(tokens, token{symbolToken, cql[i : i+1]})
+			i++
+		default:
+			return nil, fmt.Errorf("ecqltest: unexpected character %q in %q", c, cql)
+		}
+	}
+	return append(tokens, token{eofToken, ""}), nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isHex(c byte) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_'
+}
+
+// afterValue returns true if the last token is a value, in that case a '-'
+// is an operator and not the sign of a number.
+func afterValue(tokens []token) bool {
+	if len(tokens) == 0 {
+		return false
+	}
+	last := tokens[len(tokens)-1]
+	return last.typ != symbolToken || last.text == ")" || last.text == "]" || last.text == "}"
+}
+
+type statementType int
+
+const (
+	selectStatement statementType = iota
+	insertStatement
+	updateStatement
+	deleteStatement
+	createTableStatement
+	createTypeStatement
+	truncateStatement
+	dropTableStatement
+)
+
+// statement is a parsed CQL statement.
+type statement struct {
+	typ               statementType
+	table             string
+	columns           []string
+	selectors         []selector
+	distinct          bool
+	json              bool
+	defaultUnset      bool
+	values            []term
+	assignments       []assignment
+	where             []relation
+	groupBy           []string
+	orders            []ordering
+	limit             *term
+	perPartitionLimit *term
+	ttl               *term
+	allowFiltering    bool
+	ifExists          bool
+	ifNotExists       bool
+	conditions        []relation
+	definitions       []definition
+	partitionKey      []string
+	clustering        []string
+	binds             int
+}
+
+// term is a bind marker, a literal value or a collection literal. The keys
+// are only set for map literals.
+type term struct {
+	bind       int
+	literal    interface{}
+	number     bool
+	collection bool
+	elems      []term
+	keys       []term
+}
+
+// relation is a condition in a WHERE or IF clause. Multi-column relations
+// like (a, b) > (?, ?) have the names of the columns in tuple and one tuple
+// of terms per value in tuples.
+type relation struct {
+	column string
+	op     string
+	terms  []term
+	tuple  []string
+	tuples [][]term
+}
+
+// selector is a column or a function of a column in a SELECT statement.
+type selector struct {
+	fn     string
+	column string
+	alias  string
+}
+
+// name returns the name of the selector in the results.
+func (s selector) name() string {
+	switch {
+	case s.alias != "":
+		return s.alias
+	case s.column == "*":
+		return s.fn
+	case s.fn != "":
+		return fmt.Sprintf("%s(%s)", s.fn, s.column)
+	default:
+		return s.column
+	}
+}
+
+type assignment struct {
+	column string
+	key    *term
+	op     string
+	term   term
+}
+
+type ordering struct {
+	column string
+	desc   bool
+}
+
+// definition is a column in a CREATE TABLE or a field in a CREATE TYPE.
+type definition struct {
+	name   string
+	typ    cqlType
+	static bool
+}
+
+// cqlType is a parsed CQL type like map<text, frozen<list<int>>>.
+type cqlType struct {
+	name   string
+	params []cqlType
+}
+
+func (t cqlType) String() string {
+	if len(t.params) == 0 {
+		return t.name
+	}
+	params := make([]string, len(t.params))
+	for i := range t.params {
+		params[i] = t.params[i].String()
+	}
+	return fmt.Sprintf("%s<%s>", t.name, strings.Join(params, ", "))
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+	binds  int
+}
+
+// parse parses the CQL statements supported by Memory.
+func parse(cql string) (*statement, error) {
+	tokens, err := tokenize(cql)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	var stmt *statement
+	switch {
+	case p.accept("select"):
+		stmt, err = p.parseSelect()
+	case p.accept("insert", "into"):
+		stmt, err = p.parseInsert()
+	case p.accept("update"):
+		stmt, err = p.parseUpdate()
+	case p.accept("delete"):
+		stmt, err = p.parseDelete()
+	case p.accept("create", "table"):
+		stmt, err = p.parseCreateTable()
+	case p.accept("create", "type"):
+		stmt, err = p.parseCreateType()
+	case p.accept("truncate"):
+		p.accept("table")
+		stmt = &statement{typ: truncateStatement}
+		stmt.table, err = p.tableName()
+	case p.accept("drop", "table"):
+		stmt = &statement{typ: dropTableStatement}
+		stmt.ifExists = p.accept("if", "exists")
+		stmt.table, err = p.tableName()
+	default:
+		err = p.errorf("unsupported statement")
+	}
+
+	if err == nil && p.peek().typ != eofToken {
+		err = p.errorf("unexpected input")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s in %q", err.Error(), cql)
+	}
+
+	stmt.binds = p.binds
+	return stmt, nil
+}
+
+func (p *parser) parseSelect() (*statement, error) {
+	stmt := &statement{typ: selectStatement}
+	stmt.json = p.accept("json")
+	stmt.distinct = p.accept("distinct")
+	if !p.acceptSymbol("*") {
+		selectors, err := p.selectors()
+		if err != nil {
+			return nil, err
+		}
+		stmt.selectors = selectors
+	}
+
+	var err error
+	if err = p.expect("from"); err != nil {
+		return nil, err
+	}
+	if stmt.table, err = p.tableName(); err != nil {
+		return nil, err
+	}
+	if p.accept("where") {
+		if stmt.where, err = p.relations(); err != nil {
+			return nil, err
+		}
+	}
+	if p.accept("group", "by") {
+		if stmt.groupBy, err = p.identifiers(); err != nil {
+			return nil, err
+		}
+	}
+	if p.accept("order", "by") {
+		for {
+			var o ordering
+			if o.column, err = p.identifier(); err != nil {
+				return nil, err
+			}
+			if p.accept("desc") {
+				o.desc = true
+			} else {
+				p.accept("asc")
+			}
+			stmt.orders = append(stmt.orders, o)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+	if p.accept("per", "partition", "limit") {
+		t, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		stmt.perPartitionLimit = &t
+	}
+	if p.accept("limit") {
+		t, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		stmt.limit = &t
+	}
+	stmt.allowFiltering = p.accept("allow", "filtering")
+	return stmt, nil
+}
+
+func (p *parser) parseInsert() (*statement, error) {
+	var err error
+	stmt := &statement{typ: insertStatement}
+	if stmt.table, err = p.tableName(); err != nil {
+		return nil, err
+	}
+	if p.accept("json") {
+		// INSERT JSON ? [DEFAULT UNSET | DEFAULT NULL]
+		doc, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		stmt.json = true
+		stmt.values = []term{doc}
+		if p.accept("default", "unset") {
+			stmt.defaultUnset = true
+		} else {
+			p.accept("default", "null")
+		}
+	} else {
+		if err = p.expectSymbol("("); err != nil {
+			return nil, err
+		}
+		if stmt.columns, err = p.identifiers(); err != nil {
+			return nil, err
+		}
+		if err = p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+		if err = p.expect("values"); err != nil {
+			return nil, err
+		}
+		if stmt.values, err = p.terms(); err != nil {
+			return nil, err
+		}
+	}
+	for {
+		switch {
+		case p.accept("if", "not", "exists"):
+			stmt.ifNotExists = true
+			continue
+		case p.accept("using"):
+			if err = p.using(stmt); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		return stmt, nil
+	}
+}
+
+func (p *parser) parseUpdate() (*statement, error) {
+	var err error
+	stmt := &statement{typ: updateStatement}
+	if stmt.table, err = p.tableName(); err != nil {
+		return nil, err
+	}
+	if p.accept("using") {
+		if err = p.using(stmt); err != nil {
+			return nil, err
+		}
+	}
+	if err = p.expect("set"); err != nil {
+		return nil, err
+	}
+	for {
+		var a assignment
+		if a.column, err = p.identifier(); err != nil {
+			return nil, err
+		}
+		if p.acceptSymbol("[") {
+			key, err := p.term()
+			if err != nil {
+				return nil, err
+			}
+			if err = p.expectSymbol("]"); err != nil {
+				return nil, err
+			}
+			a.key = &key
+		}
+		if err = p.expectSymbol("="); err != nil {
+			return nil, err
+		}
+		a.op = "="
+		if t := p.peek(); a.key == nil && t.typ == identToken && t.text == a.column {
+			p.next()
+			switch op := p.next(); op.text {
+			case "+", "-":
+				a.op = op.text
+			default:
+				return nil, p.errorf("unsupported operation on %s", a.column)
+			}
+		}
+		if a.term, err = p.term(); err != nil {
+			return nil, err
+		}
+		// Prepend to a list: c = ? + c
+		if a.key == nil && a.op == "=" && p.acceptSymbol("+") {
+			if column, err := p.identifier(); err != nil {
+				return nil, err
+			} else if column != a.column {
+				return nil, p.errorf("unsupported operation on %s", a.column)
+			}
+			a.op = "prepend"
+		}
+		stmt.assignments = append(stmt.assignments, a)
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+	if err = p.expect("where"); err != nil {
+		return nil, err
+	}
+	if stmt.where, err = p.relations(); err != nil {
+		return nil, err
+	}
+	return stmt, p.parseIf(stmt)
+}
+
+func (p *parser) parseDelete() (*statement, error) {
+	var err error
+	stmt := &statement{typ: deleteStatement}
+	if !p.keyword("from") {
+		if stmt.columns, err = p.identifiers(); err != nil {
+			return nil, err
+		}
+	}
+	if err = p.expect("from"); err != nil {
+		return nil, err
+	}
+	if stmt.table, err = p.tableName(); err != nil {
+		return nil, err
+	}
+	if p.accept("using") {
+		if err = p.using(stmt); err != nil {
+			return nil, err
+		}
+	}
+	if err = p.expect("where"); err != nil {
+		return nil, err
+	}
+	if stmt.where, err = p.relations(); err != nil {
+		return nil, err
+	}
+	return stmt, p.parseIf(stmt)
+}
+
+func (p *parser) parseIf(stmt *statement) (err error) {
+	switch {
+	case p.accept("if", "exists"):
+		stmt.ifExists = true
+	case p.accept("if"):
+		stmt.conditions, err = p.relations()
+	}
+	return
+}
+
+// using parses the TTL and TIMESTAMP options, the timestamp is ignored.
+func (p *parser) using(stmt *statement) error {
+	for {
+		switch {
+		case p.accept("ttl"):
+			t, err := p.term()
+			if err != nil {
+				return err
+			}
+			stmt.ttl = &t
+		case p.accept("timestamp"):
+			if _, err := p.term(); err != nil {
+				return err
+			}
+		default:
+			return p.errorf("expecting TTL or TIMESTAMP")
+		}
+		if !p.accept("and") {
+			return nil
+		}
+	}
+}
+
+func (p *parser) parseCreateTable() (*statement, error) {
+	var err error
+	stmt := &statement{typ: createTableStatement}
+	stmt.ifNotExists = p.accept("if", "not", "exists")
+	if stmt.table, err = p.tableName(); err != nil {
+		return nil, err
+	}
+	if err = p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+	for {
+		if p.accept("primary", "key") {
+			if err = p.expectSymbol("("); err != nil {
+				return nil, err
+			}
+			if p.acceptSymbol("(") {
+				if stmt.partitionKey, err = p.identifiers(); err != nil {
+					return nil, err
+				}
+				if err = p.expectSymbol(")"); err != nil {
+					return nil, err
+				}
+			} else {
+				name, err := p.identifier()
+				if err != nil {
+					return nil, err
+				}
+				stmt.partitionKey = []string{name}
+			}
+			for p.acceptSymbol(",") {
+				name, err := p.identifier()
+				if err != nil {
+					return nil, err
+				}
+				stmt.clustering = append(stmt.clustering, name)
+			}
+			if err = p.expectSymbol(")"); err != nil {
+				return nil, err
+			}
+		} else {
+			def, err := p.definition()
+			if err != nil {
+				return nil, err
+			}
+			def.static = p.accept("static")
+			if p.accept("primary", "key") {
+				stmt.partitionKey = []string{def.name}
+			}
+			stmt.definitions = append(stmt.definitions, def)
+		}
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+	if err = p.expectSymbol(")"); err != nil {
+		return nil, err
+	}
+
+	// Only the clustering order is used, other options are ignored.
+	if p.accept("with") {
+		for {
+			if p.accept("clustering", "order", "by") {
+				if err = p.expectSymbol("("); err != nil {
+					return nil, err
+				}
+				for {
+					var o ordering
+					if o.column, err = p.identifier(); err != nil {
+						return nil, err
+					}
+					if p.accept("desc") {
+						o.desc = true
+					} else if err = p.expect("asc"); err != nil {
+						return nil, err
+					}
+					stmt.orders = append(stmt.orders, o)
+					if !p.acceptSymbol(",") {
+						break
+					}
+				}
+				if err = p.expectSymbol(")"); err != nil {
+					return nil, err
+				}
+			} else {
+				for depth := 0; p.peek().typ != eofToken && (depth > 0 || !p.keyword("and")); {
+					switch p.next().text {
+					case "{", "(", "[":
+						depth++
+					case "}", ")", "]":
+						depth--
+					}
+				}
+			}
+			if !p.accept("and") {
+				break
+			}
+		}
+	}
+	return stmt, nil
+}
+
+func (p *parser) parseCreateType() (*statement, error) {
+	var err error
+	stmt := &statement{typ: createTypeStatement}
+	stmt.ifNotExists = p.accept("if", "not", "exists")
+	if stmt.table, err = p.tableName(); err != nil {
+		return nil, err
+	}
+	if err = p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+	for {
+		def, err := p.definition()
+		if err != nil {
+			return nil, err
+		}
+		stmt.definitions = append(stmt.definitions, def)
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+	return stmt, p.expectSymbol(")")
+}
+
+func (p *parser) definition() (def definition, err error) {
+	if def.name, err = p.identifier(); err != nil {
+		return
+	}
+	def.typ, err = p.cqlType()
+	return
+}
+
+func (p *parser) cqlType() (cqlType, error) {
+	var typ cqlType
+	name, err := p.identifier()
+	if err != nil {
+		return typ, err
+	}
+	typ.name = name
+	if p.acceptSymbol("<") {
+		for {
+			param, err := p.cqlType()
+			if err != nil {
+				return typ, err
+			}
+			typ.params = append(typ.params, param)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+		if err := p.expectSymbol(">"); err != nil {
+			return typ, err
+		}
+	}
+	return typ, nil
+}
+
+// relations parses a list of relations joined by AND.
+func (p *parser) relations() ([]relation, error) {
+	var relations []relation
+	for {
+		if p.keyword("token") {
+			return nil, p.errorf("token relations are not supported")
+		}
+
+		var rel relation
+		var err error
+		if p.acceptSymbol("(") {
+			if rel, err = p.tupleRelation(); err != nil {
+				return nil, err
+			}
+			relations = append(relations, rel)
+			if !p.accept("and") {
+				return relations, nil
+			}
+			continue
+		}
+		if rel.column, err = p.identifier(); err != nil {
+			return nil, err
+		}
+
+		switch {
+		case p.accept("in"):
+			rel.op = "IN"
+			if rel.terms, err = p.terms(); err != nil {
+				return nil, err
+			}
+		case p.accept("contains", "key"):
+			rel.op = "CONTAINS KEY"
+		case p.accept("contains"):
+			rel.op = "CONTAINS"
+		default:
+			switch t := p.next(); t.text {
+			case "=", "!=", "<", "<=", ">", ">=":
+				rel.op = t.text
+			default:
+				p.pos--
+				return nil, p.errorf("unsupported relation on %s", rel.column)
+			}
+		}
+
+		if rel.op != "IN" {
+			t, err := p.term()
+			if err != nil {
+				return nil, err
+			}
+			rel.terms = []term{t}
+		}
+
+		relations = append(relations, rel)
+		if !p.accept("and") {
+			return relations, nil
+		}
+	}
+}
+
+// tupleRelation parses a multi-column relation after the opening
+// parenthesis.
+func (p *parser) tupleRelation() (relation, error) {
+	var rel relation
+	var err error
+	if rel.tuple, err = p.identifiers(); err != nil {
+		return rel, err
+	}
+	if err := p.expectSymbol(")"); err != nil {
+		return rel, err
+	}
+	rel.column = strings.Join(rel.tuple, ", ")
+
+	if p.accept("in") {
+		rel.op = "IN"
+		if err := p.expectSymbol("("); err != nil {
+			return rel, err
+		}
+		for !p.acceptSymbol(")") {
+			if len(rel.tuples) > 0 {
+				if err := p.expectSymbol(","); err != nil {
+					return rel, err
+				}
+			}
+			terms, err := p.terms()
+			if err != nil {
+				return rel, err
+			}
+			rel.tuples = append(rel.tuples, terms)
+		}
+	} else {
+		switch t := p.next(); t.text {
+		case "=", "<", "<=", ">", ">=":
+			rel.op = t.text
+		default:
+			p.pos--
+			return rel, p.errorf("unsupported relation on (%s)", rel.column)
+		}
+		terms, err := p.terms()
+		if err != nil {
+			return rel, err
+		}
+		rel.tuples = [][]term{terms}
+	}
+
+	for _, terms := range rel.tuples {
+		if len(terms) != len(rel.tuple) {
+			return rel, p.errorf("expected %d elements in value tuple for (%s), got %d", len(rel.tuple), rel.column, len(terms))
+		}
+	}
+	return rel, nil
+}
+
+// terms parses a list of terms enclosed in parentheses.
+func (p *parser) terms() ([]term, error) {
+	if err := p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+	var terms []term
+	for !p.acceptSymbol(")") {
+		if len(terms) > 0 {
+			if err := p.expectSymbol(","); err != nil {
+				return nil, err
+			}
+		}
+		t, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, t)
+	}
+	return terms, nil
+}
+
+func (p *parser) term() (term, error) {
+	t := p.next()
+	switch t.typ {
+	case bindToken:
+		p.binds++
+		return term{bind: p.binds}, nil
+	case stringToken, uuidToken:
+		return term{literal: t.text}, nil
+	case numberToken:
+		return term{literal: t.text, number: true}, nil
+	case identToken:
+		switch t.text {
+		case "true":
+			return term{literal: true}, nil
+		case "false":
+			return term{literal: false}, nil
+		case "null":
+			return term{}, nil
+		}
+	case symbolToken:
+		switch t.text {
+		case "[":
+			return p.collection("]")
+		case "{":
+			return p.collection("}")
+		}
+	}
+	p.pos--
+	return term{}, p.errorf("unsupported term")
+}
+
+// collection parses the elements of a list, set or map literal.
+func (p *parser) collection(end string) (term, error) {
+	t := term{collection: true}
+	for !p.acceptSymbol(end) {
+		if len(t.elems) > 0 {
+			if err := p.expectSymbol(","); err != nil {
+				return t, err
+			}
+		}
+		elem, err := p.term()
+		if err != nil {
+			return t, err
+		}
+		if end == "}" && p.acceptSymbol(":") {
+			t.keys = append(t.keys, elem)
+			if elem, err = p.term(); err != nil {
+				return t, err
+			}
+		}
+		t.elems = append(t.elems, elem)
+	}
+	return t, nil
+}
+
+func (p *parser) selectors() ([]selector, error) {
+	var list []selector
+	for {
+		var s selector
+		name, err := p.identifier()
+		if err != nil {
+			return nil, err
+		}
+		if p.acceptSymbol("(") {
+			s.fn = name
+			// COUNT(*) and COUNT(1) count the rows.
+			if t := p.peek(); name == "count" && (t.text == "*" || t.text == "1") {
+				p.next()
+				s.column = "*"
+			} else if s.column, err = p.identifier(); err != nil {
+				return nil, p.errorf("unsupported arguments in function %s", name)
+			}
+			if !p.acceptSymbol(")") {
+				return nil, p.errorf("unsupported arguments in function %s", name)
+			}
+		} else {
+			s.column = name
+		}
+		if p.accept("as") {
+			if s.alias, err = p.identifier(); err != nil {
+				return nil, err
+			}
+		}
+		list = append(list, s)
+		if !p.acceptSymbol(",") {
+			return list, nil
+		}
+	}
+}
+
+func (p *parser) identifiers() ([]string, error) {
+	var names []string
+	for {
+		name, err := p.identifier()
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+		if !p.acceptSymbol(",") {
+			return names, nil
+		}
+	}
+}
+
+func (p *parser) identifier() (string, error) {
+	if t := p.peek(); t.typ == identToken || t.typ == quotedToken {
+		p.next()
+		return t.text, nil
+	}
+	return "", p.errorf("expecting identifier")
+}
+
+// tableName returns the name of a table without the keyspace.
+func (p *parser) tableName() (string, error) {
+	name, err := p.identifier()
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	return name, err
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.typ != eofToken {
+		p.pos++
+	}
+	return t
+}
+
+// keyword returns true if the next tokens are the given keywords.
+func (p *parser) keyword(words ...string) bool {
+	for i, w := range words {
+		if p.pos+i >= len(p.tokens) {
+			return false
+		}
+		if t := p.tokens[p.pos+i]; t.typ != identToken || t.text != w {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *parser) accept(words ...string) bool {
+	if p.keyword(words...) {
+		p.pos += len(words)
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(words ...string) error {
+	if !p.accept(words...) {
+		return p.errorf("expecting %s", strings.ToUpper(strings.Join(words, " ")))
+	}
+	return nil
+}
+
+func (p *parser) acceptSymbol(s string) bool {
+	if t := p.peek(); t.typ == symbolToken && t.text == s {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectSymbol(s string) error {
+	if !p.acceptSymbol(s) {
+		return p.errorf("expecting '%s'", s)
+	}
+	return nil
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("ecqltest: %s at '%s'", fmt.Sprintf(format, args...), p.peek().text)
+}
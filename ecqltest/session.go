@@ -1,6 +1,8 @@
 package ecqltest
 
 import (
+	"context"
+
 	"github.com/gocql/gocql"
 	"github.com/maraino/ecql"
 	"github.com/maraino/go-mock"
@@ -20,21 +22,42 @@ func (m *Session) Get(i interface{}, keys ...interface{}) error {
 	return result.Error(0)
 }
 
+func (m *Session) GetContext(ctx context.Context, i interface{}, keys ...interface{}) error {
+	slice := append([]interface{}{ctx, i}, keys...)
+	result := m.Called(slice...)
+	return result.Error(0)
+}
+
 func (m *Session) Set(i interface{}) error {
 	result := m.Called(i)
 	return result.Error(0)
 }
 
+func (m *Session) SetContext(ctx context.Context, i interface{}) error {
+	result := m.Called(ctx, i)
+	return result.Error(0)
+}
+
 func (m *Session) Del(i interface{}) error {
 	result := m.Called(i)
 	return result.Error(0)
 }
 
+func (m *Session) DelContext(ctx context.Context, i interface{}) error {
+	result := m.Called(ctx, i)
+	return result.Error(0)
+}
+
 func (m *Session) Exists(i interface{}) (bool, error) {
 	result := m.Called(i)
 	return result.Bool(0), result.Error(1)
 }
 
+func (m *Session) ExistsContext(ctx context.Context, i interface{}) (bool, error) {
+	result := m.Called(ctx, i)
+	return result.Bool(0), result.Error(1)
+}
+
 func (m *Session) Select(i interface{}) ecql.Statement {
 	result := m.Called(i)
 	return result.Get(0).(ecql.Statement)
@@ -65,7 +88,22 @@ func (m *Session) Batch() ecql.Batch {
 	return result.Get(0).(ecql.Batch)
 }
 
+func (m *Session) UnloggedBatch() ecql.Batch {
+	result := m.Called()
+	return result.Get(0).(ecql.Batch)
+}
+
+func (m *Session) CounterBatch() ecql.Batch {
+	result := m.Called()
+	return result.Get(0).(ecql.Batch)
+}
+
 func (m *Session) Query(stmt string, args ...interface{}) *gocql.Query {
 	var result = m.Called(stmt, args)
 	return result.Get(0).(*gocql.Query)
 }
+
+func (m *Session) ValidateSchema(keyspace string) error {
+	result := m.Called(keyspace)
+	return result.Error(0)
+}
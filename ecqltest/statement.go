@@ -1,6 +1,12 @@
 package ecqltest
 
 import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/gocql/gocql"
+
 	"github.com/maraino/ecql"
 	"github.com/maraino/go-mock"
 )
@@ -18,26 +24,62 @@ func (m *Statement) TypeScan() error {
 	return result.Error(0)
 }
 
+func (m *Statement) TypeScanContext(ctx context.Context) error {
+	var result = m.Called(ctx)
+	return result.Error(0)
+}
+
 func (m *Statement) Scan(i ...interface{}) error {
 	var result = m.Called(i...)
 	return result.Error(0)
 }
 
+func (m *Statement) ScanContext(ctx context.Context, i ...interface{}) error {
+	slice := append([]interface{}{ctx}, i...)
+	var result = m.Called(slice...)
+	return result.Error(0)
+}
+
 func (m *Statement) Exec() error {
 	var result = m.Called()
 	return result.Error(0)
 }
 
+func (m *Statement) ExecContext(ctx context.Context) error {
+	var result = m.Called(ctx)
+	return result.Error(0)
+}
+
 func (m *Statement) Iter() ecql.Iter {
 	var result = m.Called()
 	return result.Get(0).(ecql.Iter)
 }
 
+func (m *Statement) IterContext(ctx context.Context) ecql.Iter {
+	var result = m.Called(ctx)
+	return result.Get(0).(ecql.Iter)
+}
+
 func (m *Statement) BuildQuery() (string, []interface{}) {
 	var result = m.Called()
 	return result.String(0), result.Get(1).([]interface{})
 }
 
+func (m *Statement) BuildQueryE() (string, []interface{}, error) {
+	var result = m.Called()
+	return result.String(0), result.Get(1).([]interface{}), result.Error(2)
+}
+
+func (m *Statement) Err() error {
+	var result = m.Called()
+	return result.Error(0)
+}
+
+func (m *Statement) Clone() ecql.Statement {
+	var result = m.Called()
+	return result.Get(0).(ecql.Statement)
+}
+
 func (m *Statement) Do(cmd ecql.Command) ecql.Statement {
 	var result = m.Called(cmd)
 	return result.Get(0).(ecql.Statement)
@@ -91,6 +133,11 @@ func (m *Statement) Bind(i interface{}) ecql.Statement {
 	return result.Get(0).(ecql.Statement)
 }
 
+func (m *Statement) OmitEmpty() ecql.Statement {
+	var result = m.Called()
+	return result.Get(0).(ecql.Statement)
+}
+
 func (m *Statement) Map(i interface{}) ecql.Statement {
 	var result = m.Called(i)
 	return result.Get(0).(ecql.Statement)
@@ -101,6 +148,26 @@ func (m *Statement) Limit(n int) ecql.Statement {
 	return result.Get(0).(ecql.Statement)
 }
 
+func (m *Statement) PageSize(n int) ecql.Statement {
+	var result = m.Called(n)
+	return result.Get(0).(ecql.Statement)
+}
+
+func (m *Statement) PageState(state []byte) ecql.Statement {
+	var result = m.Called(state)
+	return result.Get(0).(ecql.Statement)
+}
+
+func (m *Statement) Page(dest interface{}, cursor string) (string, error) {
+	var result = m.Called(dest, cursor)
+	return result.String(0), result.Error(1)
+}
+
+func (m *Statement) PageContext(ctx context.Context, dest interface{}, cursor string) (string, error) {
+	var result = m.Called(ctx, dest, cursor)
+	return result.String(0), result.Error(1)
+}
+
 func (m *Statement) TTL(seconds int) ecql.Statement {
 	var result = m.Called(seconds)
 	return result.Get(0).(ecql.Statement)
@@ -116,6 +183,15 @@ func (m *Statement) AllowFiltering() ecql.Statement {
 	return result.Get(0).(ecql.Statement)
 }
 
+func (m *Statement) If(cond ...ecql.Condition) ecql.Statement {
+	slice := make([]interface{}, len(cond))
+	for i, v := range cond {
+		slice[i] = v
+	}
+	var result = m.Called(slice...)
+	return result.Get(0).(ecql.Statement)
+}
+
 func (m *Statement) IfExists() ecql.Statement {
 	var result = m.Called()
 	return result.Get(0).(ecql.Statement)
@@ -125,3 +201,57 @@ func (m *Statement) IfNotExists() ecql.Statement {
 	var result = m.Called()
 	return result.Get(0).(ecql.Statement)
 }
+
+func (m *Statement) Consistency(c gocql.Consistency) ecql.Statement {
+	var result = m.Called(c)
+	return result.Get(0).(ecql.Statement)
+}
+
+func (m *Statement) SerialConsistency(c gocql.SerialConsistency) ecql.Statement {
+	var result = m.Called(c)
+	return result.Get(0).(ecql.Statement)
+}
+
+func (m *Statement) Idempotent(value bool) ecql.Statement {
+	var result = m.Called(value)
+	return result.Get(0).(ecql.Statement)
+}
+
+func (m *Statement) RetryPolicy(policy gocql.RetryPolicy) ecql.Statement {
+	var result = m.Called(policy)
+	return result.Get(0).(ecql.Statement)
+}
+
+func (m *Statement) Timeout(d time.Duration) ecql.Statement {
+	var result = m.Called(d)
+	return result.Get(0).(ecql.Statement)
+}
+
+func (m *Statement) PerPartitionLimit(n int) ecql.Statement {
+	var result = m.Called(n)
+	return result.Get(0).(ecql.Statement)
+}
+
+func (m *Statement) GroupBy(columns ...string) ecql.Statement {
+	slice := make([]interface{}, len(columns))
+	for i, v := range columns {
+		slice[i] = v
+	}
+	var result = m.Called(slice...)
+	return result.Get(0).(ecql.Statement)
+}
+
+func (m *Statement) Distinct() ecql.Statement {
+	var result = m.Called()
+	return result.Get(0).(ecql.Statement)
+}
+
+func (m *Statement) BindJSON(data json.RawMessage) ecql.Statement {
+	var result = m.Called(data)
+	return result.Get(0).(ecql.Statement)
+}
+
+func (m *Statement) JSON() ecql.Statement {
+	var result = m.Called()
+	return result.Get(0).(ecql.Statement)
+}
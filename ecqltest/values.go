@@ -0,0 +1,654 @@
+package ecqltest
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// protoVersion is the protocol version used to marshal the values.
+const protoVersion = 4
+
+var nativeTypes = map[string]gocql.Type{
+	"ascii":     gocql.TypeAscii,
+	"bigint":    gocql.TypeBigInt,
+	"blob":      gocql.TypeBlob,
+	"boolean":   gocql.TypeBoolean,
+	"counter":   gocql.TypeCounter,
+	"date":      gocql.TypeDate,
+	"decimal":   gocql.TypeDecimal,
+	"double":    gocql.TypeDouble,
+	"duration":  gocql.TypeDuration,
+	"float":     gocql.TypeFloat,
+	"inet":      gocql.TypeInet,
+	"int":       gocql.TypeInt,
+	"smallint":  gocql.TypeSmallInt,
+	"text":      gocql.TypeText,
+	"time":      gocql.TypeTime,
+	"timestamp": gocql.TypeTimestamp,
+	"timeuuid":  gocql.TypeTimeUUID,
+	"tinyint":   gocql.TypeTinyInt,
+	"uuid":      gocql.TypeUUID,
+	"varchar":   gocql.TypeVarchar,
+	"varint":    gocql.TypeVarint,
+}
+
+var bigintType = gocql.NewNativeType(protoVersion, gocql.TypeBigInt, "")
+var booleanType = gocql.NewNativeType(protoVersion, gocql.TypeBoolean, "")
+var textType = gocql.NewNativeType(protoVersion, gocql.TypeText, "")
+
+// typeInfo returns the gocql.TypeInfo for a CQL type.
+func (m *Memory) typeInfo(typ cqlType) (gocql.TypeInfo, error) {
+	params := make([]gocql.TypeInfo, len(typ.params))
+	for i := range typ.params {
+		info, err := m.typeInfo(typ.params[i])
+		if err != nil {
+			return nil, err
+		}
+		params[i] = info
+	}
+
+	switch {
+	case typ.name == "frozen" && len(params) == 1:
+		return params[0], nil
+	case typ.name == "list" && len(params) == 1:
+		return gocql.CollectionType{NativeType: gocql.NewNativeType(protoVersion, gocql.TypeList, ""), Elem: params[0]}, nil
+	case typ.name == "set" && len(params) == 1:
+		return gocql.CollectionType{NativeType: gocql.NewNativeType(protoVersion, gocql.TypeSet, ""), Elem: params[0]}, nil
+	case typ.name == "map" && len(params) == 2:
+		return gocql.CollectionType{NativeType: gocql.NewNativeType(protoVersion, gocql.TypeMap, ""), Key: params[0], Elem: params[1]}, nil
+	case typ.name == "tuple" && len(params) > 0:
+		return gocql.TupleTypeInfo{NativeType: gocql.NewNativeType(protoVersion, gocql.TypeTuple, ""), Elems: params}, nil
+	case len(params) == 0:
+		if t, ok := nativeTypes[typ.name]; ok {
+			return gocql.NewNativeType(protoVersion, t, ""), nil
+		}
+		if udt, ok := m.types[typ.name]; ok {
+			return udt, nil
+		}
+	}
+
+	return nil, fmt.Errorf("ecqltest: unknown type %s", typ)
+}
+
+// elemInfo returns the type of the elements of a collection, or the type of
+// the keys of a map if key is true.
+func elemInfo(info gocql.TypeInfo, key bool) (gocql.TypeInfo, error) {
+	if c, ok := info.(gocql.CollectionType); ok {
+		if key && c.Type() == gocql.TypeMap {
+			return c.Key, nil
+		} else if !key {
+			return c.Elem, nil
+		}
+	}
+	return nil, fmt.Errorf("ecqltest: %s is not a collection", info)
+}
+
+// toValue converts v to the Go type used by gocql for the given CQL type. The
+// conversion is done marshaling and unmarshaling the value, so the same
+// values accepted by gocql are accepted. Empty collections are stored as
+// null values as Cassandra does.
+func toValue(info gocql.TypeInfo, v interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	data, err := gocql.Marshal(info, v)
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	ptr := info.New()
+	if err := gocql.Unmarshal(info, data, ptr); err != nil {
+		return nil, err
+	}
+
+	value := reflect.ValueOf(ptr).Elem()
+	switch info.Type() {
+	case gocql.TypeList, gocql.TypeMap:
+		if value.Len() == 0 {
+			return nil, nil
+		}
+	case gocql.TypeSet:
+		if value.Len() == 0 {
+			return nil, nil
+		}
+		return sortSet(value), nil
+	}
+
+	return value.Interface(), nil
+}
+
+// timestampFormats are the formats accepted in timestamp literals.
+var timestampFormats = []string{
+	"2006-01-02 15:04:05-0700",
+	"2006-01-02 15:04:05.999-0700",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02T15:04:05-0700",
+	"2006-01-02T15:04:05Z07:00",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04-0700",
+	"2006-01-02",
+}
+
+// literalValue converts a literal in a CQL statement to the given type.
+func literalValue(info gocql.TypeInfo, t term) (interface{}, error) {
+	if t.collection {
+		return collectionValue(info, t)
+	}
+
+	if s, ok := t.literal.(string); ok && !t.number && info.Type() == gocql.TypeTimestamp {
+		for _, format := range timestampFormats {
+			if ts, err := time.Parse(format, s); err == nil {
+				return toValue(info, ts)
+			}
+		}
+		return nil, fmt.Errorf("ecqltest: unable to parse timestamp '%s'", s)
+	}
+
+	if !t.number {
+		return toValue(info, t.literal)
+	}
+
+	s := t.literal.(string)
+	switch info.Type() {
+	case gocql.TypeFloat, gocql.TypeDouble:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, err
+		}
+		return toValue(info, f)
+	case gocql.TypeVarint, gocql.TypeDecimal, gocql.TypeText, gocql.TypeVarchar, gocql.TypeAscii:
+		return toValue(info, s)
+	default:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		return toValue(info, n)
+	}
+}
+
+// collectionValue converts a list, set or map literal to the given type.
+func collectionValue(info gocql.TypeInfo, t term) (interface{}, error) {
+	c, ok := info.(gocql.CollectionType)
+	if !ok {
+		return nil, fmt.Errorf("ecqltest: invalid collection literal for type %s", info)
+	}
+
+	if c.Type() == gocql.TypeMap {
+		if len(t.keys) != len(t.elems) {
+			return nil, fmt.Errorf("ecqltest: invalid map literal for type %s", info)
+		}
+		m := make(map[interface{}]interface{}, len(t.elems))
+		for i := range t.elems {
+			k, err := literalValue(c.Key, t.keys[i])
+			if err != nil {
+				return nil, err
+			}
+			if m[k], err = literalValue(c.Elem, t.elems[i]); err != nil {
+				return nil, err
+			}
+		}
+		return toValue(info, m)
+	}
+
+	list := make([]interface{}, len(t.elems))
+	for i := range t.elems {
+		v, err := literalValue(c.Elem, t.elems[i])
+		if err != nil {
+			return nil, err
+		}
+		list[i] = v
+	}
+	return toValue(info, list)
+}
+
+// bindValue returns the value of the term converted to the given type.
+func bindValue(info gocql.TypeInfo, t term, args []interface{}) (interface{}, error) {
+	if t.bind > 0 {
+		// Unset values are handled by the statements.
+		if args[t.bind-1] == gocql.UnsetValue {
+			return gocql.UnsetValue, nil
+		}
+		return toValue(info, args[t.bind-1])
+	}
+	return literalValue(info, t)
+}
+
+// scanValue sets in dest the value of a column.
+func scanValue(info gocql.TypeInfo, value, dest interface{}) error {
+	data, err := gocql.Marshal(info, value)
+	if err != nil {
+		return err
+	}
+	return gocql.Unmarshal(info, data, dest)
+}
+
+// sortSet sorts and removes the duplicated elements of a set.
+func sortSet(v reflect.Value) interface{} {
+	elems := make([]interface{}, v.Len())
+	for i := range elems {
+		elems[i] = v.Index(i).Interface()
+	}
+	sort.SliceStable(elems, func(i, j int) bool {
+		return compareValues(elems[i], elems[j]) < 0
+	})
+
+	set := reflect.MakeSlice(v.Type(), 0, len(elems))
+	for i := range elems {
+		if i == 0 || compareValues(elems[i-1], elems[i]) != 0 {
+			set = reflect.Append(set, reflect.ValueOf(elems[i]))
+		}
+	}
+	return set.Interface()
+}
+
+// compareValues compares two values of the same CQL type, null values go
+// first.
+func compareValues(a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+
+	switch x := a.(type) {
+	case time.Time:
+		if y, ok := b.(time.Time); ok {
+			return compareInt(x.UnixNano(), y.UnixNano())
+		}
+	case gocql.UUID:
+		if y, ok := b.(gocql.UUID); ok {
+			// Time based UUIDs are sorted by time.
+			if x.Version() == 1 && y.Version() == 1 {
+				if c := compareInt(x.Timestamp(), y.Timestamp()); c != 0 {
+					return c
+				}
+			}
+			return bytes.Compare(x[:], y[:])
+		}
+	case []byte:
+		if y, ok := b.([]byte); ok {
+			return bytes.Compare(x, y)
+		}
+	case *big.Int:
+		if y, ok := b.(*big.Int); ok {
+			return x.Cmp(y)
+		}
+	}
+
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	if va.Kind() == vb.Kind() {
+		switch va.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return compareInt(va.Int(), vb.Int())
+		case reflect.Float32, reflect.Float64:
+			switch x, y := va.Float(), vb.Float(); {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		case reflect.String:
+			return strings.Compare(va.String(), vb.String())
+		case reflect.Bool:
+			return compareInt(boolToInt(va.Bool()), boolToInt(vb.Bool()))
+		}
+	}
+
+	if reflect.DeepEqual(a, b) {
+		return 0
+	}
+	if c := strings.Compare(fmt.Sprint(a), fmt.Sprint(b)); c != 0 {
+		return c
+	}
+	return -1
+}
+
+func compareInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func boolToInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// compareKeys compares two primary keys, desc defines the columns in
+// descending order.
+func compareKeys(a, b []interface{}, desc []bool) int {
+	for i := range a {
+		c := compareValues(a[i], b[i])
+		if desc != nil && desc[i] {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// product returns all the combinations of the given values.
+func product(values [][]interface{}) [][]interface{} {
+	combinations := [][]interface{}{nil}
+	for _, list := range values {
+		var next [][]interface{}
+		for _, c := range combinations {
+			for _, v := range list {
+				next = append(next, append(append([]interface{}{}, c...), v))
+			}
+		}
+		combinations = next
+	}
+	return combinations
+}
+
+// updateCollection returns the result of an assignment on the current value of
+// a list, set or map. Empty collections are returned as nil.
+func updateCollection(info gocql.TypeInfo, current interface{}, a boundAssignment) interface{} {
+	typ := info.Type()
+	cur := reflect.ValueOf(current)
+
+	var v reflect.Value
+	switch {
+	case a.op == "[]" && typ == gocql.TypeList:
+		v = reflect.MakeSlice(cur.Type(), 0, cur.Len())
+		for i := 0; i < cur.Len(); i++ {
+			if i != a.key.(int) {
+				v = reflect.Append(v, cur.Index(i))
+			} else if a.value != nil {
+				v = reflect.Append(v, reflect.ValueOf(a.value))
+			}
+		}
+	case a.op == "[]":
+		v = copyMap(info, cur)
+		if a.value == nil {
+			v.SetMapIndex(reflect.ValueOf(a.key), reflect.Value{})
+		} else {
+			v.SetMapIndex(reflect.ValueOf(a.key), reflect.ValueOf(a.value))
+		}
+	case a.value == nil:
+		return current
+	case current == nil && a.op != "-":
+		return a.value
+	case current == nil:
+		return nil
+	case typ == gocql.TypeMap && a.op == "+":
+		v = copyMap(info, cur)
+		iter := reflect.ValueOf(a.value).MapRange()
+		for iter.Next() {
+			v.SetMapIndex(iter.Key(), iter.Value())
+		}
+	case typ == gocql.TypeMap:
+		v = copyMap(info, cur)
+		keys := reflect.ValueOf(a.value)
+		for i := 0; i < keys.Len(); i++ {
+			v.SetMapIndex(keys.Index(i), reflect.Value{})
+		}
+	case a.op == "+":
+		v = reflect.AppendSlice(reflect.AppendSlice(reflect.MakeSlice(cur.Type(), 0, cur.Len()), cur), reflect.ValueOf(a.value))
+		if typ == gocql.TypeSet {
+			v = reflect.ValueOf(sortSet(v))
+		}
+	case a.op == "prepend":
+		v = reflect.AppendSlice(reflect.AppendSlice(reflect.MakeSlice(cur.Type(), 0, cur.Len()), reflect.ValueOf(a.value)), cur)
+	default:
+		// Remove all the occurrences of the values.
+		values := reflect.ValueOf(a.value)
+		v = reflect.MakeSlice(cur.Type(), 0, cur.Len())
+		for i := 0; i < cur.Len(); i++ {
+			found := false
+			for j := 0; j < values.Len() && !found; j++ {
+				found = compareValues(cur.Index(i).Interface(), values.Index(j).Interface()) == 0
+			}
+			if !found {
+				v = reflect.Append(v, cur.Index(i))
+			}
+		}
+	}
+
+	if v.Len() == 0 {
+		return nil
+	}
+	return v.Interface()
+}
+
+// copyMap returns a copy of a map, or a new map of the given type if m is not
+// valid.
+func copyMap(info gocql.TypeInfo, m reflect.Value) reflect.Value {
+	if !m.IsValid() {
+		return reflect.MakeMap(reflect.TypeOf(info.New()).Elem())
+	}
+	v := reflect.MakeMapWithSize(m.Type(), m.Len())
+	iter := m.MapRange()
+	for iter.Next() {
+		v.SetMapIndex(iter.Key(), iter.Value())
+	}
+	return v
+}
+
+// aggregate returns the result of the aggregate function fn on the given
+// values, null values are ignored.
+func aggregate(fn string, info gocql.TypeInfo, values []interface{}) (interface{}, error) {
+	var present []interface{}
+	for _, v := range values {
+		if v != nil {
+			present = append(present, v)
+		}
+	}
+
+	switch fn {
+	case "count":
+		return int64(len(present)), nil
+	case "min", "max":
+		var m interface{}
+		for _, v := range present {
+			if c := compareValues(v, m); m == nil || (fn == "min" && c < 0) || (fn == "max" && c > 0) {
+				m = v
+			}
+		}
+		return m, nil
+	}
+
+	// The result of sum and avg has the type of the column.
+	result := reflect.New(reflect.TypeOf(info.New()).Elem()).Elem()
+	switch result.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var sum int64
+		for _, v := range present {
+			sum += reflect.ValueOf(v).Int()
+		}
+		if fn == "avg" && len(present) > 0 {
+			sum /= int64(len(present))
+		}
+		result.SetInt(sum)
+	case reflect.Float32, reflect.Float64:
+		var sum float64
+		for _, v := range present {
+			sum += reflect.ValueOf(v).Float()
+		}
+		if fn == "avg" && len(present) > 0 {
+			sum /= float64(len(present))
+		}
+		result.SetFloat(sum)
+	default:
+		return nil, fmt.Errorf("ecqltest: unsupported function %s on type %s", fn, info)
+	}
+	return result.Interface(), nil
+}
+
+// fromJSON converts a value decoded from a JSON document to the given type.
+// Numbers must be decoded as json.Number.
+func fromJSON(info gocql.TypeInfo, v interface{}) (interface{}, error) {
+	switch vv := v.(type) {
+	case nil:
+		return nil, nil
+	case json.Number:
+		return literalValue(info, term{literal: vv.String(), number: true})
+	case bool:
+		return toValue(info, vv)
+	case string:
+		switch info.Type() {
+		case gocql.TypeText, gocql.TypeVarchar, gocql.TypeAscii:
+			return toValue(info, vv)
+		case gocql.TypeBlob:
+			if !strings.HasPrefix(vv, "0x") {
+				return nil, fmt.Errorf("ecqltest: invalid blob '%s'", vv)
+			}
+			b, err := hex.DecodeString(vv[2:])
+			if err != nil {
+				return nil, err
+			}
+			return toValue(info, b)
+		case gocql.TypeUUID, gocql.TypeTimeUUID:
+			u, err := gocql.ParseUUID(vv)
+			if err != nil {
+				return nil, err
+			}
+			return toValue(info, u)
+		case gocql.TypeBigInt, gocql.TypeInt, gocql.TypeSmallInt, gocql.TypeTinyInt, gocql.TypeCounter,
+			gocql.TypeFloat, gocql.TypeDouble, gocql.TypeVarint, gocql.TypeDecimal:
+			return literalValue(info, term{literal: vv, number: true})
+		default:
+			return literalValue(info, term{literal: vv})
+		}
+	case []interface{}:
+		var elems []gocql.TypeInfo
+		switch c := info.(type) {
+		case gocql.CollectionType:
+			if c.Type() == gocql.TypeMap {
+				break
+			}
+			for range vv {
+				elems = append(elems, c.Elem)
+			}
+		case gocql.TupleTypeInfo:
+			if len(c.Elems) != len(vv) {
+				return nil, fmt.Errorf("ecqltest: invalid tuple %v", vv)
+			}
+			elems = c.Elems
+		}
+		if elems == nil && len(vv) > 0 {
+			break
+		}
+		list := make([]interface{}, len(vv))
+		for i := range vv {
+			e, err := fromJSON(elems[i], vv[i])
+			if err != nil {
+				return nil, err
+			}
+			list[i] = e
+		}
+		return toValue(info, list)
+	case map[string]interface{}:
+		switch c := info.(type) {
+		case gocql.CollectionType:
+			if c.Type() != gocql.TypeMap {
+				break
+			}
+			m := make(map[interface{}]interface{}, len(vv))
+			for k, e := range vv {
+				key, err := fromJSON(c.Key, k)
+				if err != nil {
+					return nil, err
+				}
+				if m[key], err = fromJSON(c.Elem, e); err != nil {
+					return nil, err
+				}
+			}
+			return toValue(info, m)
+		case gocql.UDTTypeInfo:
+			m := make(map[string]interface{}, len(c.Elements))
+			for _, field := range c.Elements {
+				e, err := fromJSON(field.Type, vv[field.Name])
+				if err != nil {
+					return nil, err
+				}
+				m[field.Name] = e
+			}
+			return toValue(info, m)
+		}
+	}
+	return nil, fmt.Errorf("ecqltest: invalid JSON value %v for type %s", v, info)
+}
+
+// jsonValue converts a value to its representation in the documents returned
+// by SELECT JSON.
+func jsonValue(info gocql.TypeInfo, v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+
+	switch info.Type() {
+	case gocql.TypeTimestamp:
+		return v.(time.Time).UTC().Format("2006-01-02 15:04:05.000Z")
+	case gocql.TypeBlob:
+		return "0x" + hex.EncodeToString(v.([]byte))
+	case gocql.TypeUUID, gocql.TypeTimeUUID:
+		return v.(gocql.UUID).String()
+	case gocql.TypeVarint, gocql.TypeDecimal:
+		return json.Number(fmt.Sprint(v))
+	case gocql.TypeList, gocql.TypeSet:
+		elem, _ := elemInfo(info, false)
+		rv := reflect.ValueOf(v)
+		list := make([]interface{}, rv.Len())
+		for i := range list {
+			list[i] = jsonValue(elem, rv.Index(i).Interface())
+		}
+		return list
+	case gocql.TypeMap:
+		key, _ := elemInfo(info, true)
+		elem, _ := elemInfo(info, false)
+		m := make(map[string]interface{})
+		iter := reflect.ValueOf(v).MapRange()
+		for iter.Next() {
+			k := jsonValue(key, iter.Key().Interface())
+			if s, ok := k.(string); ok {
+				m[s] = jsonValue(elem, iter.Value().Interface())
+			} else {
+				b, _ := json.Marshal(k)
+				m[string(b)] = jsonValue(elem, iter.Value().Interface())
+			}
+		}
+		return m
+	case gocql.TypeTuple:
+		elems := info.(gocql.TupleTypeInfo).Elems
+		rv := reflect.ValueOf(v)
+		list := make([]interface{}, rv.Len())
+		for i := range list {
+			list[i] = jsonValue(elems[i], rv.Index(i).Interface())
+		}
+		return list
+	case gocql.TypeUDT:
+		fields := v.(map[string]interface{})
+		m := make(map[string]interface{}, len(fields))
+		for _, field := range info.(gocql.UDTTypeInfo).Elements {
+			m[field.Name] = jsonValue(field.Type, fields[field.Name])
+		}
+		return m
+	}
+	return v
+}
@@ -1,8 +1,123 @@
 package ecql
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var (
 	ErrInvalidQueryType = errors.New("invalid query type")
 	ErrInvalidCommand   = errors.New("invalid cql command")
+
+	// ErrConcurrentModification is returned by Session.Set and Session.Update
+	// on types with a version column if the version in the database does not
+	// match the version in the struct.
+	ErrConcurrentModification = errors.New("concurrent modification")
+
+	// ErrInvalidVersion is returned by Session.Set and Session.Update if the
+	// version column is not mapped to an integer field of the struct.
+	ErrInvalidVersion = errors.New("invalid version column")
+
+	// ErrNotPointer is returned by Session.Set on types with a version column
+	// if the value is not a pointer, as the version could not be incremented,
+	// and by Track if the value is not a pointer.
+	ErrNotPointer = errors.New("value is not a pointer")
+
+	// ErrInvalidCursor is returned by Statement.Page if the cursor is not a
+	// value returned by a previous call.
+	ErrInvalidCursor = errors.New("invalid cursor")
+
+	// ErrInvalidSession is returned when applying a batch created with a
+	// session that cannot execute it, or by SessionExecutor if the session
+	// is not an ecql session.
+	ErrInvalidSession = errors.New("invalid session")
+
+	// ErrInvalidDestination is wrapped in a *StatementError by Statement.Page
+	// and Batch.TypeApplyCAS if the destination is not a pointer to a slice.
+	ErrInvalidDestination = errors.New("destination is not a pointer to a slice")
+
+	// ErrWriterClosed is returned by BatchWriter.Write after the writer has
+	// been closed.
+	ErrWriterClosed = errors.New("batch writer closed")
+
+	// The following errors are wrapped in a *StatementError by Statement.Err
+	// and Statement.BuildQueryE when a statement is not valid.
+	ErrInvalidType        = errors.New("type is not a struct")
+	ErrMissingTable       = errors.New("missing table")
+	ErrMissingWhere       = errors.New("missing WHERE clause")
+	ErrMissingAssignments = errors.New("missing SET clause")
+	ErrEmptyCondition     = errors.New("empty condition")
+	ErrInvalidClause      = errors.New("invalid clause")
+	ErrUnknownColumn      = errors.New("unknown column")
+	ErrBindCount          = errors.New("invalid number of bind values")
+	ErrInvalidConsistency = errors.New("invalid consistency")
+	ErrInvalidTuple       = errors.New("invalid tuple relation")
+	ErrKeyModified        = errors.New("primary key modified")
 )
+
+// StatementError is the error returned by Statement.Err and
+// Statement.BuildQueryE if the statement is not valid. Err is one of the
+// errors defined in this package, and Detail the clause or column that
+// caused it, if any.
+// 	if errors.Is(err, ecql.ErrMissingWhere) {
+// 		...
+// 	}
+type StatementError struct {
+	Command Command
+	Table   string
+	Detail  string
+	Err     error
+}
+
+func (e *StatementError) Error() string {
+	msg := fmt.Sprintf("invalid %s statement", e.Command)
+	if e.Table != "" {
+		msg += " on " + e.Table
+	}
+	msg += ": " + e.Err.Error()
+	if e.Detail != "" {
+		msg += " " + e.Detail
+	}
+	return msg
+}
+
+func (e *StatementError) Unwrap() error {
+	return e.Err
+}
+
+// NotAppliedError is the error returned by conditional UPDATE and DELETE
+// statements when the conditions in the IF clause are not met. Values
+// contains the current values returned by Cassandra for the columns used in
+// the conditions.
+type NotAppliedError struct {
+	Values map[string]interface{}
+}
+
+func (e *NotAppliedError) Error() string {
+	return "statement not applied"
+}
+
+// WriteError is the error of a statement written with a BatchWriter.
+type WriteError struct {
+	Statement Statement
+	Err       error
+}
+
+func (e *WriteError) Error() string {
+	return "write failed: " + e.Err.Error()
+}
+
+func (e *WriteError) Unwrap() error {
+	return e.Err
+}
+
+// WriteErrors is the error returned by BatchWriter.Flush and
+// BatchWriter.Close with the statements that failed.
+type WriteErrors []*WriteError
+
+func (e WriteErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	return fmt.Sprintf("%d writes failed, first: %s", len(e), e[0].Err)
+}
@@ -0,0 +1,151 @@
+package ecql
+
+import (
+	"context"
+
+	"github.com/gocql/gocql"
+)
+
+// Executor executes the CQL statements built by ecql. By default sessions use
+// gocql to execute them, but other executors, like the in-memory one in the
+// package ecqltest, can be used with NewWithExecutor.
+type Executor interface {
+	Query(ctx context.Context, stmt string, args ...interface{}) Query
+	Batch(ctx context.Context, typ gocql.BatchType, entries []gocql.BatchEntry) BatchQuery
+}
+
+// Query is a CQL statement ready to be executed. The methods have the same
+// behavior as the ones in gocql.Query.
+type Query interface {
+	Exec() error
+	Scan(dest ...interface{}) error
+	MapScan(m map[string]interface{}) error
+	ScanCAS(dest ...interface{}) (bool, error)
+	MapScanCAS(dest map[string]interface{}) (bool, error)
+	Iter() Rows
+	PageSize(n int) Query
+	PageState(state []byte) Query
+	Consistency(c gocql.Consistency) Query
+	SerialConsistency(c gocql.SerialConsistency) Query
+	Idempotent(value bool) Query
+	RetryPolicy(policy gocql.RetryPolicy) Query
+}
+
+// Rows iterates over the rows returned by a query. It is implemented by
+// gocql.Iter.
+type Rows interface {
+	Scan(dest ...interface{}) bool
+	MapScan(m map[string]interface{}) bool
+	PageState() []byte
+	Close() error
+}
+
+// BatchQuery is a batch ready to be executed. The methods have the same
+// behavior as gocql.Session ExecuteBatch and MapExecuteBatchCAS, and the
+// gocql.Batch options.
+type BatchQuery interface {
+	Exec() error
+	MapExecCAS(dest map[string]interface{}) (bool, Rows, error)
+	Consistency(c gocql.Consistency) BatchQuery
+	SerialConsistency(c gocql.SerialConsistency) BatchQuery
+	RetryPolicy(policy gocql.RetryPolicy) BatchQuery
+	WithTimestamp(timestamp int64) BatchQuery
+}
+
+// SessionExecutor returns the Executor used by sess to execute statements. It
+// can be used to run arbitrary CQL statements in any session, including the
+// ones created with NewWithExecutor that do not support Query. It returns
+// ErrInvalidSession if sess is not a session created by ecql.
+func SessionExecutor(sess Session) (Executor, error) {
+	if s, ok := sess.(*SessionImpl); ok && s == nil {
+		return nil, ErrInvalidSession
+	}
+	if s, ok := sess.(interface{ exec() Executor }); ok {
+		return s.exec(), nil
+	}
+	return nil, ErrInvalidSession
+}
+
+// gocqlExecutor is the Executor implementation using gocql.
+type gocqlExecutor struct {
+	session *gocql.Session
+}
+
+func (e gocqlExecutor) Query(ctx context.Context, stmt string, args ...interface{}) Query {
+	return gocqlQuery{e.session.Query(stmt, args...).WithContext(ctx)}
+}
+
+func (e gocqlExecutor) Batch(ctx context.Context, typ gocql.BatchType, entries []gocql.BatchEntry) BatchQuery {
+	batch := e.session.NewBatch(typ).WithContext(ctx)
+	batch.Entries = entries
+	return gocqlBatch{session: e.session, batch: batch}
+}
+
+type gocqlQuery struct {
+	*gocql.Query
+}
+
+func (q gocqlQuery) Iter() Rows {
+	return q.Query.Iter()
+}
+
+func (q gocqlQuery) PageSize(n int) Query {
+	return gocqlQuery{q.Query.PageSize(n)}
+}
+
+func (q gocqlQuery) PageState(state []byte) Query {
+	return gocqlQuery{q.Query.PageState(state)}
+}
+
+func (q gocqlQuery) Consistency(c gocql.Consistency) Query {
+	return gocqlQuery{q.Query.Consistency(c)}
+}
+
+func (q gocqlQuery) SerialConsistency(c gocql.SerialConsistency) Query {
+	return gocqlQuery{q.Query.SerialConsistency(c)}
+}
+
+func (q gocqlQuery) Idempotent(value bool) Query {
+	return gocqlQuery{q.Query.Idempotent(value)}
+}
+
+func (q gocqlQuery) RetryPolicy(policy gocql.RetryPolicy) Query {
+	return gocqlQuery{q.Query.RetryPolicy(policy)}
+}
+
+type gocqlBatch struct {
+	session *gocql.Session
+	batch   *gocql.Batch
+}
+
+func (b gocqlBatch) Exec() error {
+	return b.session.ExecuteBatch(b.batch)
+}
+
+func (b gocqlBatch) MapExecCAS(dest map[string]interface{}) (bool, Rows, error) {
+	applied, iter, err := b.session.MapExecuteBatchCAS(b.batch, dest)
+	if iter == nil {
+		return applied, nil, err
+	}
+	return applied, iter, err
+}
+
+func (b gocqlBatch) Consistency(c gocql.Consistency) BatchQuery {
+	b.batch.SetConsistency(c)
+	return b
+}
+
+func (b gocqlBatch) SerialConsistency(c gocql.SerialConsistency) BatchQuery {
+	b.batch.SerialConsistency(c)
+	return b
+}
+
+func (b gocqlBatch) RetryPolicy(policy gocql.RetryPolicy) BatchQuery {
+	b.batch.RetryPolicy(policy)
+	return b
+}
+
+func (b gocqlBatch) WithTimestamp(timestamp int64) BatchQuery {
+	b.batch.WithTimestamp(timestamp)
+	return b
+}
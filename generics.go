@@ -0,0 +1,84 @@
+//go:build go1.23
+// +build go1.23
+
+package ecql
+
+import (
+	"context"
+	"iter"
+)
+
+// All executes the statement and returns all the rows, each one in a new
+// value of type T. T must be a struct type that can be mapped by ecql.
+// 	tweets, err := ecql.All[Tweet](sess.Select(Tweet{}).Where(Eq("timeline", "ecql")))
+func All[T any](stmt Statement) ([]T, error) {
+	return AllContext[T](context.Background(), stmt)
+}
+
+// AllContext is like All but the query will be executed with the given
+// context.
+func AllContext[T any](ctx context.Context, stmt Statement) ([]T, error) {
+	var rows []T
+	for v, err := range SeqContext[T](ctx, stmt) {
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, v)
+	}
+	return rows, nil
+}
+
+// One executes the statement and returns the first row in a value of type T.
+// It returns ErrNotFound if there are no rows. SELECT statements are executed
+// with LIMIT 1 on a copy of the statement, so only one row is fetched.
+func One[T any](stmt Statement) (T, error) {
+	return OneContext[T](context.Background(), stmt)
+}
+
+// OneContext is like One but the query will be executed with the given
+// context.
+func OneContext[T any](ctx context.Context, stmt Statement) (T, error) {
+	if s, ok := stmt.(*StatementImpl); ok && s.Command == SelectCmd && s.template == nil && s.LimitValue != 1 {
+		stmt = s.Clone().Limit(1)
+	}
+	for v, err := range SeqContext[T](ctx, stmt) {
+		return v, err
+	}
+	var zero T
+	return zero, ErrNotFound
+}
+
+// Seq executes the statement and returns an iterator over the rows, each one
+// in a new value of type T. If the query fails the iterator yields the error
+// as the last element.
+// 	for tw, err := range ecql.Seq[Tweet](sess.Select(Tweet{})) {
+// 		if err != nil {
+// 			return err
+// 		}
+// 		...
+// 	}
+func Seq[T any](stmt Statement) iter.Seq2[T, error] {
+	return SeqContext[T](context.Background(), stmt)
+}
+
+// SeqContext is like Seq but the query will be executed with the given
+// context.
+func SeqContext[T any](ctx context.Context, stmt Statement) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		it := stmt.IterContext(ctx)
+		for {
+			var v T
+			if !it.TypeScan(&v) {
+				break
+			}
+			if !yield(v, nil) {
+				it.Close()
+				return
+			}
+		}
+		if err := it.Close(); err != nil {
+			var zero T
+			yield(zero, err)
+		}
+	}
+}
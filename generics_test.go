@@ -0,0 +1,109 @@
+//go:build go1.23
+// +build go1.23
+
+package ecql_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/maraino/ecql"
+	"github.com/maraino/ecql/ecqltest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type item struct {
+	List string `cql:"list" cqltable:"items" cqlkey:"list,position"`
+	Pos  int    `cql:"position"`
+	Name string `cql:"name"`
+}
+
+func newItems(t *testing.T) ecql.Session {
+	m := ecqltest.NewMemory()
+	require.NoError(t, m.CreateTable(item{}))
+	sess := m.Session()
+	for i, name := range []string{"foo", "bar", "baz"} {
+		require.NoError(t, sess.Set(item{List: "items", Pos: i, Name: name}))
+	}
+	return sess
+}
+
+func TestAll(t *testing.T) {
+	sess := newItems(t)
+
+	items, err := ecql.All[item](sess.Select(item{}).Where(ecql.Eq("list", "items")))
+	assert.NoError(t, err)
+	assert.Equal(t, []item{{"items", 0, "foo"}, {"items", 1, "bar"}, {"items", 2, "baz"}}, items)
+
+	items, err = ecql.All[item](sess.Select(item{}).Where(ecql.Eq("list", "none")))
+	assert.NoError(t, err)
+	assert.Nil(t, items)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	items, err = ecql.AllContext[item](ctx, sess.Select(item{}))
+	assert.Equal(t, context.Canceled, err)
+	assert.Nil(t, items)
+}
+
+func TestOne(t *testing.T) {
+	sess := newItems(t)
+
+	it, err := ecql.One[item](sess.Select(item{}).Where(ecql.Eq("list", "items"), ecql.Eq("position", 1)))
+	assert.NoError(t, err)
+	assert.Equal(t, item{"items", 1, "bar"}, it)
+
+	it, err = ecql.One[item](sess.Select(item{}).Where(ecql.Eq("list", "none")))
+	assert.Equal(t, ecql.ErrNotFound, err)
+	assert.Equal(t, item{}, it)
+
+	// Only one row is requested, without modifying the statement
+	m := ecqltest.NewMemory()
+	require.NoError(t, m.CreateTable(item{}))
+	rec := &recorder{Memory: m}
+	sess = ecql.NewWithExecutor(rec)
+	require.NoError(t, sess.Set(item{List: "items", Pos: 0, Name: "foo"}))
+	require.NoError(t, sess.Set(item{List: "items", Pos: 1, Name: "bar"}))
+
+	stmt := sess.Select(item{}).Where(ecql.Eq("list", "items"))
+	it, err = ecql.One[item](stmt)
+	assert.NoError(t, err)
+	assert.Equal(t, item{"items", 0, "foo"}, it)
+	assert.Equal(t, "SELECT list,position,name FROM items WHERE list = ? LIMIT 1", rec.queries[len(rec.queries)-1])
+	query, _ := stmt.BuildQuery()
+	assert.Equal(t, "SELECT list,position,name FROM items WHERE list = ?", query)
+}
+
+// recorder is an ecql.Executor that records the queries executed.
+type recorder struct {
+	*ecqltest.Memory
+	queries []string
+}
+
+func (r *recorder) Query(ctx context.Context, stmt string, args ...interface{}) ecql.Query {
+	r.queries = append(r.queries, stmt)
+	return r.Memory.Query(ctx, stmt, args...)
+}
+
+func TestSeq(t *testing.T) {
+	sess := newItems(t)
+
+	var names []string
+	for it, err := range ecql.Seq[item](sess.Select(item{}).Where(ecql.Eq("list", "items"))) {
+		assert.NoError(t, err)
+		names = append(names, it.Name)
+		if len(names) == 2 {
+			break
+		}
+	}
+	assert.Equal(t, []string{"foo", "bar"}, names)
+
+	var errs []error
+	for _, err := range ecql.Seq[item](sess.Select(item{}).Where(ecql.Eq("name", "foo"))) {
+		errs = append(errs, err)
+	}
+	if assert.Len(t, errs, 1) {
+		assert.Error(t, errs[0])
+	}
+}
@@ -3,6 +3,8 @@
 package ecql
 
 import (
+	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
@@ -42,6 +44,22 @@ type views struct {
 	Counter int64      `cql:"counter"`
 }
 
+type document struct {
+	ID      string `cql:"id" cqltable:"documents" cqlkey:"id" cqlversion:"version"`
+	Text    string `cql:"text"`
+	Version int    `cql:"version"`
+}
+
+type address struct {
+	Street string `cql:"street"`
+	City   string `cql:"city"`
+}
+
+type place struct {
+	ID      string  `cql:"id" cqltable:"places" cqlkey:"id"`
+	Address address `cql:"address"`
+}
+
 func initialize(t *testing.T) {
 	sess := testSession.(*SessionImpl).Session
 	for _, stmt := range []string{
@@ -163,6 +181,144 @@ func TestSelectWithColumns(t *testing.T) {
 	assert.Equal(t, time.Time{}, tw.Time)
 }
 
+func TestSelectWithSelectors(t *testing.T) {
+	initialize(t)
+
+	type tweetMeta struct {
+		ID      gocql.UUID `cql:"id" cqltable:"tweet" cqlkey:"id"`
+		Text    string     `cql:"text"`
+		Written int64      `cql:",writetime=text"`
+		TTL     int        `cql:",ttl=text"`
+	}
+
+	before := time.Now()
+	tw := tweet{ID: gocql.TimeUUID(), Timeline: "ecql", Text: "meta"}
+	err := testSession.Insert(tw).TTL(3600).Exec()
+	assert.NoError(t, err)
+
+	var meta tweetMeta
+	err = testSession.Get(&meta, tw.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "meta", meta.Text)
+	assert.True(t, meta.Written >= before.UnixNano()/1000)
+	assert.True(t, meta.TTL > 3500 && meta.TTL <= 3600)
+
+	var token int64
+	var json string
+	err = testSession.Select(tw).Columns(As(Token("id"), "token"), ToJSON("text")).Where(EqInt(tw)).Scan(&token, &json)
+	assert.NoError(t, err)
+	assert.NotZero(t, token)
+	assert.Equal(t, `"meta"`, json)
+}
+
+func TestSelectAggregates(t *testing.T) {
+	initialize(t)
+
+	// Scalars
+	var count int64
+	var first, last time.Time
+	err := testSession.Select(timeline{}).Columns(CountOf("tweet"), Min("time"), Max("time")).Where(Eq("id", "ecql")).Scan(&count, &first, &last)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+	assert.Equal(t, "2016-01-01 00:00:00", first.UTC().Format("2006-01-02 15:04:05"))
+	assert.Equal(t, "2016-01-01 11:11:11", last.UTC().Format("2006-01-02 15:04:05"))
+
+	// Group by into structs
+	var tl timeline
+	err = testSession.Select(timeline{}).Columns("id", As(Max("time"), "time")).Where(Eq("id", "ecql")).GroupBy("id").Map(&tl).TypeScan()
+	assert.NoError(t, err)
+	assert.Equal(t, "ecql", tl.ID)
+	assert.Equal(t, last.Unix(), tl.Time.Unix())
+
+	// Distinct and per partition limit
+	var ids []string
+	iter := testSession.Select(timeline{}).Distinct().Iter()
+	for iter.TypeScan(&tl) {
+		ids = append(ids, tl.ID)
+	}
+	assert.NoError(t, iter.Close())
+	assert.Equal(t, []string{"ecql"}, ids)
+
+	var tweets []timeline
+	iter = testSession.Select(timeline{}).PerPartitionLimit(1).Iter()
+	for iter.TypeScan(&tl) {
+		tweets = append(tweets, tl)
+	}
+	assert.NoError(t, iter.Close())
+	assert.Len(t, tweets, 1)
+}
+
+func TestJSON(t *testing.T) {
+	initialize(t)
+
+	tw := tweet{ID: gocql.TimeUUID(), Timeline: "json", Text: "json tweet", Time: time.Unix(1462800000, 0)}
+	assert.NoError(t, testSession.Insert(tw).JSON().Exec())
+
+	var got tweet
+	assert.NoError(t, testSession.Get(&got, tw.ID))
+	assert.Equal(t, tw.Text, got.Text)
+	assert.Equal(t, tw.Time.Unix(), got.Time.Unix())
+
+	// Default unset
+	tw.Text = "updated"
+	tw.Timeline = "ignored"
+	assert.NoError(t, testSession.Insert(tw).Columns("id", "text").JSON().Exec())
+
+	var doc json.RawMessage
+	assert.NoError(t, testSession.Select(tw).Columns("timeline", "text").JSON().Where(EqInt(tw)).Scan(&doc))
+	assert.JSONEq(t, `{"timeline": "json", "text": "updated"}`, string(doc))
+
+	raw := json.RawMessage(fmt.Sprintf(`{"id": "%s", "text": "raw"}`, tw.ID))
+	assert.NoError(t, testSession.Insert(tweet{}).BindJSON(raw).Exec())
+	assert.NoError(t, testSession.Get(&got, tw.ID))
+	assert.Equal(t, "raw", got.Text)
+	assert.Equal(t, "json", got.Timeline)
+}
+
+func TestSelectTupleRelations(t *testing.T) {
+	initialize(t)
+	first := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var tl timeline
+	err := testSession.Select(timeline{}).Where(Eq("id", "ecql"), TupleGt([]string{"time"}, first)).Map(&tl).TypeScan()
+	assert.NoError(t, err)
+	assert.Equal(t, "2016-01-01 11:11:11", tl.Time.UTC().Format("2006-01-02 15:04:05"))
+
+	var count int
+	err = testSession.Count(timeline{}).Where(Eq("id", "ecql"), TupleIn([]string{"time"}, []interface{}{first}, []interface{}{tl.Time})).Scan(&count)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	err = testSession.Count(timeline{}).Where(Eq("id", "ecql"), TupleLe([]string{"time"}, first)).Scan(&count)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestOmitEmpty(t *testing.T) {
+	initialize(t)
+
+	type partialTweet struct {
+		ID       gocql.UUID `cql:"id" cqltable:"tweet" cqlkey:"id"`
+		Timeline string     `cql:"timeline,omitempty"`
+		Text     string     `cql:"text,omitempty"`
+	}
+
+	tw := tweet{ID: gocql.TimeUUID(), Timeline: "omitempty", Text: "full tweet", Time: time.Unix(1462800000, 0)}
+	assert.NoError(t, testSession.Set(tw))
+
+	var got tweet
+	assert.NoError(t, testSession.Set(partialTweet{ID: tw.ID, Text: "partial tweet"}))
+	assert.NoError(t, testSession.Get(&got, tw.ID))
+	assert.Equal(t, "omitempty", got.Timeline)
+	assert.Equal(t, "partial tweet", got.Text)
+
+	assert.NoError(t, testSession.Update(tweet{ID: tw.ID, Timeline: "updated"}).Columns("timeline", "text", "time").OmitEmpty().Exec())
+	assert.NoError(t, testSession.Get(&got, tw.ID))
+	assert.Equal(t, "updated", got.Timeline)
+	assert.Equal(t, "partial tweet", got.Text)
+	assert.Equal(t, tw.Time.Unix(), got.Time.Unix())
+}
+
 func TestSelectAllowFiltering(t *testing.T) {
 	initialize(t)
 	tiTime := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
@@ -670,6 +826,26 @@ func TestUpdateSet(t *testing.T) {
 	assert.Equal(t, int64(8), vw.Counter)
 }
 
+func TestUpdateCollections(t *testing.T) {
+	initialize(t)
+
+	u := user{ID: "ecql"}
+	assert.NoError(t, testSession.Update(u).Set("following", Append([]string{"zar"})).Exec())
+	assert.NoError(t, testSession.Update(u).Set("following", Prepend([]string{"zoo"})).Exec())
+	assert.NoError(t, testSession.Update(u).Set("following", Index(1, "fox")).Exec())
+	assert.NoError(t, testSession.Update(u).Set("following", Remove([]string{"bar"})).Exec())
+	assert.NoError(t, testSession.Update(u).Set("details", Put(map[string]string{"name": "ecql"})).Exec())
+	assert.NoError(t, testSession.Update(u).Set("details", Key("handle", "@maraino")).Exec())
+	assert.NoError(t, testSession.Update(u).Set("details", RemoveKeys([]string{"url"})).Exec())
+
+	assert.NoError(t, testSession.Get(&u, "ecql"))
+	assert.Equal(t, []string{"zoo", "fox", "zar"}, u.Following)
+	assert.Equal(t, map[string]string{"handle": "@maraino", "name": "ecql"}, u.Details)
+
+	err := testSession.Update(u).Set("following", Index(10, "fox")).Exec()
+	assert.Error(t, err)
+}
+
 func TestUpdateSetWhere(t *testing.T) {
 	initialize(t)
 
@@ -740,6 +916,70 @@ func TestUpdateIfExists(t *testing.T) {
 	assert.Equal(t, "foobar tweet", tw.Text)
 }
 
+func TestUpdateIf(t *testing.T) {
+	initialize(t)
+
+	tw := tweet{
+		ID: MustUUID("a5450908-17d7-11e6-b9ec-542696d5770f"),
+	}
+
+	err := testSession.Update(tw).Set("text", "foobar tweet").If(Eq("text", "bad text")).Exec()
+	if assert.IsType(t, &NotAppliedError{}, err) {
+		assert.Equal(t, "hello world!", err.(*NotAppliedError).Values["text"])
+	}
+
+	err = testSession.Update(tw).Set("text", "foobar tweet").If(Eq("text", "hello world!")).Exec()
+	assert.NoError(t, err)
+
+	err = testSession.Get(&tw, "a5450908-17d7-11e6-b9ec-542696d5770f")
+	assert.NoError(t, err)
+	assert.Equal(t, "foobar tweet", tw.Text)
+
+	err = testSession.Delete(tw).If(In("timeline", "foo", "bar")).Exec()
+	assert.IsType(t, &NotAppliedError{}, err)
+
+	err = testSession.Delete(tw).If(In("timeline", "foo", "ecql")).Exec()
+	assert.NoError(t, err)
+
+	err = testSession.Get(&tw, "a5450908-17d7-11e6-b9ec-542696d5770f")
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestVersion(t *testing.T) {
+	initialize(t)
+
+	doc := document{ID: gocql.TimeUUID().String(), Text: "first"}
+	err := testSession.Set(&doc)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, doc.Version)
+
+	// Stale insert
+	stale := document{ID: doc.ID, Text: "stale"}
+	err = testSession.Set(&stale)
+	assert.Equal(t, ErrConcurrentModification, err)
+	assert.Equal(t, 0, stale.Version)
+
+	doc.Text = "second"
+	err = testSession.Set(&doc)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, doc.Version)
+
+	err = testSession.Update(&doc).Set("text", "third").Exec()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, doc.Version)
+
+	// Stale update
+	stale.Version = 2
+	err = testSession.Update(&stale).Set("text", "stale").Exec()
+	assert.Equal(t, ErrConcurrentModification, err)
+	assert.Equal(t, 2, stale.Version)
+
+	var d document
+	err = testSession.Get(&d, doc.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, document{ID: doc.ID, Text: "third", Version: 3}, d)
+}
+
 func TestCount(t *testing.T) {
 	initialize(t)
 
@@ -818,6 +1058,114 @@ func TestBatch(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestBatchApplyCAS(t *testing.T) {
+	initialize(t)
+
+	tw := tweet{
+		ID:       gocql.TimeUUID(),
+		Timeline: "me",
+		Text:     "Conditional tweet",
+		Time:     Now().UTC(),
+	}
+	assert.NoError(t, testSession.Set(tw))
+
+	// Applied
+	applied, rows, err := testSession.Batch().Add(testSession.Update(tw).Set("text", tw.Text).If(Eq("text", tw.Text))).MapApplyCAS()
+	assert.NoError(t, err)
+	assert.True(t, applied)
+	assert.Empty(t, rows)
+
+	// Not applied returns the primary key and the columns in the conditions
+	batch := testSession.Batch().Add(testSession.Update(tw).Set("text", "new text").If(Eq("text", "bad text")))
+	applied, rows, err = batch.MapApplyCAS()
+	assert.NoError(t, err)
+	assert.False(t, applied)
+	assert.Equal(t, []map[string]interface{}{{"id": tw.ID, "text": tw.Text}}, rows)
+
+	var tweets []tweet
+	applied, err = batch.TypeApplyCAS(&tweets)
+	assert.NoError(t, err)
+	assert.False(t, applied)
+	assert.Equal(t, []tweet{{ID: tw.ID, Text: tw.Text}}, tweets)
+
+	// Not applied on rows that do not exist
+	applied, rows, err = testSession.Batch().Add(testSession.Update(tweet{ID: gocql.TimeUUID()}).Set("text", "text").If(Eq("text", "text"))).MapApplyCAS()
+	assert.NoError(t, err)
+	assert.False(t, applied)
+	assert.Empty(t, rows)
+}
+
+func TestBatchWriter(t *testing.T) {
+	initialize(t)
+
+	timeline := gocql.TimeUUID().String()
+	w := NewBatchWriter(testSession).MaxStatements(20).Concurrency(2)
+	var ids []gocql.UUID
+	for i := 0; i < 50; i++ {
+		tw := tweet{
+			ID:       gocql.TimeUUID(),
+			Timeline: timeline,
+			Text:     fmt.Sprintf("Tweet %d", i),
+			Time:     Now().UTC(),
+		}
+		ids = append(ids, tw.ID)
+		assert.NoError(t, w.Write(testSession.Insert(tw)))
+	}
+
+	vw := views{ID: gocql.TimeUUID()}
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, w.Write(testSession.Update(vw).Set("counter", Inc(1))))
+	}
+	assert.NoError(t, w.Close())
+
+	for _, id := range ids {
+		var tw tweet
+		assert.NoError(t, testSession.Get(&tw, id))
+		assert.Equal(t, timeline, tw.Timeline)
+	}
+	assert.NoError(t, testSession.Get(&vw, vw.ID))
+	assert.Equal(t, int64(10), vw.Counter)
+}
+
+func TestBatchTypes(t *testing.T) {
+	initialize(t)
+
+	tw := tweet{
+		ID:       gocql.TimeUUID(),
+		Timeline: "me",
+		Text:     "Unlogged tweet",
+		Time:     Now().UTC(),
+	}
+
+	// Unlogged batch with a timestamp
+	ts := Now().UnixNano() / 1000
+	batch := testSession.UnloggedBatch().Add(testSession.Insert(tw)).Timestamp(ts)
+	assert.Equal(t, 1, batch.Size())
+	assert.NoError(t, batch.Apply())
+
+	var got tweet
+	assert.NoError(t, testSession.Get(&got, tw.ID))
+	assert.Equal(t, tw, got)
+
+	// Statements with an older timestamp are ignored
+	assert.NoError(t, testSession.Update(tw).Set("text", "old text").Timestamp(ts-1).Exec())
+	assert.NoError(t, testSession.Get(&got, tw.ID))
+	assert.Equal(t, tw.Text, got.Text)
+
+	// Counter batch
+	vw := views{ID: gocql.TimeUUID()}
+	batch = testSession.CounterBatch().Add(
+		testSession.Update(vw).Set("counter", Inc(2)),
+		testSession.Update(vw).Set("counter", Inc(3)),
+	)
+	assert.NoError(t, batch.Apply())
+	assert.NoError(t, testSession.Get(&vw, vw.ID))
+	assert.Equal(t, int64(5), vw.Counter)
+
+	// Counter updates are not allowed in logged batches
+	assert.Error(t, testSession.Batch().Add(testSession.Update(vw).Set("counter", Inc(1))).Apply())
+}
+
 func TestRaw(t *testing.T) {
 	initialize(t)
 
@@ -854,6 +1202,107 @@ func TestRaw(t *testing.T) {
 	assert.NoError(t, iter.Close())
 }
 
+func TestUserDefinedTypes(t *testing.T) {
+	// Supported on 3.2.0
+	if cqlVersion[0] < 3 || (cqlVersion[0] == 3 && cqlVersion[1] < 2) {
+		t.Skip("user-defined types are not supported")
+	}
+
+	p := place{
+		ID:      gocql.TimeUUID().String(),
+		Address: address{Street: "1 Main St", City: "San Francisco"},
+	}
+
+	err := testSession.Set(p)
+	assert.NoError(t, err)
+
+	var pp place
+	err = testSession.Get(&pp, p.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, p, pp)
+
+	p.ID = gocql.TimeUUID().String()
+	err = testSession.Insert(p).Exec()
+	assert.NoError(t, err)
+
+	pp = place{}
+	err = testSession.Select(&pp).Where(Eq("id", p.ID)).TypeScan()
+	assert.NoError(t, err)
+	assert.Equal(t, p, pp)
+}
+
+func TestValidateSchema(t *testing.T) {
+	type badTweet struct {
+		ID   gocql.UUID `cql:"id" cqltable:"tweet" cqlkey:"id"`
+		Text int        `cql:"text"`
+		Body string     `cql:"body"`
+	}
+
+	DeleteRegistry()
+	defer DeleteRegistry()
+
+	Register(tweet{})
+	Register(timeline{})
+	Register(views{})
+	assert.NoError(t, testSession.ValidateSchema("test_ecql"))
+
+	Register(badTweet{})
+	err := testSession.ValidateSchema("test_ecql")
+	if assert.IsType(t, &SchemaError{}, err) {
+		diffs := err.(*SchemaError).Diffs
+		assert.Len(t, diffs, 1)
+		assert.Equal(t, []string{"body"}, diffs[0].MissingColumns)
+		assert.Equal(t, []string{"time", "timeline"}, diffs[0].UnmappedColumns)
+		assert.Equal(t, []TypeMismatch{{"text", "bigint", "text"}}, diffs[0].TypeMismatches)
+	}
+}
+
+func TestContext(t *testing.T) {
+	initialize(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var tw tweet
+	err := testSession.GetContext(ctx, &tw, MustUUID("a5450908-17d7-11e6-b9ec-542696d5770f"))
+	assert.Equal(t, context.Canceled, err)
+
+	err = testSession.Select(&tw).Where(Eq("id", MustUUID("a5450908-17d7-11e6-b9ec-542696d5770f"))).TypeScanContext(ctx)
+	assert.Equal(t, context.Canceled, err)
+
+	iter := testSession.Select(&tw).IterContext(ctx)
+	assert.False(t, iter.TypeScan(&tw))
+	assert.Equal(t, context.Canceled, iter.Close())
+
+	err = testSession.Batch().Add(testSession.Insert(tw)).ApplyContext(ctx)
+	assert.Equal(t, context.Canceled, err)
+
+	err = testSession.GetContext(context.Background(), &tw, MustUUID("a5450908-17d7-11e6-b9ec-542696d5770f"))
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world!", tw.Text)
+}
+
+func TestPage(t *testing.T) {
+	initialize(t)
+
+	var texts []string
+	var cursor string
+	for i := 0; i < 3; i++ {
+		var tweets []tweet
+		next, err := testSession.Select(tweet{}).PageSize(1).Page(&tweets, cursor)
+		assert.NoError(t, err)
+		for _, tw := range tweets {
+			texts = append(texts, tw.Text)
+		}
+		if cursor = next; cursor == "" {
+			break
+		}
+	}
+	assert.Len(t, texts, 2)
+	assert.Contains(t, texts, "hello world!")
+	assert.Contains(t, texts, "ciao world!")
+}
+
 func TestMain(m *testing.M) {
 	flag.Parse()
 
@@ -905,11 +1354,14 @@ func TestMain(m *testing.M) {
 		"CREATE TABLE tweet (id uuid PRIMARY KEY, timeline text, text text, time timestamp)",
 		"CREATE TABLE timeline (id text, time timestamp, tweet uuid, PRIMARY KEY(id, time))",
 		"CREATE TABLE views (id uuid PRIMARY KEY, counter counter)",
+		"CREATE TABLE documents (id text PRIMARY KEY, text text, version int)",
 	}
 	// Supported on 3.2.0
 	if cqlVersion[0] > 3 || (cqlVersion[0] >= 3 && cqlVersion[1] >= 2) {
 		stmts = append(stmts, "CREATE INDEX ON users (following)")
 		stmts = append(stmts, "CREATE INDEX ON users (keys(details))")
+		stmts = append(stmts, "CREATE TYPE address (street text, city text)")
+		stmts = append(stmts, "CREATE TABLE places (id text PRIMARY KEY, address frozen<address>)")
 	}
 	for _, stmt := range stmts {
 		if err := sess2.Query(stmt).Exec(); err != nil {
@@ -1,37 +1,74 @@
 package ecql
 
 import (
-	"github.com/gocql/gocql"
+	"context"
 )
 
 type Iter interface {
 	TypeScan(i interface{}) bool
+	Scan(i ...interface{}) bool
+	PageState() []byte
 	Close() error
 }
 
 type IterImpl struct {
-	iter      *gocql.Iter
+	iter      Rows
 	statement *StatementImpl
-	query     *gocql.Query
+	query     Query
+	ctx       context.Context
+	cancel    context.CancelFunc
 	err       error
 }
 
 func (it *IterImpl) TypeScan(i interface{}) bool {
 	m := Map(i)
-	if it.iter == nil {
-		if query, err := it.statement.query(); err != nil {
-			it.err = err
-			return false
-		} else {
-			it.iter = query.Iter()
-		}
+	if !it.start() {
+		return false
 	}
 	return it.iter.MapScan(m)
 }
 
+// Scan copies the columns of the next row into the values pointed by i, it
+// returns false if there are no more rows or on errors.
+func (it *IterImpl) Scan(i ...interface{}) bool {
+	if !it.start() {
+		return false
+	}
+	return it.iter.Scan(i...)
+}
+
+// PageState returns the paging state to get the next page of results using
+// Statement.PageState, or nil if there are no more pages.
+func (it *IterImpl) PageState() []byte {
+	if !it.start() {
+		return nil
+	}
+	return it.iter.PageState()
+}
+
 func (it *IterImpl) Close() error {
+	if it.cancel != nil {
+		defer it.cancel()
+	}
 	if it.err != nil {
 		return it.err
 	}
+	if it.iter == nil {
+		return nil
+	}
 	return it.iter.Close()
 }
+
+// start executes the query if it has not been executed yet.
+func (it *IterImpl) start() bool {
+	if it.iter == nil && it.err == nil {
+		var ctx context.Context
+		ctx, it.cancel = it.statement.withTimeout(it.ctx)
+		if query, err := it.statement.query(ctx); err != nil {
+			it.err = err
+		} else {
+			it.iter = query.Iter()
+		}
+	}
+	return it.err == nil
+}
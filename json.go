@@ -0,0 +1,94 @@
+package ecql
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// encodeJSON returns the JSON document used in INSERT JSON statements with
+// the given columns and values of a mapped struct.
+func encodeJSON(columns []string, mapping map[string]interface{}) (string, error) {
+	doc := make(map[string]interface{}, len(columns))
+	for _, col := range columns {
+		doc[col] = jsonValue(mapping[col])
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// jsonValue converts a value to the representation used by Cassandra in JSON
+// documents: timestamps are encoded as milliseconds, blobs as hexadecimal
+// strings and user-defined types as objects with the names of the columns.
+func jsonValue(v interface{}) interface{} {
+	switch vv := v.(type) {
+	case nil:
+		return nil
+	case time.Time:
+		if vv.IsZero() {
+			return nil
+		}
+		return vv.UnixNano() / int64(time.Millisecond)
+	case gocql.UUID:
+		return vv.String()
+	case []byte:
+		if vv == nil {
+			return nil
+		}
+		return "0x" + hex.EncodeToString(vv)
+	case UDT:
+		return udtJSON(vv.value)
+	case json.Marshaler:
+		return vv
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return nil
+		}
+		return jsonValue(rv.Elem().Interface())
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return nil
+		}
+		list := make([]interface{}, rv.Len())
+		for i := range list {
+			list[i] = jsonValue(valueOf(rv.Index(i)))
+		}
+		return list
+	case reflect.Map:
+		if rv.IsNil() {
+			return nil
+		}
+		m := make(map[string]interface{}, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			m[fmt.Sprint(jsonValue(iter.Key().Interface()))] = jsonValue(valueOf(iter.Value()))
+		}
+		return m
+	case reflect.Struct:
+		if isUDT(rv.Type()) {
+			return udtJSON(rv)
+		}
+	}
+	return v
+}
+
+// udtJSON returns the JSON object of a user-defined type.
+func udtJSON(v reflect.Value) map[string]interface{} {
+	table := getUDT(v.Type())
+	m := make(map[string]interface{}, len(table.Columns))
+	for _, col := range table.Columns {
+		m[col.Name] = jsonValue(valueOf(v.FieldByIndex(col.Position)))
+	}
+	return m
+}
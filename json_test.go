@@ -0,0 +1,87 @@
+package ecql
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildQueryJSON(t *testing.T) {
+	DeleteRegistry()
+
+	sess := &SessionImpl{}
+	s := "foo"
+	v := testStruct{F1: "bar", F2: 10, F4: &s}
+	var tests = []struct {
+		stmt Statement
+		cql  string
+		args []interface{}
+	}{
+		{
+			sess.Select(testStruct{}).JSON().Where(Eq("f1", "bar")),
+			"SELECT JSON f1,f22,f3,f4 FROM mytable WHERE f1 = ?",
+			[]interface{}{"bar"},
+		},
+		{
+			sess.Select(testStruct{}).JSON().Distinct(),
+			"SELECT JSON DISTINCT f1 FROM mytable",
+			nil,
+		},
+		{
+			sess.Insert(v).JSON(),
+			"INSERT INTO mytable JSON ? DEFAULT UNSET",
+			[]interface{}{`{"f1":"bar","f22":10,"f3":null,"f4":"foo"}`},
+		},
+		{
+			sess.Insert(v).Columns("f1", "f22").JSON().TTL(60),
+			"INSERT INTO mytable JSON ? DEFAULT UNSET USING TTL 60",
+			[]interface{}{`{"f1":"bar","f22":10}`},
+		},
+		{
+			sess.Insert(testStruct{}).BindJSON(json.RawMessage(`{"f1":"raw"}`)).IfNotExists(),
+			"INSERT INTO mytable JSON ? DEFAULT UNSET IF NOT EXISTS",
+			[]interface{}{`{"f1":"raw"}`},
+		},
+	}
+
+	for _, tc := range tests {
+		cql, args := tc.stmt.BuildQuery()
+		assert.Equal(t, tc.cql, cql)
+		assert.Equal(t, tc.args, args)
+	}
+}
+
+func TestEncodeJSON(t *testing.T) {
+	DeleteRegistry()
+
+	id := MustUUID("a5450908-17d7-11e6-b9ec-542696d5770f")
+	ts := time.Unix(1462800000, 123000000)
+	var tests = []struct {
+		columns []string
+		mapping map[string]interface{}
+		json    string
+	}{
+		{[]string{"a", "b"}, map[string]interface{}{"a": 1, "b": "text"}, `{"a":1,"b":"text"}`},
+		{[]string{"a"}, map[string]interface{}{"a": 1, "b": "text"}, `{"a":1}`},
+		{[]string{"id", "time"}, map[string]interface{}{"id": id, "time": ts}, `{"id":"a5450908-17d7-11e6-b9ec-542696d5770f","time":1462800000123}`},
+		{[]string{"time"}, map[string]interface{}{"time": time.Time{}}, `{"time":null}`},
+		{[]string{"blob"}, map[string]interface{}{"blob": []byte{0xca, 0xfe}}, `{"blob":"0xcafe"}`},
+		{[]string{"list"}, map[string]interface{}{"list": []gocql.UUID{id}}, `{"list":["a5450908-17d7-11e6-b9ec-542696d5770f"]}`},
+		{[]string{"map"}, map[string]interface{}{"map": map[int]string{1: "one"}}, `{"map":{"1":"one"}}`},
+		{[]string{"ptr"}, map[string]interface{}{"ptr": (*string)(nil)}, `{"ptr":null}`},
+		{
+			[]string{"address"},
+			map[string]interface{}{"address": testAddress{Street: "Main St", Zip: 94107, Geo: testGeo{Lat: 1.5, Lon: -2}}},
+			`{"address":{"geo":{"lat":1.5,"lon":-2},"street":"Main St","zip":94107}}`,
+		},
+	}
+
+	for _, tc := range tests {
+		doc, err := encodeJSON(tc.columns, tc.mapping)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.json, doc)
+	}
+}
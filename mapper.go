@@ -4,12 +4,26 @@ import (
 	"reflect"
 	"strings"
 	"sync"
+
+	"github.com/gocql/gocql"
 )
 
 var (
 	// TAG_COLUMNS is the tag used in the structs to set the column name for a field.
 	// If a name is not set, the name would be the lowercase version of the field.
 	// If you want to skip a field you can use `cql:"-"`
+	//
+	// The name can be followed by a comma separated list of options used to
+	// generate the schema: `static` for static columns, and `asc` or `desc`
+	// for the clustering order of clustering columns: `cql:"time,desc"`
+	//
+	// The options `writetime=col` and `ttl=col` define a read-only field
+	// populated with the write time or the time to live of another column
+	// on SELECT statements: `cql:"text_written,writetime=text"`
+	//
+	// The option `omitempty` binds an unset value instead of the value of
+	// the field if it is empty, so INSERT and UPDATE statements do not
+	// modify the column and do not create tombstones: `cql:"bio,omitempty"`
 	TAG_COLUMN = "cql"
 
 	// TAG_TABLE is the tag used in the structs to define the table for a type.
@@ -19,7 +33,31 @@ var (
 	// TAG_KEY defines the primary key for the table.
 	// If the table uses a composite key you just need to define multiple columns
 	// separated by a comma: `cqlkey:"id"` or `cqlkey:"partkey,id"`
+	// The first column is the partition key, to define a composite partition
+	// key enclose its columns in parentheses: `cqlkey:"(tenant,bucket),id"`
 	TAG_KEY = "cqlkey"
+
+	// TAG_VERSION defines the column used for optimistic locking. The column
+	// must be an integer, Session.Set and Session.Update will only modify the
+	// row if the version in the database matches the version in the struct,
+	// and the version will be increased on success: `cqlversion:"version"`
+	TAG_VERSION = "cqlversion"
+
+	// TAG_PREFIX defines the prefix added to the column names of an embedded
+	// struct. Embedded structs are flattened into the columns of the table,
+	// so common groups of fields can be reused across tables:
+	// `cqlprefix:"audit_"`
+	TAG_PREFIX = "cqlprefix"
+
+	// TAG_TYPE overrides the CQL type inferred from the field type when the
+	// schema is generated: `cqltype:"timeuuid"` or `cqltype:"set<text>"`
+	TAG_TYPE = "cqltype"
+
+	// TAG_CONSISTENCY defines the default consistency used in the statements
+	// of a type, optionally followed by the serial consistency used in
+	// conditional statements: `cqlconsistency:"local_quorum"` or
+	// `cqlconsistency:"local_quorum,local_serial"`
+	TAG_CONSISTENCY = "cqlconsistency"
 )
 
 var registry = newSyncRegistry()
@@ -27,20 +65,58 @@ var registry = newSyncRegistry()
 type syncRegistry struct {
 	sync.RWMutex
 	data map[reflect.Type]Table
+	udts map[reflect.Type]bool
+	regs map[reflect.Type]bool
 }
 
 func newSyncRegistry() *syncRegistry {
 	return &syncRegistry{
 		data: make(map[reflect.Type]Table),
+		udts: make(map[reflect.Type]bool),
+		regs: make(map[reflect.Type]bool),
 	}
 }
 
 func (r *syncRegistry) clear() {
 	r.Lock()
 	r.data = make(map[reflect.Type]Table)
+	r.udts = make(map[reflect.Type]bool)
+	r.regs = make(map[reflect.Type]bool)
 	r.Unlock()
 }
 
+// setRegistered marks t as explicitly registered using Register.
+func (r *syncRegistry) setRegistered(t reflect.Type) {
+	r.Lock()
+	r.regs[t] = true
+	r.Unlock()
+}
+
+func (r *syncRegistry) setUDT(t reflect.Type) {
+	r.RLock()
+	ok := r.udts[t]
+	r.RUnlock()
+	if !ok {
+		r.Lock()
+		r.udts[t] = true
+		r.Unlock()
+	}
+}
+
+// tables returns the types explicitly registered using Register that are not
+// used as user-defined types.
+func (r *syncRegistry) tables() map[reflect.Type]Table {
+	r.RLock()
+	tables := make(map[reflect.Type]Table)
+	for t, table := range r.data {
+		if r.regs[t] && !r.udts[t] {
+			tables[t] = table
+		}
+	}
+	r.RUnlock()
+	return tables
+}
+
 func (r *syncRegistry) set(t reflect.Type, table Table) {
 	r.Lock()
 	r.data[t] = table
@@ -67,6 +143,7 @@ func DeleteRegistry() {
 // field name. You can skip the mapping of one field using the tag `cql:"-"`
 func Register(i interface{}) {
 	register(i)
+	registry.setRegistered(structOf(i).Type())
 }
 
 // Map creates a new map[string]interface{} where each member in the map
@@ -106,12 +183,14 @@ func MapTable(i interface{}) (map[string]interface{}, Table) {
 	}
 
 	columns := make(map[string]interface{})
-	for _, col := range table.Columns {
-		field := v.Field(col.Position)
-		if field.CanAddr() {
-			columns[col.Name] = field.Addr().Interface()
-		} else {
-			columns[col.Name] = field.Interface()
+	for _, list := range [][]Column{table.Columns, table.Selectors} {
+		for _, col := range list {
+			field := v.FieldByIndex(col.Position)
+			if field.CanAddr() {
+				columns[col.Name] = addrOf(field)
+			} else {
+				columns[col.Name] = valueOf(field)
+			}
 		}
 	}
 	return columns, table
@@ -138,13 +217,29 @@ func BindTable(i interface{}) ([]interface{}, map[string]interface{}, Table) {
 	columns := make([]interface{}, len(table.Columns))
 	mapping := make(map[string]interface{})
 	for i, col := range table.Columns {
-		field := v.Field(col.Position)
-		columns[i] = field.Interface()
+		field := v.FieldByIndex(col.Position)
+		if col.OmitEmpty && isEmpty(field) && !table.isKey(col.Name) && col.Name != table.VersionColumn {
+			columns[i] = gocql.UnsetValue
+		} else {
+			columns[i] = valueOf(field)
+		}
 		mapping[col.Name] = columns[i]
 	}
 	return columns, mapping, table
 }
 
+// isEmpty returns true if v is the zero value of its type or an empty slice
+// or map.
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Invalid:
+		return true
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
+
 // GetTable returns the Table with the information about the type of i.
 func GetTable(i interface{}) Table {
 	v := structOf(i)
@@ -159,6 +254,82 @@ func GetTable(i interface{}) Table {
 	return table
 }
 
+// version contains the information required to perform an optimistic
+// locking update on the version column of a struct.
+type version struct {
+	Column  string
+	Current interface{}
+	Next    interface{}
+	field   reflect.Value
+}
+
+// increment sets the next version in the struct if the field is settable.
+func (v *version) increment() {
+	if v.field.CanSet() {
+		v.field.Set(reflect.ValueOf(v.Next))
+	}
+}
+
+// versionOf returns the version information of i or nil if the type of i
+// does not define a version column. It returns ErrInvalidVersion if the
+// version column is not mapped to an integer field.
+func versionOf(i interface{}) (*version, error) {
+	v := structOf(i)
+	table := GetTable(i)
+	if table.VersionColumn == "" {
+		return nil, nil
+	}
+
+	for _, col := range table.Columns {
+		if col.Name != table.VersionColumn {
+			continue
+		}
+
+		field := v.FieldByIndex(col.Position)
+		next := reflect.New(field.Type()).Elem()
+		switch field.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			next.SetInt(field.Int() + 1)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			next.SetUint(field.Uint() + 1)
+		default:
+			return nil, ErrInvalidVersion
+		}
+
+		return &version{
+			Column:  col.Name,
+			Current: field.Interface(),
+			Next:    next.Interface(),
+			field:   field,
+		}, nil
+	}
+
+	return nil, ErrInvalidVersion
+}
+
+// getUDT returns the Table for the struct type t used as a user-defined type,
+// registering it if necessary.
+func getUDT(t reflect.Type) Table {
+	table, ok := registry.get(t)
+	if !ok {
+		table = register(reflect.New(t).Interface())
+	}
+	registry.setUDT(t)
+	return table
+}
+
+// isStruct returns true if i is a struct or a pointer to a struct.
+func isStruct(i interface{}) bool {
+	v := reflect.ValueOf(i)
+	switch v.Kind() {
+	case reflect.Struct:
+		return true
+	case reflect.Ptr, reflect.Interface:
+		return v.Elem().Kind() == reflect.Struct
+	}
+	return false
+}
+
 func structOf(i interface{}) reflect.Value {
 	v := reflect.ValueOf(i)
 	switch v.Kind() {
@@ -181,9 +352,28 @@ func register(i interface{}) Table {
 	// Table name defaults to the type name.
 	var table Table
 	table.Name = t.Name()
+	registerFields(&table, t, nil, "")
+
+	// If no key is explicitly given, assume the first field is implicitly the key
+	if len(table.KeyColumns) == 0 && len(table.Columns) > 0 {
+		table.KeyColumns = []string{table.Columns[0].Name}
+		table.PartitionKey = []string{table.Columns[0].Name}
+	}
+
+	registry.set(t, table)
+	return table
+}
 
+// registerFields adds the fields of the struct type t to the table. Embedded
+// structs are flattened, index is the index path of t in the registered type
+// and prefix is added to the name of the columns.
+func registerFields(table *Table, t reflect.Type, index []int, prefix string) {
 	for i, n := 0, t.NumField(); i < n; i++ {
 		field := t.Field(i)
+		position := make([]int, len(index)+1)
+		copy(position, index)
+		position[len(index)] = i
+
 		// Get table if available
 		name := field.Tag.Get(TAG_TABLE)
 		if name != "" {
@@ -193,24 +383,150 @@ func register(i interface{}) Table {
 		// Get the key columns
 		name = field.Tag.Get(TAG_KEY)
 		if name != "" {
-			table.KeyColumns = strings.Split(name, ",")
+			table.PartitionKey, table.ClusteringColumns = parseKey(name)
+			table.KeyColumns = append(append([]string{}, table.PartitionKey...), table.ClusteringColumns...)
+		}
+
+		// Get the version column
+		name = field.Tag.Get(TAG_VERSION)
+		if name != "" {
+			table.VersionColumn = name
+		}
+
+		// Get the default consistency
+		name = field.Tag.Get(TAG_CONSISTENCY)
+		if name != "" {
+			var err error
+			if table.Consistency, table.SerialConsistency, err = parseConsistency(name); err != nil {
+				table.err, table.errDetail = ErrInvalidConsistency, name
+			}
 		}
 
 		// Get columns or field name
-		name = field.Tag.Get(TAG_COLUMN)
+		name, options := parseTag(field.Tag.Get(TAG_COLUMN))
+		if name == "-" {
+			continue
+		}
+
+		// Flatten embedded structs
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			registerFields(table, field.Type, position, prefix+field.Tag.Get(TAG_PREFIX))
+			continue
+		}
+
+		// Skip unexported fields
+		if field.PkgPath != "" {
+			continue
+		}
+
+		// Register user-defined types
+		if isUDT(field.Type) {
+			getUDT(field.Type)
+		}
+
 		if name == "" {
 			name = strings.ToLower(field.Name)
 		}
-		if name != "-" {
-			table.Columns = append(table.Columns, Column{name, i})
+		col := Column{
+			Name:     prefix + name,
+			Position: position,
+			Type:     field.Tag.Get(TAG_TYPE),
+		}
+		for _, opt := range options {
+			opt, arg := parseOption(opt)
+			switch opt {
+			case "static":
+				col.Static = true
+			case "asc":
+				col.Order = AscOrder
+			case "desc":
+				col.Order = DescOrder
+			case "writetime":
+				col.Selector = WriteTime(prefix + arg)
+			case "ttl":
+				col.Selector = TTLOf(prefix + arg)
+			case "omitempty":
+				col.OmitEmpty = true
+			}
+		}
+		if col.Selector != "" {
+			table.Selectors = append(table.Selectors, col)
+		} else {
+			table.Columns = append(table.Columns, col)
 		}
 	}
+}
 
-	// If no key is explicitly given, assume the first field is implicitly the key
-	if len(table.KeyColumns) == 0 && len(table.Columns) > 0 {
-		table.KeyColumns = []string{table.Columns[0].Name}
+// parseConsistency parses a consistency tag, it returns an error if the
+// consistency levels are not valid.
+func parseConsistency(tag string) (*gocql.Consistency, *gocql.SerialConsistency, error) {
+	var consistency *gocql.Consistency
+	var serial *gocql.SerialConsistency
+
+	parts := strings.Split(tag, ",")
+	if name := strings.TrimSpace(parts[0]); name != "" {
+		c, err := gocql.ParseConsistencyWrapper(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		consistency = &c
+	}
+	if len(parts) > 1 {
+		var c gocql.SerialConsistency
+		if err := c.UnmarshalText([]byte(strings.ToUpper(strings.TrimSpace(parts[1])))); err != nil {
+			return nil, nil, err
+		}
+		serial = &c
 	}
 
-	registry.set(t, table)
-	return table
+	return consistency, serial, nil
+}
+
+// parseKey splits a key tag in the partition key and the clustering columns.
+func parseKey(tag string) ([]string, []string) {
+	var partition, clustering []string
+	tag = strings.TrimSpace(tag)
+	if strings.HasPrefix(tag, "(") {
+		if i := strings.Index(tag, ")"); i > 0 {
+			partition = splitColumns(tag[1:i])
+			clustering = splitColumns(strings.TrimPrefix(strings.TrimSpace(tag[i+1:]), ","))
+			return partition, clustering
+		}
+	}
+
+	columns := splitColumns(tag)
+	if len(columns) > 0 {
+		partition = columns[:1]
+	}
+	if len(columns) > 1 {
+		clustering = columns[1:]
+	}
+	return partition, clustering
+}
+
+// splitColumns splits a comma separated list of columns.
+func splitColumns(s string) []string {
+	var columns []string
+	for _, col := range strings.Split(s, ",") {
+		if col = strings.TrimSpace(col); col != "" {
+			columns = append(columns, col)
+		}
+	}
+	return columns
+}
+
+// parseTag splits a column tag in the name and the list of options.
+func parseTag(tag string) (string, []string) {
+	parts := strings.Split(tag, ",")
+	return parts[0], parts[1:]
+}
+
+// parseOption splits a column option in the lowercase name and the argument:
+// `writetime=text`
+func parseOption(opt string) (string, string) {
+	parts := strings.SplitN(opt, "=", 2)
+	if len(parts) == 1 {
+		return strings.ToLower(strings.TrimSpace(opt)), ""
+	}
+	return strings.ToLower(strings.TrimSpace(parts[0])), strings.TrimSpace(parts[1])
 }
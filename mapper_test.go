@@ -1,9 +1,12 @@
 package ecql
 
 import (
+	"errors"
 	"reflect"
 	"testing"
+	"time"
 
+	"github.com/gocql/gocql"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -33,10 +36,12 @@ func TestRegister(t *testing.T) {
 		assert.True(t, ok)
 		assert.Equal(t, "mytable", table.Name)
 		assert.Equal(t, []string{"f1"}, table.KeyColumns)
+		assert.Equal(t, []string{"f1"}, table.PartitionKey)
+		assert.Empty(t, table.ClusteringColumns)
 		assert.Len(t, table.Columns, 4)
 		for i := range testStructNames {
 			assert.Equal(t, testStructNames[i], table.Columns[i].Name)
-			assert.Equal(t, i, table.Columns[i].Position)
+			assert.Equal(t, []int{i}, table.Columns[i].Position)
 		}
 	}
 }
@@ -126,6 +131,41 @@ func TestBind(t *testing.T) {
 	assert.Equal(t, exp, m)
 }
 
+type testOmitEmptyStruct struct {
+	ID      string            `cql:"id,omitempty" cqltable:"omit" cqlkey:"id" cqlversion:"version"`
+	Name    string            `cql:"name,omitempty"`
+	Tags    []string          `cql:"tags,omitempty"`
+	Details map[string]string `cql:"details,omitempty"`
+	Time    time.Time         `cql:"time,omitempty"`
+	Ptr     *int              `cql:"ptr,omitempty"`
+	Address testAddress       `cql:"address,omitempty"`
+	Count   int               `cql:"count"`
+	Version int               `cql:"version,omitempty"`
+}
+
+func TestBindOmitEmpty(t *testing.T) {
+	DeleteRegistry()
+
+	table := GetTable(testOmitEmptyStruct{})
+	for _, col := range table.Columns {
+		assert.Equal(t, col.Name != "count", col.OmitEmpty, col.Name)
+	}
+
+	// Keys and versions are always bound
+	unset := gocql.UnsetValue
+	values := Bind(testOmitEmptyStruct{})
+	assert.Equal(t, []interface{}{"", unset, unset, unset, unset, unset, unset, 0, 0}, values)
+
+	n := 0
+	now := time.Now()
+	v := testOmitEmptyStruct{ID: "id", Name: "name", Tags: []string{}, Details: map[string]string{"a": "b"}, Time: now, Ptr: &n, Address: testAddress{Zip: 1}}
+	values, mapping, _ := BindTable(v)
+	assert.Equal(t, []interface{}{"id", "name", unset, map[string]string{"a": "b"}, now, &n}, values[:6])
+	assert.IsType(t, UDT{}, values[6])
+	assert.Equal(t, unset, mapping["tags"])
+	assert.Equal(t, 0, mapping["count"])
+}
+
 func TestGetTable(t *testing.T) {
 	DeleteRegistry()
 	// With registry and passing as a value
@@ -157,3 +197,186 @@ func TestStructOfPanic2(t *testing.T) {
 	s := "string"
 	Register(&s)
 }
+
+type testVersionStruct struct {
+	ID      string `cql:"id" cqltable:"versioned" cqlkey:"id" cqlversion:"version"`
+	Text    string `cql:"text"`
+	Version int    `cql:"version"`
+}
+
+func TestVersionOf(t *testing.T) {
+	DeleteRegistry()
+
+	ver, err := versionOf(testStruct{})
+	assert.NoError(t, err)
+	assert.Nil(t, ver)
+
+	v := testVersionStruct{ID: "foo", Version: 2}
+	ver, err = versionOf(&v)
+	assert.NoError(t, err)
+	assert.Equal(t, "version", GetTable(v).VersionColumn)
+	assert.Equal(t, "version", ver.Column)
+	assert.Equal(t, 2, ver.Current)
+	assert.Equal(t, 3, ver.Next)
+
+	ver.increment()
+	assert.Equal(t, 3, v.Version)
+
+	// Not addressable
+	ver, err = versionOf(v)
+	assert.NoError(t, err)
+	ver.increment()
+	assert.Equal(t, 3, v.Version)
+
+	// Invalid version columns
+	_, err = versionOf(testInvalidVersionStruct{})
+	assert.Equal(t, ErrInvalidVersion, err)
+	_, err = versionOf(testUnmappedVersionStruct{})
+	assert.Equal(t, ErrInvalidVersion, err)
+}
+
+type testInvalidVersionStruct struct {
+	ID      string `cql:"id" cqltable:"invalid_version" cqlkey:"id" cqlversion:"version"`
+	Version string `cql:"version"`
+}
+
+type testUnmappedVersionStruct struct {
+	ID      string `cql:"id" cqltable:"unmapped_version" cqlkey:"id" cqlversion:"version"`
+	Version int    `cql:"-"`
+}
+
+func TestSetVersionErrors(t *testing.T) {
+	DeleteRegistry()
+
+	sess := &SessionImpl{}
+	assert.Equal(t, ErrNotPointer, sess.Set(testVersionStruct{ID: "foo"}))
+	assert.Equal(t, ErrInvalidVersion, sess.Set(&testInvalidVersionStruct{ID: "foo"}))
+	assert.Equal(t, ErrInvalidVersion, sess.Set(&testUnmappedVersionStruct{ID: "foo"}))
+
+	err := sess.Update(&testInvalidVersionStruct{ID: "foo"}).Err()
+	assert.True(t, errors.Is(err, ErrInvalidVersion))
+	err = sess.Update(&testUnmappedVersionStruct{ID: "foo"}).Err()
+	assert.True(t, errors.Is(err, ErrInvalidVersion))
+}
+
+type testAudit struct {
+	CreatedBy string `cql:"created_by"`
+	UpdatedBy string
+}
+
+type testEmbeddedStruct struct {
+	ID string `cql:"id" cqltable:"embedded" cqlkey:"id"`
+	testAudit
+	Owner  testAudit `cql:"-"`
+	Parent testAudit
+	hidden string
+}
+
+type testPrefixedStruct struct {
+	ID        string `cql:"id" cqltable:"prefixed"`
+	testAudit `cqlprefix:"audit_"`
+}
+
+func TestRegisterEmbedded(t *testing.T) {
+	DeleteRegistry()
+
+	table := GetTable(testEmbeddedStruct{})
+	assert.Equal(t, "embedded", table.Name)
+	assert.Equal(t, []Column{
+		{Name: "id", Position: []int{0}},
+		{Name: "created_by", Position: []int{1, 0}},
+		{Name: "updatedby", Position: []int{1, 1}},
+		{Name: "parent", Position: []int{3}},
+	}, table.Columns)
+
+	table = GetTable(testPrefixedStruct{})
+	assert.Equal(t, "prefixed", table.Name)
+	assert.Equal(t, []string{"id"}, table.KeyColumns)
+	assert.Equal(t, []Column{
+		{Name: "id", Position: []int{0}},
+		{Name: "audit_created_by", Position: []int{1, 0}},
+		{Name: "audit_updatedby", Position: []int{1, 1}},
+	}, table.Columns)
+
+	v := testPrefixedStruct{ID: "foo", testAudit: testAudit{"bar", "zar"}}
+	assert.Equal(t, []interface{}{"foo", "bar", "zar"}, Bind(v))
+
+	m := Map(&v)
+	*(m["audit_updatedby"].(*string)) = "updated"
+	assert.Equal(t, "updated", v.UpdatedBy)
+}
+
+func TestParseKey(t *testing.T) {
+	var tests = []struct {
+		tag        string
+		partition  []string
+		clustering []string
+	}{
+		{"", nil, nil},
+		{"id", []string{"id"}, nil},
+		{"partkey,id", []string{"partkey"}, []string{"id"}},
+		{"partkey, id, time", []string{"partkey"}, []string{"id", "time"}},
+		{"(tenant,bucket)", []string{"tenant", "bucket"}, nil},
+		{"(tenant, bucket), id", []string{"tenant", "bucket"}, []string{"id"}},
+		{"(tenant,bucket),id,time", []string{"tenant", "bucket"}, []string{"id", "time"}},
+	}
+
+	for _, tc := range tests {
+		partition, clustering := parseKey(tc.tag)
+		assert.Equal(t, tc.partition, partition, tc.tag)
+		assert.Equal(t, tc.clustering, clustering, tc.tag)
+	}
+}
+
+func TestParseConsistency(t *testing.T) {
+	quorum, one := gocql.LocalQuorum, gocql.One
+	serial, localSerial := gocql.Serial, gocql.LocalSerial
+
+	var tests = []struct {
+		tag         string
+		consistency *gocql.Consistency
+		serial      *gocql.SerialConsistency
+	}{
+		{"local_quorum", &quorum, nil},
+		{"ONE", &one, nil},
+		{"local_quorum,local_serial", &quorum, &localSerial},
+		{"one, serial", &one, &serial},
+		{",serial", nil, &serial},
+	}
+
+	for _, tc := range tests {
+		consistency, serial, err := parseConsistency(tc.tag)
+		assert.NoError(t, err, tc.tag)
+		assert.Equal(t, tc.consistency, consistency, tc.tag)
+		assert.Equal(t, tc.serial, serial, tc.tag)
+	}
+
+	for _, tag := range []string{"most", "one,quorum"} {
+		_, _, err := parseConsistency(tag)
+		assert.Error(t, err, tag)
+	}
+}
+
+type testBadConsistencyStruct struct {
+	ID   string `cql:"id" cqltable:"bad_consistency" cqlkey:"id" cqlconsistency:"most"`
+	Text string `cql:"text"`
+}
+
+func TestInvalidConsistencyTag(t *testing.T) {
+	DeleteRegistry()
+
+	assert.NotPanics(t, func() { Register(testBadConsistencyStruct{}) })
+
+	sess := &SessionImpl{}
+	v := testBadConsistencyStruct{ID: "id"}
+	for _, stmt := range []Statement{sess.Select(v), sess.Insert(v), sess.Delete(v)} {
+		err := stmt.Err()
+		assert.True(t, errors.Is(err, ErrInvalidConsistency))
+		assert.Contains(t, err.Error(), "on bad_consistency: invalid consistency most")
+	}
+	assert.True(t, errors.Is(sess.Set(v), ErrInvalidConsistency))
+	assert.True(t, errors.Is(sess.Get(&v, "id"), ErrInvalidConsistency))
+	assert.True(t, errors.Is(sess.Del(v), ErrInvalidConsistency))
+	_, err := sess.Exists(v)
+	assert.True(t, errors.Is(err, ErrInvalidConsistency))
+}
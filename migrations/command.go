@@ -0,0 +1,53 @@
+package migrations
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrInvalidCommand is returned by Run if the command is not supported.
+var ErrInvalidCommand = errors.New("invalid command, use status, up or down")
+
+// Run executes the command in args[0], status, up or down, and writes the
+// result in w. It allows to create small commands to manage migrations.
+func (m *Migrator) Run(args []string, w io.Writer) error {
+	if len(args) == 0 {
+		return ErrInvalidCommand
+	}
+
+	switch args[0] {
+	case "status":
+		status, err := m.Status()
+		if err != nil {
+			return err
+		}
+		for _, st := range status {
+			if st.Applied {
+				fmt.Fprintf(w, "%d_%s\tapplied at %s\n", st.Version, st.Name, st.AppliedAt.UTC().Format("2006-01-02 15:04:05"))
+			} else {
+				fmt.Fprintf(w, "%d_%s\tpending\n", st.Version, st.Name)
+			}
+		}
+	case "up":
+		done, err := m.Up()
+		for _, mig := range done {
+			fmt.Fprintf(w, "%d_%s\tapplied\n", mig.Version, mig.Name)
+		}
+		if err != nil {
+			return err
+		}
+	case "down":
+		mig, err := m.Down()
+		if err != nil {
+			return err
+		}
+		if mig != nil {
+			fmt.Fprintf(w, "%d_%s\treverted\n", mig.Version, mig.Name)
+		}
+	default:
+		return ErrInvalidCommand
+	}
+
+	return nil
+}
@@ -0,0 +1,94 @@
+package migrations
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var fileRegexp = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.cql$`)
+
+// LoadDir reads the migrations in a directory. The files must be named like
+// 0001_create_users.up.cql and 0001_create_users.down.cql, and the statements
+// in a file must be separated by semicolons.
+func LoadDir(dir string) ([]Migration, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []int64
+	migrations := make(map[int64]*Migration)
+	for _, f := range files {
+		parts := fileRegexp.FindStringSubmatch(f.Name())
+		if f.IsDir() || parts == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", f.Name(), err.Error())
+		}
+
+		mig, ok := migrations[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: parts[2]}
+			migrations[version] = mig
+			versions = append(versions, version)
+		} else if mig.Name != parts[2] {
+			return nil, fmt.Errorf("%s: %s", f.Name(), ErrDuplicateVersion.Error())
+		}
+
+		b, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		if parts[3] == "up" {
+			mig.Up = CQL(splitStatements(string(b))...)
+		} else {
+			mig.Down = CQL(splitStatements(string(b))...)
+		}
+	}
+
+	list := make([]Migration, len(versions))
+	for i, v := range versions {
+		list[i] = *migrations[v]
+	}
+	return list, nil
+}
+
+// splitStatements splits the content of a file in CQL statements. Semicolons
+// inside string literals, quoted identifiers and $$ strings do not end a
+// statement.
+func splitStatements(s string) []string {
+	var stmts []string
+	var quote string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case quote != "":
+			if strings.HasPrefix(s[i:], quote) {
+				i += len(quote) - 1
+				quote = ""
+			}
+		case s[i] == '\'' || s[i] == '"':
+			quote = s[i : i+1]
+		case strings.HasPrefix(s[i:], "$$"):
+			quote = "$$"
+			i++
+		case s[i] == ';':
+			if stmt := strings.TrimSpace(s[start:i]); stmt != "" {
+				stmts = append(stmts, stmt)
+			}
+			start = i + 1
+		}
+	}
+	if stmt := strings.TrimSpace(s[start:]); stmt != "" {
+		stmts = append(stmts, stmt)
+	}
+	return stmts
+}
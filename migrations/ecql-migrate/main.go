@@ -0,0 +1,53 @@
+// Command ecql-migrate applies the CQL migrations in a directory.
+//
+//	ecql-migrate -hosts 127.0.0.1 -keyspace ks -dir ./migrations status|up|down
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gocql/gocql"
+	"github.com/maraino/ecql"
+	"github.com/maraino/ecql/migrations"
+)
+
+func main() {
+	hosts := flag.String("hosts", "127.0.0.1", "comma separated list of cassandra hosts")
+	keyspace := flag.String("keyspace", "", "keyspace to migrate")
+	dir := flag.String("dir", ".", "directory with the migration files")
+	table := flag.String("table", migrations.DefaultTable, "name of the tracking table")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] status|up|down\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *keyspace == "" || flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	list, err := migrations.LoadDir(*dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading migrations: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	cluster := gocql.NewCluster(strings.Split(*hosts, ",")...)
+	cluster.Keyspace = *keyspace
+	sess, err := ecql.NewSession(*cluster)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error connecting cassandra: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	m := migrations.New(sess, list...)
+	m.Table = *table
+	if err := m.Run(flag.Args(), os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+		os.Exit(1)
+	}
+}
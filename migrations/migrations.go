@@ -0,0 +1,325 @@
+// Package migrations implements a versioned schema migration runner for
+// ecql.
+//
+// Migrations are applied in order of version and the applied versions are
+// recorded in a tracking table. While migrations are running a lock row is
+// inserted using IF NOT EXISTS, so only one migrator can run at the same time
+// in the cluster.
+//
+//	m := migrations.New(sess,
+//		migrations.Migration{
+//			Version: 1,
+//			Name:    "create_users",
+//			Up:      migrations.CQL("CREATE TABLE users (id text PRIMARY KEY, name text)"),
+//			Down:    migrations.CQL("DROP TABLE users"),
+//		},
+//	)
+//	err := m.Up()
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/maraino/ecql"
+)
+
+var (
+	// ErrLocked is returned if other migrator is running in the cluster.
+	ErrLocked = errors.New("migrations are locked")
+
+	// ErrIrreversible is returned by Down if the last migration applied does
+	// not define a Down step.
+	ErrIrreversible = errors.New("migration is irreversible")
+
+	// ErrDuplicateVersion is returned if two migrations have the same version.
+	ErrDuplicateVersion = errors.New("duplicate migration version")
+)
+
+// DefaultTable is the default name of the tracking table.
+const DefaultTable = "schema_migrations"
+
+// DefaultLockTTL is the default time to live of the lock row.
+const DefaultLockTTL = 10 * time.Minute
+
+// Step is a migration step, it can be a list of CQL statements using CQL or a
+// Go function.
+type Step func(sess ecql.Session) error
+
+// CQL returns a Step that executes the given statements in order.
+func CQL(stmts ...string) Step {
+	return func(sess ecql.Session) error {
+		exec, err := ecql.SessionExecutor(sess)
+		if err != nil {
+			return err
+		}
+		for _, stmt := range stmts {
+			if err := exec.Query(context.Background(), stmt).Exec(); err != nil {
+				return fmt.Errorf("%s: %s", stmt, err.Error())
+			}
+		}
+		return nil
+	}
+}
+
+// Migration is a named and versioned schema change.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      Step
+	Down    Step
+}
+
+// Status contains the information of a migration and if it has been applied.
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Migrator applies migrations using an ecql.Session. LockTTL is the time to
+// live of the lock row, values lower than one second use DefaultLockTTL so
+// the lock of a crashed migrator always expires.
+type Migrator struct {
+	Session    ecql.Session
+	Table      string
+	LockTTL    time.Duration
+	migrations []Migration
+	owner      string
+}
+
+// New creates a new Migrator with the given migrations.
+func New(sess ecql.Session, migrations ...Migration) *Migrator {
+	m := &Migrator{
+		Session: sess,
+		Table:   DefaultTable,
+		LockTTL: DefaultLockTTL,
+	}
+	return m.Add(migrations...)
+}
+
+// Add adds new migrations to the migrator.
+func (m *Migrator) Add(migrations ...Migration) *Migrator {
+	m.migrations = append(m.migrations, migrations...)
+	sort.SliceStable(m.migrations, func(i, j int) bool {
+		return m.migrations[i].Version < m.migrations[j].Version
+	})
+	return m
+}
+
+// Migrations returns the list of migrations sorted by version.
+func (m *Migrator) Migrations() []Migration {
+	return m.migrations
+}
+
+// Status returns the list of migrations and if they have been applied.
+func (m *Migrator) Status() ([]Status, error) {
+	if err := m.init(); err != nil {
+		return nil, err
+	}
+
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	status := make([]Status, len(m.migrations))
+	for i, mig := range m.migrations {
+		status[i].Migration = mig
+		status[i].AppliedAt, status[i].Applied = applied[mig.Version]
+	}
+	return status, nil
+}
+
+// Up applies all the pending migrations in order and returns the ones applied.
+func (m *Migrator) Up() ([]Migration, error) {
+	if err := m.validate(); err != nil {
+		return nil, err
+	}
+
+	if err := m.init(); err != nil {
+		return nil, err
+	}
+
+	if err := m.lock(); err != nil {
+		return nil, err
+	}
+	defer m.unlock()
+
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, mig := range m.migrations {
+		if _, ok := applied[mig.Version]; ok {
+			continue
+		}
+
+		if mig.Up != nil {
+			if err := mig.Up(m.Session); err != nil {
+				return done, fmt.Errorf("migration %d_%s: %s", mig.Version, mig.Name, err.Error())
+			}
+		}
+
+		if err := m.exec(fmt.Sprintf("INSERT INTO %s (version, name, applied_at) VALUES (?, ?, ?)", m.Table),
+			mig.Version, mig.Name, ecql.Now()); err != nil {
+			return done, err
+		}
+		done = append(done, mig)
+	}
+
+	return done, nil
+}
+
+// Down reverts the last applied migration and returns it. It returns nil if
+// there are no migrations applied.
+func (m *Migrator) Down() (*Migration, error) {
+	if err := m.validate(); err != nil {
+		return nil, err
+	}
+
+	if err := m.init(); err != nil {
+		return nil, err
+	}
+
+	if err := m.lock(); err != nil {
+		return nil, err
+	}
+	defer m.unlock()
+
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		mig := m.migrations[i]
+		if _, ok := applied[mig.Version]; !ok {
+			continue
+		}
+
+		if mig.Down == nil {
+			return nil, ErrIrreversible
+		}
+
+		if err := mig.Down(m.Session); err != nil {
+			return nil, fmt.Errorf("migration %d_%s: %s", mig.Version, mig.Name, err.Error())
+		}
+
+		if err := m.exec(fmt.Sprintf("DELETE FROM %s WHERE version = ?", m.Table), mig.Version); err != nil {
+			return nil, err
+		}
+		return &mig, nil
+	}
+
+	return nil, nil
+}
+
+// validate checks that there are no duplicated versions.
+func (m *Migrator) validate() error {
+	for i := 1; i < len(m.migrations); i++ {
+		if m.migrations[i].Version == m.migrations[i-1].Version {
+			return ErrDuplicateVersion
+		}
+	}
+	return nil
+}
+
+// init creates the tracking and lock tables if necessary.
+func (m *Migrator) init() error {
+	for _, stmt := range []string{
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (version bigint PRIMARY KEY, name text, applied_at timestamp)", m.Table),
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s_lock (id text PRIMARY KEY, owner text, locked_at timestamp)", m.Table),
+	} {
+		if err := m.exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applied returns the versions applied and the time they were applied.
+func (m *Migrator) applied() (map[int64]time.Time, error) {
+	var version int64
+	var appliedAt time.Time
+
+	query, err := m.query(fmt.Sprintf("SELECT version, applied_at FROM %s", m.Table))
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int64]time.Time)
+	iter := query.Iter()
+	for iter.Scan(&version, &appliedAt) {
+		applied[version] = appliedAt
+	}
+	return applied, iter.Close()
+}
+
+// lock inserts the lock row using IF NOT EXISTS, the row will expire after
+// LockTTL if it is not removed.
+func (m *Migrator) lock() error {
+	hostname, _ := os.Hostname()
+	m.owner = fmt.Sprintf("%s:%d:%s", hostname, os.Getpid(), gocql.TimeUUID())
+
+	stmt := fmt.Sprintf("INSERT INTO %s_lock (id, owner, locked_at) VALUES (?, ?, ?) IF NOT EXISTS USING TTL %d", m.Table, m.lockTTL())
+	query, err := m.query(stmt, "lock", m.owner, ecql.Now())
+	if err != nil {
+		return err
+	}
+
+	current := make(map[string]interface{})
+	if applied, err := query.MapScanCAS(current); err != nil {
+		return err
+	} else if !applied {
+		return ErrLocked
+	}
+	return nil
+}
+
+// lockTTL returns the time to live in seconds of the lock row, a TTL of 0
+// would never expire, so values lower than one second use DefaultLockTTL.
+func (m *Migrator) lockTTL() int {
+	if m.LockTTL < time.Second {
+		return int(DefaultLockTTL.Seconds())
+	}
+	return int(m.LockTTL.Seconds())
+}
+
+// unlock removes the lock row if it is owned by the migrator.
+func (m *Migrator) unlock() error {
+	query, err := m.query(fmt.Sprintf("DELETE FROM %s_lock WHERE id = ? IF owner = ?", m.Table), "lock", m.owner)
+	if err != nil {
+		return err
+	}
+
+	current := make(map[string]interface{})
+	_, err = query.MapScanCAS(current)
+	return err
+}
+
+// query creates a query using the executor of the session, so migrations can
+// run in any ecql session, like the in-memory one in ecqltest.
+func (m *Migrator) query(stmt string, args ...interface{}) (ecql.Query, error) {
+	exec, err := ecql.SessionExecutor(m.Session)
+	if err != nil {
+		return nil, err
+	}
+	return exec.Query(context.Background(), stmt, args...), nil
+}
+
+// exec executes the given statement.
+func (m *Migrator) exec(stmt string, args ...interface{}) error {
+	query, err := m.query(stmt, args...)
+	if err != nil {
+		return err
+	}
+	return query.Exec()
+}
@@ -0,0 +1,255 @@
+package migrations
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/maraino/ecql"
+	"github.com/maraino/ecql/ecqltest"
+	"github.com/stretchr/testify/assert"
+)
+
+func testMigrations() []Migration {
+	return []Migration{
+		{
+			Version: 1,
+			Name:    "create_users",
+			Up:      CQL("CREATE TABLE users (id text PRIMARY KEY, name text)", "INSERT INTO users (id, name) VALUES ('a;b', 'it''s; here')"),
+			Down:    CQL("TRUNCATE users"),
+		},
+		{
+			Version: 2,
+			Name:    "create_tweets",
+			Up:      CQL("CREATE TABLE tweets (id text PRIMARY KEY, text text)"),
+			Down:    CQL("TRUNCATE tweets"),
+		},
+	}
+}
+
+func count(t *testing.T, m *ecqltest.Memory, table string) int {
+	var n int
+	query := m.Query(context.Background(), "SELECT COUNT(*) FROM "+table)
+	assert.NoError(t, query.Scan(&n))
+	return n
+}
+
+func TestUpDownStatus(t *testing.T) {
+	mem := ecqltest.NewMemory()
+	m := New(mem.Session(), testMigrations()...)
+
+	status, err := m.Status()
+	assert.NoError(t, err)
+	if assert.Len(t, status, 2) {
+		assert.False(t, status[0].Applied)
+		assert.False(t, status[1].Applied)
+	}
+
+	done, err := m.Up()
+	assert.NoError(t, err)
+	if assert.Len(t, done, 2) {
+		assert.Equal(t, int64(1), done[0].Version)
+		assert.Equal(t, int64(2), done[1].Version)
+	}
+	assert.Equal(t, 1, count(t, mem, "users"))
+	assert.Equal(t, 2, count(t, mem, DefaultTable))
+
+	// The lock is released
+	assert.Equal(t, 0, count(t, mem, DefaultTable+"_lock"))
+
+	status, err = m.Status()
+	assert.NoError(t, err)
+	if assert.Len(t, status, 2) {
+		assert.True(t, status[0].Applied)
+		assert.False(t, status[0].AppliedAt.IsZero())
+		assert.True(t, status[1].Applied)
+	}
+
+	// Applied migrations are not executed again
+	done, err = m.Up()
+	assert.NoError(t, err)
+	assert.Empty(t, done)
+
+	mig, err := m.Down()
+	assert.NoError(t, err)
+	if assert.NotNil(t, mig) {
+		assert.Equal(t, int64(2), mig.Version)
+	}
+	assert.Equal(t, 1, count(t, mem, DefaultTable))
+
+	mig, err = m.Down()
+	assert.NoError(t, err)
+	if assert.NotNil(t, mig) {
+		assert.Equal(t, int64(1), mig.Version)
+	}
+	assert.Equal(t, 0, count(t, mem, "users"))
+	assert.Equal(t, 0, count(t, mem, DefaultTable))
+
+	mig, err = m.Down()
+	assert.NoError(t, err)
+	assert.Nil(t, mig)
+	assert.Equal(t, 0, count(t, mem, DefaultTable+"_lock"))
+}
+
+func TestLockTTL(t *testing.T) {
+	m := New(nil)
+	assert.Equal(t, 600, m.lockTTL())
+	for _, ttl := range []time.Duration{0, -time.Minute, 500 * time.Millisecond} {
+		m.LockTTL = ttl
+		assert.Equal(t, 600, m.lockTTL(), ttl.String())
+	}
+	m.LockTTL = 90 * time.Second
+	assert.Equal(t, 90, m.lockTTL())
+
+	// The lock of a zero TTL expires after the default TTL
+	now := time.Now()
+	mem := ecqltest.NewMemory()
+	mem.Now = func() time.Time { return now }
+	m = New(mem.Session())
+	m.LockTTL = 0
+	assert.NoError(t, m.init())
+	assert.NoError(t, m.lock())
+	assert.Equal(t, 1, count(t, mem, DefaultTable+"_lock"))
+	now = now.Add(DefaultLockTTL)
+	assert.Equal(t, 0, count(t, mem, DefaultTable+"_lock"))
+}
+
+func TestUpErrors(t *testing.T) {
+	errStep := errors.New("step failed")
+	mem := ecqltest.NewMemory()
+	m := New(mem.Session(), testMigrations()...)
+	m.Add(Migration{
+		Version: 3,
+		Name:    "fail",
+		Up:      func(sess ecql.Session) error { return errStep },
+	})
+
+	// Migrations before the failure are recorded
+	done, err := m.Up()
+	assert.Error(t, err)
+	assert.Len(t, done, 2)
+	assert.Equal(t, 2, count(t, mem, DefaultTable))
+	assert.Equal(t, 0, count(t, mem, DefaultTable+"_lock"))
+
+	// Migrations without a Down step cannot be reverted
+	m.migrations[2].Up = nil
+	done, err = m.Up()
+	assert.NoError(t, err)
+	assert.Len(t, done, 1)
+	_, err = m.Down()
+	assert.Equal(t, ErrIrreversible, err)
+
+	// Sessions without an executor are not supported
+	_, err = New(nil).Status()
+	assert.Equal(t, ecql.ErrInvalidSession, err)
+}
+
+func TestLock(t *testing.T) {
+	now := time.Now()
+	mem := ecqltest.NewMemory()
+	mem.Now = func() time.Time { return now }
+
+	m := New(mem.Session(), testMigrations()...)
+	other := New(mem.Session())
+	assert.NoError(t, other.init())
+	assert.NoError(t, other.lock())
+
+	_, err := m.Up()
+	assert.Equal(t, ErrLocked, err)
+	_, err = m.Down()
+	assert.Equal(t, ErrLocked, err)
+
+	// Only the owner can release the lock
+	assert.NoError(t, m.unlock())
+	assert.Equal(t, 1, count(t, mem, DefaultTable+"_lock"))
+
+	// The lock expires after the TTL
+	now = now.Add(DefaultLockTTL)
+	done, err := m.Up()
+	assert.NoError(t, err)
+	assert.Len(t, done, 2)
+
+	now = time.Now()
+	assert.NoError(t, other.lock())
+	assert.NoError(t, other.unlock())
+	assert.Equal(t, 0, count(t, mem, DefaultTable+"_lock"))
+}
+
+func TestAdd(t *testing.T) {
+	m := New(nil, Migration{Version: 3, Name: "c"}, Migration{Version: 1, Name: "a"})
+	m.Add(Migration{Version: 2, Name: "b"})
+
+	var names []string
+	for _, mig := range m.Migrations() {
+		names = append(names, mig.Name)
+	}
+	assert.Equal(t, []string{"a", "b", "c"}, names)
+	assert.Equal(t, DefaultTable, m.Table)
+	assert.NoError(t, m.validate())
+
+	m.Add(Migration{Version: 2, Name: "d"})
+	assert.Equal(t, ErrDuplicateVersion, m.validate())
+}
+
+func TestLoadDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "migrations")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"0002_add_email.up.cql":      "ALTER TABLE users ADD email text;",
+		"0001_create_users.up.cql":   "CREATE TABLE users (id text PRIMARY KEY);\nCREATE INDEX ON users (id);\n",
+		"0001_create_users.down.cql": "DROP TABLE users",
+		"README.md":                  "ignored",
+	}
+	for name, content := range files {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600))
+	}
+
+	list, err := LoadDir(dir)
+	assert.NoError(t, err)
+	if assert.Len(t, list, 2) {
+		assert.Equal(t, int64(1), list[0].Version)
+		assert.Equal(t, "create_users", list[0].Name)
+		assert.NotNil(t, list[0].Up)
+		assert.NotNil(t, list[0].Down)
+		assert.Equal(t, int64(2), list[1].Version)
+		assert.Equal(t, "add_email", list[1].Name)
+		assert.NotNil(t, list[1].Up)
+		assert.Nil(t, list[1].Down)
+	}
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "0002_other.down.cql"), []byte(""), 0600))
+	_, err = LoadDir(dir)
+	assert.Error(t, err)
+
+	_, err = LoadDir(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
+
+func TestSplitStatements(t *testing.T) {
+	assert.Equal(t, []string{"CREATE TABLE a (id int PRIMARY KEY)", "DROP TABLE b"},
+		splitStatements("CREATE TABLE a (id int PRIMARY KEY);\n\n DROP TABLE b;\n"))
+	assert.Nil(t, splitStatements(" \n"))
+	assert.Equal(t, []string{
+		"INSERT INTO a (id, text) VALUES (1, 'a;b''c;')",
+		`CREATE TABLE "x;y" (id int PRIMARY KEY)`,
+		"CREATE FUNCTION f() RETURNS NULL ON NULL INPUT RETURNS int LANGUAGE java AS $$ return 1; $$",
+		"DROP TABLE b",
+	}, splitStatements("INSERT INTO a (id, text) VALUES (1, 'a;b''c;');"+
+		`CREATE TABLE "x;y" (id int PRIMARY KEY);`+
+		"CREATE FUNCTION f() RETURNS NULL ON NULL INPUT RETURNS int LANGUAGE java AS $$ return 1; $$;"+
+		"DROP TABLE b"))
+}
+
+func TestRunInvalidCommand(t *testing.T) {
+	var buf bytes.Buffer
+	m := New(nil)
+	assert.Equal(t, ErrInvalidCommand, m.Run(nil, &buf))
+	assert.Equal(t, ErrInvalidCommand, m.Run([]string{"foo"}, &buf))
+}
@@ -2,6 +2,10 @@ package ecql
 
 type increaseType int64
 type decreaseType int64
+type appendType struct{ values interface{} }
+type prependType struct{ values interface{} }
+type removeType struct{ values interface{} }
+type elementType struct{ key, value interface{} }
 
 // Inc increases (or decreases) a counter.
 func Inc(v int64) increaseType {
@@ -12,3 +16,49 @@ func Inc(v int64) increaseType {
 func Dec(v int64) decreaseType {
 	return decreaseType(v)
 }
+
+// Append adds the values of a slice at the end of a list:
+// 	sess.Update(v).Set("tags", Append([]string{"foo"})) // tags = tags + ?
+func Append(values interface{}) appendType {
+	return appendType{values}
+}
+
+// Prepend adds the values of a slice at the beginning of a list:
+// 	sess.Update(v).Set("tags", Prepend([]string{"foo"})) // tags = ? + tags
+func Prepend(values interface{}) prependType {
+	return prependType{values}
+}
+
+// Add adds the values of a slice to a set.
+func Add(values interface{}) appendType {
+	return appendType{values}
+}
+
+// Put adds the entries of a map to a map column, replacing the values of the
+// existing keys.
+func Put(entries interface{}) appendType {
+	return appendType{entries}
+}
+
+// Remove removes the values of a slice from a list or a set, on lists all the
+// occurrences of the values are removed.
+func Remove(values interface{}) removeType {
+	return removeType{values}
+}
+
+// RemoveKeys removes the keys in a slice from a map column.
+func RemoveKeys(keys interface{}) removeType {
+	return removeType{keys}
+}
+
+// Index sets the element in the given position of a list, the position must
+// exist:
+// 	sess.Update(v).Set("scores", Index(2, 10)) // scores[?] = ?
+func Index(i int, value interface{}) elementType {
+	return elementType{i, value}
+}
+
+// Key sets the value of a key in a map column.
+func Key(key, value interface{}) elementType {
+	return elementType{key, value}
+}
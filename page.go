@@ -0,0 +1,83 @@
+package ecql
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"reflect"
+)
+
+// Page executes a SELECT statement and reads one page of results in dest,
+// that must be a pointer to a slice of structs or pointers to structs. The
+// number of rows in a page is defined by PageSize.
+//
+// The cursor is the value returned by a previous call, or an empty string to
+// get the first page. The returned cursor is an opaque URL-safe string that
+// can be used to get the next page, it will be empty if there are no more
+// pages. If dest is not a pointer to a slice a *StatementError wrapping
+// ErrInvalidDestination is returned.
+// 	var tweets []Tweet
+// 	cursor, err := sess.Select(Tweet{}).Where(Eq("timeline", "ecql")).PageSize(20).Page(&tweets, r.FormValue("cursor"))
+func (s *StatementImpl) Page(dest interface{}, cursor string) (string, error) {
+	return s.PageContext(context.Background(), dest, cursor)
+}
+
+// PageContext is like Page but the query will be executed with the given
+// context.
+func (s *StatementImpl) PageContext(ctx context.Context, dest interface{}, cursor string) (string, error) {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Slice {
+		return "", s.newError(ErrInvalidDestination, fmt.Sprintf("%T", dest))
+	}
+
+	state, err := decodeCursor(cursor)
+	if err != nil {
+		return "", err
+	}
+
+	slice := v.Elem()
+	elemType := slice.Type().Elem()
+	isPtr := elemType.Kind() == reflect.Ptr
+	if isPtr {
+		elemType = elemType.Elem()
+	}
+
+	// The page is read with a copy of the statement, so the paging state is
+	// not kept in s.
+	rows := reflect.MakeSlice(slice.Type(), 0, s.PageSizeValue)
+	iter := s.Clone().PageState(state).IterContext(ctx)
+	for {
+		elem := reflect.New(elemType)
+		if !iter.TypeScan(elem.Interface()) {
+			break
+		}
+		if isPtr {
+			rows = reflect.Append(rows, elem)
+		} else {
+			rows = reflect.Append(rows, elem.Elem())
+		}
+	}
+	if err := iter.Close(); err != nil {
+		return "", err
+	}
+
+	slice.Set(rows)
+	return encodeCursor(iter.PageState()), nil
+}
+
+// encodeCursor encodes a paging state in a URL-safe string.
+func encodeCursor(state []byte) string {
+	return base64.RawURLEncoding.EncodeToString(state)
+}
+
+// decodeCursor decodes a cursor created by encodeCursor.
+func decodeCursor(cursor string) ([]byte, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+	state, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return state, nil
+}
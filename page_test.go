@@ -0,0 +1,39 @@
+package ecql
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCursor(t *testing.T) {
+	state := []byte{0x00, 0xff, 0xfe, '/', '+', '='}
+	cursor := encodeCursor(state)
+	assert.NotContains(t, cursor, "/")
+	assert.NotContains(t, cursor, "+")
+	assert.NotContains(t, cursor, "=")
+
+	decoded, err := decodeCursor(cursor)
+	assert.NoError(t, err)
+	assert.Equal(t, state, decoded)
+
+	assert.Equal(t, "", encodeCursor(nil))
+	decoded, err = decodeCursor("")
+	assert.NoError(t, err)
+	assert.Nil(t, decoded)
+
+	_, err = decodeCursor("not a cursor!")
+	assert.Equal(t, ErrInvalidCursor, err)
+}
+
+func TestPageInvalidDestination(t *testing.T) {
+	DeleteRegistry()
+
+	var v testStruct
+	sess := &SessionImpl{}
+	cursor, err := sess.Select(testStruct{}).Page(&v, "")
+	assert.Equal(t, "", cursor)
+	assert.True(t, errors.Is(err, ErrInvalidDestination))
+	assert.Equal(t, "invalid SELECT statement on mytable: destination is not a pointer to a slice *ecql.testStruct", err.Error())
+}
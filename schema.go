@@ -0,0 +1,204 @@
+package ecql
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+	"reflect"
+	"strings"
+
+	"github.com/gocql/gocql"
+)
+
+var (
+	uuidType   = reflect.TypeOf(gocql.UUID{})
+	bigIntType = reflect.TypeOf(big.Int{})
+	ipType     = reflect.TypeOf(net.IP{})
+	bytesType  = reflect.TypeOf([]byte{})
+)
+
+// CreateTable returns the CREATE TABLE IF NOT EXISTS statement for the table
+// defined by i. It returns ErrInvalidType if i is not a struct.
+//
+// The CQL types of the columns are inferred from the Go types of the fields
+// or can be set using the tag `cqltype`. The partition key and clustering
+// columns are defined by `cqlkey`, the clustering order and static columns
+// can be defined using the options in the `cql` tag:
+// 	type Timeline struct {
+// 		ID    string     `cql:"id" cqltable:"timeline" cqlkey:"id,time"`
+// 		Time  time.Time  `cql:"time,desc"`
+// 		Tweet gocql.UUID `cql:"tweet" cqltype:"timeuuid"`
+// 		Owner string     `cql:"owner,static"`
+// 	}
+func CreateTable(i interface{}) (string, error) {
+	if !isStruct(i) {
+		return "", ErrInvalidType
+	}
+
+	v := structOf(i)
+	table := GetTable(i)
+
+	definitions, err := columnDefinitions(v.Type(), table.Columns)
+	if err != nil {
+		return "", err
+	}
+
+	ordered := false
+	colOrders := make(map[string]OrderType)
+	for i, col := range table.Columns {
+		if col.Static {
+			definitions[i] += " static"
+		}
+		if table.isClusteringColumn(col.Name) && col.Order != "" {
+			colOrders[col.Name] = col.Order
+			ordered = true
+		}
+	}
+
+	// The clustering order must list the clustering columns in the order of
+	// the primary key, columns without an explicit order are ascending.
+	var orders []string
+	if ordered {
+		for _, name := range table.ClusteringColumns {
+			order, ok := colOrders[name]
+			if !ok {
+				order = AscOrder
+			}
+			orders = append(orders, fmt.Sprintf("%s %s", name, order))
+		}
+	}
+
+	key := strings.Join(table.PartitionKey, ", ")
+	if len(table.PartitionKey) > 1 {
+		key = "(" + key + ")"
+	}
+	if len(table.ClusteringColumns) > 0 {
+		key += ", " + strings.Join(table.ClusteringColumns, ", ")
+	}
+
+	definitions = append(definitions, fmt.Sprintf("PRIMARY KEY (%s)", key))
+	cql := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", table.Name, strings.Join(definitions, ", "))
+	if len(orders) > 0 {
+		cql += fmt.Sprintf(" WITH CLUSTERING ORDER BY (%s)", strings.Join(orders, ", "))
+	}
+
+	return cql, nil
+}
+
+// CreateType returns the CREATE TYPE IF NOT EXISTS statement for the
+// user-defined type defined by i. The name of the type is defined using the
+// tag `cqltable` and the CQL types of the fields are inferred as in
+// CreateTable. It returns ErrInvalidType if i is not a struct.
+func CreateType(i interface{}) (string, error) {
+	if !isStruct(i) {
+		return "", ErrInvalidType
+	}
+
+	v := structOf(i)
+	table := GetTable(i)
+
+	definitions, err := columnDefinitions(v.Type(), table.Columns)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("CREATE TYPE IF NOT EXISTS %s (%s)", table.Name, strings.Join(definitions, ", ")), nil
+}
+
+// columnDefinitions returns the name and type of the given columns of the
+// struct type t.
+func columnDefinitions(t reflect.Type, columns []Column) ([]string, error) {
+	definitions := make([]string, len(columns))
+	for i, col := range columns {
+		typ := col.Type
+		if typ == "" {
+			var err error
+			if typ, err = cqlTypeOf(t.FieldByIndex(col.Position).Type); err != nil {
+				return nil, fmt.Errorf("column %s: %s", col.Name, err.Error())
+			}
+		}
+		definitions[i] = fmt.Sprintf("%s %s", col.Name, typ)
+	}
+	return definitions, nil
+}
+
+// cqlTypeOf infers the CQL type of the Go type t.
+func cqlTypeOf(t reflect.Type) (string, error) {
+	switch t {
+	case uuidType:
+		return "uuid", nil
+	case timeType:
+		return "timestamp", nil
+	case durationType:
+		return "duration", nil
+	case ipType:
+		return "inet", nil
+	case bytesType:
+		return "blob", nil
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		if t.Elem() == bigIntType {
+			return "varint", nil
+		}
+		return cqlTypeOf(t.Elem())
+	case reflect.String:
+		return "text", nil
+	case reflect.Bool:
+		return "boolean", nil
+	case reflect.Int8:
+		return "tinyint", nil
+	case reflect.Int16:
+		return "smallint", nil
+	case reflect.Int32:
+		return "int", nil
+	case reflect.Int, reflect.Int64:
+		return "bigint", nil
+	case reflect.Float32:
+		return "float", nil
+	case reflect.Float64:
+		return "double", nil
+	case reflect.Slice, reflect.Array:
+		elem, err := cqlElemTypeOf(t.Elem())
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("list<%s>", elem), nil
+	case reflect.Map:
+		key, err := cqlElemTypeOf(t.Key())
+		if err != nil {
+			return "", err
+		}
+		elem, err := cqlElemTypeOf(t.Elem())
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("map<%s, %s>", key, elem), nil
+	case reflect.Struct:
+		if isUDT(t) {
+			return fmt.Sprintf("frozen<%s>", getUDT(t).Name), nil
+		}
+	}
+
+	return "", fmt.Errorf("cannot infer the CQL type of %s", t)
+}
+
+// cqlElemTypeOf infers the CQL type of the elements in a collection, nested
+// collections must be frozen.
+func cqlElemTypeOf(t reflect.Type) (string, error) {
+	typ, err := cqlTypeOf(t)
+	if err != nil {
+		return "", err
+	}
+
+	switch t.Kind() {
+	case reflect.Map:
+		return fmt.Sprintf("frozen<%s>", typ), nil
+	case reflect.Slice, reflect.Array:
+		if t != ipType && t != bytesType {
+			return fmt.Sprintf("frozen<%s>", typ), nil
+		}
+	}
+	return typ, nil
+}
@@ -0,0 +1,111 @@
+package ecql
+
+import (
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+)
+
+type testSchemaStruct struct {
+	ID       gocql.UUID `cql:"id" cqltable:"schema" cqlkey:"id,time,seq"`
+	Time     time.Time  `cql:"time,desc"`
+	Seq      int32      `cql:"seq,asc"`
+	Owner    string     `cql:"owner,static"`
+	Tweet    gocql.UUID `cql:"tweet" cqltype:"timeuuid"`
+	Flag     bool
+	Small    int16
+	Tiny     int8
+	Big      int64
+	Float    float32
+	Double   float64
+	Varint   *big.Int
+	IP       net.IP
+	Data     []byte
+	Tags     []string
+	Details  map[string]string
+	Nested   map[string][]int
+	Address  testAddress
+	Places   []testAddress
+	Duration gocql.Duration
+	Text     *string
+}
+
+func TestCreateTable(t *testing.T) {
+	DeleteRegistry()
+
+	cql, err := CreateTable(testSchemaStruct{})
+	assert.NoError(t, err)
+	assert.Equal(t, "CREATE TABLE IF NOT EXISTS schema ("+
+		"id uuid, time timestamp, seq int, owner text static, tweet timeuuid, "+
+		"flag boolean, small smallint, tiny tinyint, big bigint, float float, double double, "+
+		"varint varint, ip inet, data blob, tags list<text>, details map<text, text>, "+
+		"nested map<text, frozen<list<bigint>>>, address frozen<testAddress>, "+
+		"places list<frozen<testAddress>>, duration duration, text text, "+
+		"PRIMARY KEY (id, time, seq)) WITH CLUSTERING ORDER BY (time DESC, seq ASC)", cql)
+
+	cql, err = CreateTable(tweetStruct{})
+	assert.NoError(t, err)
+	assert.Equal(t, "CREATE TABLE IF NOT EXISTS tweet (id uuid, text text, PRIMARY KEY (id))", cql)
+
+	_, err = CreateTable(struct {
+		ID  string `cql:"id"`
+		Bad uint
+	}{})
+	assert.Error(t, err)
+}
+
+func TestCreateType(t *testing.T) {
+	DeleteRegistry()
+
+	cql, err := CreateType(testAddress{})
+	assert.NoError(t, err)
+	assert.Equal(t, "CREATE TYPE IF NOT EXISTS testAddress (street text, zip bigint, geo frozen<testGeo>)", cql)
+}
+
+type tweetStruct struct {
+	ID   gocql.UUID `cql:"id" cqltable:"tweet" cqlkey:"id"`
+	Text string     `cql:"text"`
+}
+
+type testPartitionStruct struct {
+	Tenant string    `cql:"tenant" cqltable:"partitioned" cqlkey:"(tenant,bucket),time"`
+	Bucket int32     `cql:"bucket"`
+	Time   time.Time `cql:"time,desc"`
+}
+
+func TestCreateTablePartitionKey(t *testing.T) {
+	DeleteRegistry()
+
+	cql, err := CreateTable(testPartitionStruct{})
+	assert.NoError(t, err)
+	assert.Equal(t, "CREATE TABLE IF NOT EXISTS partitioned (tenant text, bucket int, time timestamp, "+
+		"PRIMARY KEY ((tenant, bucket), time)) WITH CLUSTERING ORDER BY (time DESC)", cql)
+}
+
+type testClusteringStruct struct {
+	ID string `cql:"id" cqltable:"clustered" cqlkey:"id,a,b"`
+	B  int32  `cql:"b,desc"`
+	A  int32  `cql:"a"`
+}
+
+func TestCreateTableClusteringOrder(t *testing.T) {
+	DeleteRegistry()
+
+	cql, err := CreateTable(testClusteringStruct{})
+	assert.NoError(t, err)
+	assert.Equal(t, "CREATE TABLE IF NOT EXISTS clustered (id text, b int, a int, "+
+		"PRIMARY KEY (id, a, b)) WITH CLUSTERING ORDER BY (a ASC, b DESC)", cql)
+}
+
+func TestCreateInvalidType(t *testing.T) {
+	for _, i := range []interface{}{nil, 42, "text", []testStruct{}, (*testStruct)(nil)} {
+		_, err := CreateTable(i)
+		assert.Equal(t, ErrInvalidType, err)
+		_, err = CreateType(i)
+		assert.Equal(t, ErrInvalidType, err)
+	}
+}
@@ -0,0 +1,78 @@
+package ecql
+
+import (
+	"fmt"
+	"strings"
+)
+
+// WriteTime returns the selector 'WRITETIME(col)' to get the timestamp in
+// microseconds of the last write of a column. Selectors can be used in
+// Statement.Columns, and combined with As to scan them into structs:
+// 	sess.Select(Tweet{}).Columns("id", As(WriteTime("text"), "written")).Where(EqInt(tw))
+func WriteTime(col string) string {
+	return fmt.Sprintf("WRITETIME(%s)", col)
+}
+
+// TTLOf returns the selector 'TTL(col)' to get the remaining time to live
+// in seconds of a column, or null if the column does not expire.
+func TTLOf(col string) string {
+	return fmt.Sprintf("TTL(%s)", col)
+}
+
+// Token returns the selector 'token(cols...)' to get the token of the
+// partition key.
+func Token(cols ...string) string {
+	return Func("token", cols...)
+}
+
+// Cast returns the selector 'CAST(selector AS typ)' to convert a selector to
+// a different native type.
+func Cast(selector, typ string) string {
+	return fmt.Sprintf("CAST(%s AS %s)", selector, typ)
+}
+
+// ToJSON returns the selector 'toJson(selector)' to get the JSON
+// representation of a selector.
+func ToJSON(selector string) string {
+	return Func("toJson", selector)
+}
+
+// CountOf returns the aggregate 'COUNT(col)' to count the rows with a value
+// in the column, use Session.Count to count all the rows.
+func CountOf(col string) string {
+	return fmt.Sprintf("COUNT(%s)", col)
+}
+
+// Min returns the aggregate 'MIN(col)'. Aggregates can be scanned into
+// scalars with Scan, or into structs with TypeScan using As:
+// 	sess.Select(Tweet{}).Columns(As(Min("time"), "time")).Where(Eq("timeline", "ecql")).TypeScan()
+func Min(col string) string {
+	return fmt.Sprintf("MIN(%s)", col)
+}
+
+// Max returns the aggregate 'MAX(col)'.
+func Max(col string) string {
+	return fmt.Sprintf("MAX(%s)", col)
+}
+
+// Sum returns the aggregate 'SUM(col)'.
+func Sum(col string) string {
+	return fmt.Sprintf("SUM(%s)", col)
+}
+
+// Avg returns the aggregate 'AVG(col)'.
+func Avg(col string) string {
+	return fmt.Sprintf("AVG(%s)", col)
+}
+
+// Func returns the selector for a call to a native or user-defined function
+// with the given arguments: 'name(args...)'.
+func Func(name string, args ...string) string {
+	return fmt.Sprintf("%s(%s)", name, strings.Join(args, ", "))
+}
+
+// As adds an alias to a selector: 'selector AS alias'. The alias is the
+// name used to map the result in TypeScan and MapScan.
+func As(selector, alias string) string {
+	return fmt.Sprintf("%s AS %s", selector, alias)
+}
@@ -0,0 +1,71 @@
+package ecql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testSelectorStruct struct {
+	ID      string `cql:"id" cqltable:"selectors" cqlkey:"id"`
+	Text    string `cql:"text"`
+	Written int64  `cql:",writetime=text"`
+	Expires int    `cql:"text_ttl,ttl=text"`
+}
+
+func TestSelectors(t *testing.T) {
+	var tests = []struct {
+		selector string
+		expected string
+	}{
+		{WriteTime("text"), "WRITETIME(text)"},
+		{TTLOf("text"), "TTL(text)"},
+		{Token("id"), "token(id)"},
+		{Token("tenant", "bucket"), "token(tenant, bucket)"},
+		{Cast(WriteTime("text"), "text"), "CAST(WRITETIME(text) AS text)"},
+		{ToJSON("address"), "toJson(address)"},
+		{Func("now"), "now()"},
+		{Func("myfunc", "a", "b"), "myfunc(a, b)"},
+		{As(WriteTime("text"), "written"), "WRITETIME(text) AS written"},
+		{CountOf("text"), "COUNT(text)"},
+		{Min("time"), "MIN(time)"},
+		{Max("time"), "MAX(time)"},
+		{Sum("points"), "SUM(points)"},
+		{Avg("points"), "AVG(points)"},
+	}
+
+	for _, tc := range tests {
+		assert.Equal(t, tc.expected, tc.selector)
+	}
+}
+
+func TestRegisterSelectors(t *testing.T) {
+	DeleteRegistry()
+
+	v := testSelectorStruct{ID: "foo", Text: "bar", Written: 123, Expires: 60}
+	table := GetTable(v)
+	assert.Len(t, table.Columns, 2)
+	assert.Equal(t, []Column{
+		{Name: "written", Position: []int{2}, Selector: "WRITETIME(text)"},
+		{Name: "text_ttl", Position: []int{3}, Selector: "TTL(text)"},
+	}, table.Selectors)
+
+	// Selectors are scanned but not inserted
+	assert.Len(t, Map(&v), 4)
+	assert.Equal(t, []interface{}{"foo", "bar"}, Bind(v))
+
+	sess := &SessionImpl{}
+	cql, _ := sess.Select(v).BuildQuery()
+	assert.Equal(t, "SELECT id,text,WRITETIME(text) AS written,TTL(text) AS text_ttl FROM selectors", cql)
+	cql, _ = sess.Insert(v).BuildQuery()
+	assert.Equal(t, "INSERT INTO selectors (id,text) VALUES (?,?)", cql)
+	cql, _ = sess.Select(v).Columns("id", As(WriteTime("text"), "written")).BuildQuery()
+	assert.Equal(t, "SELECT id, WRITETIME(text) AS written FROM selectors", cql)
+	cql, _ = table.BuildQuery(selectQuery)
+	assert.Equal(t, "SELECT id,text,WRITETIME(text) AS written,TTL(text) AS text_ttl FROM selectors WHERE id = ?", cql)
+
+	// Selectors are not part of the schema
+	cql, err := CreateTable(v)
+	assert.NoError(t, err)
+	assert.Equal(t, "CREATE TABLE IF NOT EXISTS selectors (id text, text text, PRIMARY KEY (id))", cql)
+}
@@ -1,9 +1,14 @@
 package ecql
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"log"
+	"reflect"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/gocql/gocql"
 )
@@ -16,14 +21,43 @@ const (
 	DeleteCmd
 	UpdateCmd
 	CountCmd
+
+	// BatchCmd is the command of the *StatementError returned by batches.
+	BatchCmd
 )
 
+func (c Command) String() string {
+	switch c {
+	case SelectCmd:
+		return "SELECT"
+	case InsertCmd:
+		return "INSERT"
+	case DeleteCmd:
+		return "DELETE"
+	case UpdateCmd:
+		return "UPDATE"
+	case CountCmd:
+		return "SELECT COUNT"
+	case BatchCmd:
+		return "BATCH"
+	default:
+		return fmt.Sprintf("Command(%d)", int(c))
+	}
+}
+
 type Statement interface {
 	TypeScan() error
+	TypeScanContext(ctx context.Context) error
 	Scan(i ...interface{}) error
+	ScanContext(ctx context.Context, i ...interface{}) error
 	Exec() error
+	ExecContext(ctx context.Context) error
 	Iter() Iter
+	IterContext(ctx context.Context) Iter
 	BuildQuery() (string, []interface{})
+	BuildQueryE() (string, []interface{}, error)
+	Err() error
+	Clone() Statement
 	Do(cmd Command) Statement
 	From(table string) Statement
 	FromType(i interface{}) Statement
@@ -32,31 +66,67 @@ type Statement interface {
 	Where(cond ...Condition) Statement
 	OrderBy(order ...OrderBy) Statement
 	AllowFiltering() Statement
+	If(cond ...Condition) Statement
 	IfExists() Statement
 	IfNotExists() Statement
 	Bind(i interface{}) Statement
+	BindJSON(data json.RawMessage) Statement
+	JSON() Statement
+	OmitEmpty() Statement
 	Map(i interface{}) Statement
 	Limit(n int) Statement
+	PerPartitionLimit(n int) Statement
+	GroupBy(columns ...string) Statement
+	Distinct() Statement
+	PageSize(n int) Statement
+	PageState(state []byte) Statement
+	Page(dest interface{}, cursor string) (string, error)
+	PageContext(ctx context.Context, dest interface{}, cursor string) (string, error)
 	TTL(seconds int) Statement
 	Timestamp(microseconds int64) Statement
+	Consistency(c gocql.Consistency) Statement
+	SerialConsistency(c gocql.SerialConsistency) Statement
+	Idempotent(value bool) Statement
+	RetryPolicy(policy gocql.RetryPolicy) Statement
+	Timeout(d time.Duration) Statement
 }
 
 type StatementImpl struct {
-	session             *SessionImpl
-	Command             Command
-	Table               Table
-	ColumnNames         []string
-	Conditions          *Condition
-	Orders              []OrderBy
-	Assignments         map[string]interface{}
-	LimitValue          int
-	TTLValue            int
-	TimestampValue      int64
-	AllowFilteringValue bool
-	IfExistsValue       bool
-	IfNotExistsValue    bool
-	mapping             map[string]interface{}
-	values              []interface{}
+	session                *SessionImpl
+	Command                Command
+	Table                  Table
+	ColumnNames            []string
+	Conditions             *Condition
+	IfConditions           *Condition
+	Orders                 []OrderBy
+	Assignments            map[string]interface{}
+	assignmentOrder        []string
+	LimitValue             int
+	PerPartitionLimitValue int
+	GroupByColumns         []string
+	DistinctValue          bool
+	JSONValue              bool
+	JSONData               json.RawMessage
+	OmitEmptyValue         bool
+	PageSizeValue          int
+	PageStateValue         []byte
+	TTLValue               int
+	TimestampValue         int64
+	AllowFilteringValue    bool
+	IfExistsValue          bool
+	IfNotExistsValue       bool
+	ConsistencyValue       *gocql.Consistency
+	SerialConsistencyValue *gocql.SerialConsistency
+	IdempotentValue        bool
+	RetryPolicyValue       gocql.RetryPolicy
+	TimeoutValue           time.Duration
+	mapping                map[string]interface{}
+	values                 []interface{}
+	version                *version
+	paging                 bool
+	err                    error
+	template               *Template
+	args                   []interface{}
 }
 
 func NewStatement(sess *SessionImpl) Statement {
@@ -64,7 +134,16 @@ func NewStatement(sess *SessionImpl) Statement {
 }
 
 func (s *StatementImpl) TypeScan() error {
-	if query, err := s.query(); err != nil {
+	return s.TypeScanContext(context.Background())
+}
+
+// TypeScanContext is like TypeScan but the query will be executed with the
+// given context.
+func (s *StatementImpl) TypeScanContext(ctx context.Context) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	if query, err := s.query(ctx); err != nil {
 		return err
 	} else {
 		return query.MapScan(s.mapping)
@@ -72,7 +151,16 @@ func (s *StatementImpl) TypeScan() error {
 }
 
 func (s *StatementImpl) Scan(i ...interface{}) error {
-	if query, err := s.query(); err != nil {
+	return s.ScanContext(context.Background(), i...)
+}
+
+// ScanContext is like Scan but the query will be executed with the given
+// context.
+func (s *StatementImpl) ScanContext(ctx context.Context, i ...interface{}) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	if query, err := s.query(ctx); err != nil {
 		return err
 	} else {
 		return query.Scan(i...)
@@ -82,11 +170,34 @@ func (s *StatementImpl) Scan(i ...interface{}) error {
 // Exec builds the query statement and executes it returning nil or the gocql
 // error. On DELETE and UPDATE statements, the behavior of Exec differs from
 // gocql if IfExists() is used, in this case, ecql will perform a ScanCAS and
-// return ErrNotFound if the query was not applied.
+// return ErrNotFound if the query was not applied. If If() is used, ecql will
+// perform a MapScanCAS and return a *NotAppliedError with the current values
+// of the row if the query was not applied.
 func (s *StatementImpl) Exec() error {
-	if query, err := s.query(); err != nil {
+	return s.ExecContext(context.Background())
+}
+
+// ExecContext is like Exec but the query will be executed with the given
+// context.
+func (s *StatementImpl) ExecContext(ctx context.Context) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	if query, err := s.query(ctx); err != nil {
 		return err
 	} else {
+		// Perform a MapScanCAS and increment the version if the update is successful.
+		if s.version != nil && s.Command == UpdateCmd {
+			values := make(map[string]interface{})
+			if applied, err := query.MapScanCAS(values); err != nil {
+				return err
+			} else if applied == false {
+				return ErrConcurrentModification
+			}
+			s.version.increment()
+			return nil
+		}
+
 		// Perform a ScanCAS and reeturn an error if the update/delete are not successful.
 		if s.IfExistsValue && (s.Command == UpdateCmd || s.Command == DeleteCmd) {
 			if applied, err := query.ScanCAS(); err != nil {
@@ -97,23 +208,200 @@ func (s *StatementImpl) Exec() error {
 			return nil
 		}
 
+		// Perform a MapScanCAS and return the current values if the update/delete are not successful.
+		if s.IfConditions != nil && (s.Command == UpdateCmd || s.Command == DeleteCmd) {
+			values := make(map[string]interface{})
+			if applied, err := query.MapScanCAS(values); err != nil {
+				return err
+			} else if applied == false {
+				return &NotAppliedError{Values: values}
+			}
+			return nil
+		}
+
 		return query.Exec()
 	}
 }
 
 func (s *StatementImpl) Iter() Iter {
+	return s.IterContext(context.Background())
+}
+
+// IterContext is like Iter but the query will be executed with the given
+// context.
+func (s *StatementImpl) IterContext(ctx context.Context) Iter {
 	return &IterImpl{
 		statement: s,
+		ctx:       ctx,
 	}
 }
 
-func (s *StatementImpl) query() (*gocql.Query, error) {
-	stmt, args := s.BuildQuery()
-	return s.session.Query(stmt, args...), nil
+// withTimeout returns a context with the timeout of the statement, if any.
+func (s *StatementImpl) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.TimeoutValue > 0 {
+		return context.WithTimeout(ctx, s.TimeoutValue)
+	}
+	return ctx, func() {}
+}
+
+func (s *StatementImpl) query(ctx context.Context) (Query, error) {
+	stmt, args, err := s.BuildQueryE()
+	if err != nil {
+		return nil, err
+	}
+
+	// Statement options take precedence over the defaults of the table.
+	table := s.Table
+	if s.ConsistencyValue != nil {
+		table.Consistency = s.ConsistencyValue
+	}
+	if s.SerialConsistencyValue != nil {
+		table.SerialConsistency = s.SerialConsistencyValue
+	}
+
+	query := s.session.query(ctx, table, stmt, args...)
+	if s.IdempotentValue {
+		query = query.Idempotent(true)
+	}
+	if s.RetryPolicyValue != nil {
+		query = query.RetryPolicy(s.RetryPolicyValue)
+	}
+	if s.PageSizeValue > 0 {
+		query = query.PageSize(s.PageSizeValue)
+	}
+	if s.paging {
+		query = query.PageState(s.PageStateValue)
+	}
+	return query, nil
 }
 
 // BuildQuery returns the statement query and arguments that will be executed.
+// It does not validate the statement and panics if the command is not valid,
+// BuildQueryE can be used to get an error instead.
 func (s *StatementImpl) BuildQuery() (string, []interface{}) {
+	cql, args, err := s.buildQuery()
+	if err != nil {
+		panic(err)
+	}
+	return cql, args
+}
+
+// BuildQueryE is like BuildQuery but it validates the statement first, and
+// returns the error of Err if the statement is not valid.
+func (s *StatementImpl) BuildQueryE() (string, []interface{}, error) {
+	if err := s.Err(); err != nil {
+		return "", nil, err
+	}
+	return s.buildQuery()
+}
+
+// Err returns a *StatementError if the statement is not valid, like
+// UPDATE or DELETE statements without a WHERE clause, clauses not supported
+// by the command, as LIMIT on INSERT statements or TTL on DELETE statements,
+// or unknown columns in Columns or Set on statements of registered types.
+// Statements are validated before being executed.
+func (s *StatementImpl) Err() error {
+	if s.err != nil {
+		return s.err
+	}
+	if s.Table.err != nil {
+		return s.newError(s.Table.err, s.Table.errDetail)
+	}
+	if s.template != nil {
+		if len(s.args) != s.template.binds {
+			return s.newError(ErrBindCount, fmt.Sprintf("%d, expected %d", len(s.args), s.template.binds))
+		}
+		return nil
+	}
+
+	switch s.Command {
+	case SelectCmd, InsertCmd, DeleteCmd, UpdateCmd, CountCmd:
+	default:
+		return s.newError(ErrInvalidCommand, "")
+	}
+
+	if s.Table.Name == "" {
+		return s.newError(ErrMissingTable, "")
+	}
+
+	isSelect := s.Command == SelectCmd
+	isMutation := s.Command == UpdateCmd || s.Command == DeleteCmd
+	clauses := []struct {
+		name  string
+		set   bool
+		valid bool
+	}{
+		{"WHERE", s.Conditions != nil, s.Command != InsertCmd},
+		{"SET", len(s.Assignments) > 0, s.Command == UpdateCmd},
+		{"JSON", s.JSONValue, isSelect || s.Command == InsertCmd},
+		{"DISTINCT", s.DistinctValue, isSelect},
+		{"GROUP BY", len(s.GroupByColumns) > 0, isSelect},
+		{"ORDER BY", len(s.Orders) > 0, isSelect},
+		{"PER PARTITION LIMIT", s.PerPartitionLimitValue > 0, isSelect},
+		{"LIMIT", s.LimitValue > 0, isSelect},
+		{"ALLOW FILTERING", s.AllowFilteringValue, isSelect || s.Command == CountCmd},
+		{"IF NOT EXISTS", s.IfNotExistsValue, s.Command == InsertCmd},
+		{"IF EXISTS", s.IfExistsValue, isMutation && s.IfConditions == nil},
+		{"IF", s.IfConditions != nil, isMutation},
+		{"TTL", s.TTLValue > 0, s.Command == InsertCmd || s.Command == UpdateCmd},
+		{"USING TIMESTAMP", s.TimestampValue > 0, s.Command == InsertCmd || isMutation},
+	}
+	for _, c := range clauses {
+		if c.set && !c.valid {
+			return s.newError(ErrInvalidClause, c.name)
+		}
+	}
+
+	if isMutation && s.Conditions == nil {
+		return s.newError(ErrMissingWhere, "")
+	}
+	if s.Command == UpdateCmd && len(s.ColumnNames) == 0 && len(s.Assignments) == 0 && s.version == nil {
+		return s.newError(ErrMissingAssignments, "")
+	}
+
+	// Columns can only be validated on registered types. Selectors and
+	// quoted names are not validated.
+	if len(s.Table.Columns) > 0 {
+		for _, col := range s.ColumnNames {
+			if isIdentifier(col) && !s.Table.hasColumn(col) {
+				return s.newError(ErrUnknownColumn, col)
+			}
+		}
+		for _, col := range s.assignmentColumns() {
+			if isIdentifier(col) && !s.Table.hasColumn(col) {
+				return s.newError(ErrUnknownColumn, col)
+			}
+		}
+	}
+
+	return nil
+}
+
+// newError returns a *StatementError for the statement.
+func (s *StatementImpl) newError(err error, detail string) error {
+	return &StatementError{
+		Command: s.Command,
+		Table:   s.Table.Name,
+		Detail:  detail,
+		Err:     err,
+	}
+}
+
+// setError sets the error returned by Err, only the first error is kept.
+func (s *StatementImpl) setError(err error, detail string) {
+	if s.err == nil {
+		s.err = s.newError(err, detail)
+	}
+}
+
+// buildQuery returns the statement query and arguments without validating
+// the statement.
+func (s *StatementImpl) buildQuery() (string, []interface{}, error) {
+	// Statements of a template use the query of the template.
+	if s.template != nil {
+		return s.template.cql, s.args, nil
+	}
+
 	var cql []string
 
 	// Query with specific column names
@@ -121,13 +409,27 @@ func (s *StatementImpl) BuildQuery() (string, []interface{}) {
 
 	switch s.Command {
 	case SelectCmd:
-		if withColumnNames {
-			cql = append(cql, fmt.Sprintf("SELECT %s FROM %s", strings.Join(s.ColumnNames, ", "), s.Table.Name))
+		cql = append(cql, "SELECT")
+		if s.JSONValue {
+			cql = append(cql, "JSON")
+		}
+		if s.DistinctValue {
+			// Distinct selects the partition keys by default.
+			columns := s.ColumnNames
+			if !withColumnNames {
+				columns = s.Table.PartitionKey
+			}
+			cql = append(cql, fmt.Sprintf("DISTINCT %s FROM %s", strings.Join(columns, ", "), s.Table.Name))
+		} else if withColumnNames {
+			cql = append(cql, fmt.Sprintf("%s FROM %s", strings.Join(s.ColumnNames, ", "), s.Table.Name))
 		} else {
-			cql = append(cql, fmt.Sprintf("SELECT %s FROM %s", s.Table.getCols(), s.Table.Name))
+			cql = append(cql, fmt.Sprintf("%s FROM %s", s.Table.getSelectCols(), s.Table.Name))
 		}
 	case InsertCmd:
-		if withColumnNames {
+		if s.JSONValue {
+			// Columns not present in the document are left unchanged.
+			cql = append(cql, fmt.Sprintf("INSERT INTO %s JSON ? DEFAULT UNSET", s.Table.Name))
+		} else if withColumnNames {
 			cql = append(cql, fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", s.Table.Name, strings.Join(s.ColumnNames, ", "), qms(len(s.ColumnNames))))
 		} else {
 			cql = append(cql, fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", s.Table.Name, s.Table.getCols(), s.Table.getQms()))
@@ -153,38 +455,51 @@ func (s *StatementImpl) BuildQuery() (string, []interface{}) {
 	case CountCmd:
 		cql = append(cql, fmt.Sprintf("SELECT COUNT(1) FROM %s", s.Table.Name))
 	default:
-		// This should not happen
-		panic(ErrInvalidCommand)
+		return "", nil, s.newError(ErrInvalidCommand, "")
 	}
 
 	var args []interface{}
 
 	// On UPDATE: SET col = ?
 	if s.Command == UpdateCmd {
-		i := 0
-		assignments := make([]string, len(s.Assignments)+len(s.ColumnNames))
-
+		var assignments []string
 		for _, col := range s.ColumnNames {
-			assignments[i] = fmt.Sprintf("%s = ?", col)
-			args = append(args, s.mapping[col])
-			i++
+			if s.version != nil && col == s.version.Column {
+				continue
+			}
+			assignments = append(assignments, fmt.Sprintf("%s = ?", col))
+			args = append(args, s.bindValue(col, s.mapping[col]))
 		}
-		for col, v := range s.Assignments {
-			switch vv := v.(type) {
+		for _, col := range s.assignmentColumns() {
+			switch vv := s.Assignments[col].(type) {
 			case increaseType:
-				assignments[i] = fmt.Sprintf("%s = %s + ?", col, col)
+				assignments = append(assignments, fmt.Sprintf("%s = %s + ?", col, col))
 				args = append(args, int64(vv))
 			case decreaseType:
-				assignments[i] = fmt.Sprintf("%s = %s - ?", col, col)
+				assignments = append(assignments, fmt.Sprintf("%s = %s - ?", col, col))
 				args = append(args, int64(vv))
+			case appendType:
+				assignments = append(assignments, fmt.Sprintf("%s = %s + ?", col, col))
+				args = append(args, vv.values)
+			case prependType:
+				assignments = append(assignments, fmt.Sprintf("%s = ? + %s", col, col))
+				args = append(args, vv.values)
+			case removeType:
+				assignments = append(assignments, fmt.Sprintf("%s = %s - ?", col, col))
+				args = append(args, vv.values)
+			case elementType:
+				assignments = append(assignments, fmt.Sprintf("%s[?] = ?", col))
+				args = append(args, vv.key, vv.value)
 			default:
-				assignments[i] = fmt.Sprintf("%s = ?", col)
-				args = append(args, v)
+				assignments = append(assignments, fmt.Sprintf("%s = ?", col))
+				args = append(args, vv)
 			}
-
-			i++
 		}
-		if i > 0 {
+		if s.version != nil {
+			assignments = append(assignments, fmt.Sprintf("%s = ?", s.version.Column))
+			args = append(args, s.version.Next)
+		}
+		if len(assignments) > 0 {
 			cql = append(cql, "SET", strings.Join(assignments, ", "))
 		}
 	}
@@ -195,8 +510,12 @@ func (s *StatementImpl) BuildQuery() (string, []interface{}) {
 		args = append(args, s.Conditions.Values...)
 	}
 
-	// On SELECT: ORDER BY ... LIMIT n
+	// On SELECT: GROUP BY ... ORDER BY ... PER PARTITION LIMIT n LIMIT n
 	if s.Command == SelectCmd {
+		if len(s.GroupByColumns) > 0 {
+			cql = append(cql, "GROUP BY", strings.Join(s.GroupByColumns, ", "))
+		}
+
 		if len(s.Orders) > 0 {
 			cql = append(cql, "ORDER BY")
 			orders := make([]string, len(s.Orders))
@@ -206,6 +525,10 @@ func (s *StatementImpl) BuildQuery() (string, []interface{}) {
 			cql = append(cql, strings.Join(orders, ", "))
 		}
 
+		if s.PerPartitionLimitValue > 0 {
+			cql = append(cql, fmt.Sprintf("PER PARTITION LIMIT %d", s.PerPartitionLimitValue))
+		}
+
 		if s.LimitValue > 0 {
 			cql = append(cql, fmt.Sprintf("LIMIT %d", s.LimitValue))
 		}
@@ -215,8 +538,20 @@ func (s *StatementImpl) BuildQuery() (string, []interface{}) {
 		}
 	}
 
+	if s.Command == CountCmd && s.AllowFilteringValue {
+		cql = append(cql, "ALLOW FILTERING")
+	}
+
 	// On INSERT: IF NOT EXISTS USING TTL n
 	if s.Command == InsertCmd {
+		if s.JSONValue {
+			doc, err := s.jsonDocument()
+			if err != nil {
+				return "", nil, s.newError(err, "")
+			}
+			args = append(args, doc)
+		}
+
 		if s.IfNotExistsValue {
 			cql = append(cql, "IF NOT EXISTS")
 		}
@@ -230,23 +565,36 @@ func (s *StatementImpl) BuildQuery() (string, []interface{}) {
 		}
 
 		// Add values
-		if len(s.values) > 0 {
+		if len(s.values) > 0 && !s.JSONValue {
 			if withColumnNames {
 				for _, col := range s.ColumnNames {
-					args = append(args, s.mapping[col])
+					args = append(args, s.bindValue(col, s.mapping[col]))
 				}
 			} else {
 				for i := range s.values {
-					args = append(args, s.values[i])
+					args = append(args, s.bindValue(s.Table.Columns[i].Name, s.values[i]))
 				}
 			}
 		}
 	}
 
-	// ON UPDATE/DELETE: ... IF EXISTS
+	// ON UPDATE/DELETE: ... IF EXISTS or IF conditions
 	if s.Command == UpdateCmd || s.Command == DeleteCmd {
-		if s.IfExistsValue {
+		// Versioned updates already imply the existence of the row.
+		conditions := s.IfConditions
+		if s.version != nil {
+			cond := Eq(s.version.Column, s.version.Current)
+			if conditions != nil {
+				cond = And(cond, *conditions)
+			}
+			conditions = &cond
+		}
+
+		if s.IfExistsValue && s.version == nil {
 			cql = append(cql, "IF EXISTS")
+		} else if conditions != nil {
+			cql = append(cql, "IF", conditions.CQLFragment)
+			args = append(args, conditions.Values...)
 		}
 	}
 
@@ -254,7 +602,70 @@ func (s *StatementImpl) BuildQuery() (string, []interface{}) {
 		log.Println(cql, args)
 	}
 
-	return strings.Join(cql, " "), args
+	return strings.Join(cql, " "), args, nil
+}
+
+// Clone returns a copy of the statement that can be modified without
+// changing the original one. Values bound or mapped with Bind or Map are
+// shared, so Map should be used on the copy to scan into a different struct.
+func (s *StatementImpl) Clone() Statement {
+	c := *s
+	c.ColumnNames = cloneStrings(s.ColumnNames)
+	c.Orders = append([]OrderBy(nil), s.Orders...)
+	c.GroupByColumns = cloneStrings(s.GroupByColumns)
+	c.values = append([]interface{}(nil), s.values...)
+	c.args = append([]interface{}(nil), s.args...)
+	if s.Conditions != nil {
+		c.Conditions = cloneCondition(*s.Conditions)
+	}
+	if s.IfConditions != nil {
+		c.IfConditions = cloneCondition(*s.IfConditions)
+	}
+	if s.Assignments != nil {
+		c.Assignments = make(map[string]interface{}, len(s.Assignments))
+		for k, v := range s.Assignments {
+			c.Assignments[k] = v
+		}
+		c.assignmentOrder = cloneStrings(s.assignmentOrder)
+	}
+	if s.mapping != nil {
+		c.mapping = make(map[string]interface{}, len(s.mapping))
+		for k, v := range s.mapping {
+			c.mapping[k] = v
+		}
+	}
+	if s.ConsistencyValue != nil {
+		v := *s.ConsistencyValue
+		c.ConsistencyValue = &v
+	}
+	if s.SerialConsistencyValue != nil {
+		v := *s.SerialConsistencyValue
+		c.SerialConsistencyValue = &v
+	}
+	if s.version != nil {
+		v := *s.version
+		c.version = &v
+	}
+	if s.JSONData != nil {
+		c.JSONData = append(json.RawMessage{}, s.JSONData...)
+	}
+	if s.PageStateValue != nil {
+		c.PageStateValue = append([]byte{}, s.PageStateValue...)
+	}
+	return &c
+}
+
+func cloneStrings(list []string) []string {
+	if list == nil {
+		return nil
+	}
+	return append([]string{}, list...)
+}
+
+func cloneCondition(cond Condition) *Condition {
+	cond.Values = append([]interface{}(nil), cond.Values...)
+	cond.equals = append([]equality(nil), cond.equals...)
+	return &cond
 }
 
 func (s *StatementImpl) Do(cmd Command) Statement {
@@ -267,9 +678,15 @@ func (s *StatementImpl) From(table string) Statement {
 	return s
 }
 
+// FromType sets the table of the statement, including its default
+// consistency levels, from the registered type of i.
 func (s *StatementImpl) FromType(i interface{}) Statement {
-	table := GetTable(i)
-	return s.From(table.Name)
+	if !isStruct(i) {
+		s.setError(ErrInvalidType, fmt.Sprintf("%T", i))
+		return s
+	}
+	s.Table = GetTable(i)
+	return s
 }
 
 // Columns define a list of columns to get on SELECT statements, to set on
@@ -279,18 +696,52 @@ func (s *StatementImpl) Columns(columns ...string) Statement {
 	return s
 }
 
-// Set allows to add a new Set to an UPDATE statement.
+// Set allows to add a new Set to an UPDATE statement. The value can be one of
+// the operators Inc, Dec, Append, Prepend, Add, Put, Remove, RemoveKeys, Index
+// or Key to modify counters or collections.
 func (s *StatementImpl) Set(column string, value interface{}) Statement {
 	if s.Assignments == nil {
 		s.Assignments = make(map[string]interface{})
 	}
+	if _, ok := s.Assignments[column]; !ok {
+		s.assignmentOrder = append(s.assignmentOrder, column)
+	}
 	s.Assignments[column] = value
 	return s
 }
 
+// assignmentColumns returns the columns in Assignments in the order they were
+// set, so the query of a statement is always the same. Columns added directly
+// to the map are sorted after them.
+func (s *StatementImpl) assignmentColumns() []string {
+	columns := make([]string, 0, len(s.Assignments))
+	seen := make(map[string]bool, len(s.Assignments))
+	for _, col := range s.assignmentOrder {
+		if _, ok := s.Assignments[col]; ok && !seen[col] {
+			columns = append(columns, col)
+			seen[col] = true
+		}
+	}
+	n := len(columns)
+	for col := range s.Assignments {
+		if !seen[col] {
+			columns = append(columns, col)
+		}
+	}
+	sort.Strings(columns[n:])
+	return columns
+}
+
 // Where Conditionss are implicitly And with each other
 func (s *StatementImpl) Where(cond ...Condition) Statement {
+	if len(cond) == 0 {
+		s.setError(ErrEmptyCondition, "WHERE")
+		return s
+	}
 	and := And(cond[0], cond[1:]...)
+	if and.err != nil {
+		s.setError(and.err, and.detail)
+	}
 	s.Conditions = &and
 	return s
 }
@@ -301,11 +752,90 @@ func (s *StatementImpl) OrderBy(order ...OrderBy) Statement {
 }
 
 func (s *StatementImpl) Bind(i interface{}) Statement {
+	if !isStruct(i) {
+		s.setError(ErrInvalidType, fmt.Sprintf("%T", i))
+		return s
+	}
 	s.values, s.mapping, s.Table = BindTable(i)
 	return s
 }
 
+// BindJSON sets the JSON document inserted by an INSERT statement, the keys
+// of the document are the names of the columns. It enables the JSON mode.
+func (s *StatementImpl) BindJSON(data json.RawMessage) Statement {
+	s.JSONData = data
+	s.JSONValue = true
+	return s
+}
+
+// JSON enables the JSON mode of the statement. On SELECT statements each row
+// is returned as a JSON document in a single column that can be scanned into
+// a json.RawMessage:
+// 	var doc json.RawMessage
+// 	err := sess.Select(Tweet{}).JSON().Where(Eq("id", id)).Scan(&doc)
+//
+// On INSERT statements, the bound struct is inserted as a JSON document using
+// the column names as keys, if Columns is used, only those columns are set.
+// The statement uses DEFAULT UNSET, so the columns not present in the
+// document are not modified.
+func (s *StatementImpl) JSON() Statement {
+	s.JSONValue = true
+	return s
+}
+
+// jsonDocument returns the JSON document of an INSERT JSON statement.
+func (s *StatementImpl) jsonDocument() (string, error) {
+	if s.JSONData != nil {
+		return string(s.JSONData), nil
+	}
+
+	names := s.ColumnNames
+	if len(names) == 0 {
+		for _, col := range s.Table.Columns {
+			names = append(names, col.Name)
+		}
+	}
+
+	// Unset columns are not included in the document.
+	var columns []string
+	for _, col := range names {
+		if s.bindValue(col, s.mapping[col]) != gocql.UnsetValue {
+			columns = append(columns, col)
+		}
+	}
+	return encodeJSON(columns, s.mapping)
+}
+
+// OmitEmpty binds an unset value instead of the empty values of the columns
+// that are not part of the primary key on INSERT and UPDATE statements, so
+// those columns are not modified. It is like using the option omitempty in
+// all the fields of the bound struct.
+// 	err := sess.Insert(User{ID: id, Email: email}).OmitEmpty().Exec()
+func (s *StatementImpl) OmitEmpty() Statement {
+	s.OmitEmptyValue = true
+	return s
+}
+
+// bindValue returns the value to bind for a column, gocql.UnsetValue if
+// OmitEmpty is used and the value is empty.
+func (s *StatementImpl) bindValue(col string, v interface{}) interface{} {
+	if !s.OmitEmptyValue || s.Table.isKey(col) || col == s.Table.VersionColumn {
+		return v
+	}
+	if udt, ok := v.(UDT); ok && isEmpty(udt.value) {
+		return gocql.UnsetValue
+	}
+	if isEmpty(reflect.ValueOf(v)) {
+		return gocql.UnsetValue
+	}
+	return v
+}
+
 func (s *StatementImpl) Map(i interface{}) Statement {
+	if !isStruct(i) {
+		s.setError(ErrInvalidType, fmt.Sprintf("%T", i))
+		return s
+	}
 	s.mapping, s.Table = MapTable(i)
 	return s
 }
@@ -315,6 +845,44 @@ func (s *StatementImpl) Limit(n int) Statement {
 	return s
 }
 
+// PerPartitionLimit limits the number of rows returned from each partition
+// on SELECT statements.
+func (s *StatementImpl) PerPartitionLimit(n int) Statement {
+	s.PerPartitionLimitValue = n
+	return s
+}
+
+// GroupBy groups the rows of a SELECT statement by the given primary key
+// columns, the partition key must be included. It is commonly used with
+// aggregates like Max or Sum.
+func (s *StatementImpl) GroupBy(columns ...string) Statement {
+	s.GroupByColumns = columns
+	return s
+}
+
+// Distinct selects only the distinct partition keys on SELECT statements.
+// If no columns are set with Columns, the partition key of the table is used.
+func (s *StatementImpl) Distinct() Statement {
+	s.DistinctValue = true
+	return s
+}
+
+// PageSize sets the number of rows fetched at a time by the iterators.
+func (s *StatementImpl) PageSize(n int) Statement {
+	s.PageSizeValue = n
+	return s
+}
+
+// PageState sets the paging state returned by Iter.PageState to resume the
+// query from that point. Setting it disables the automatic paging, so the
+// iterators will only return one page of results, a nil state returns the
+// first page.
+func (s *StatementImpl) PageState(state []byte) Statement {
+	s.PageStateValue = state
+	s.paging = true
+	return s
+}
+
 func (s *StatementImpl) TTL(seconds int) Statement {
 	s.TTLValue = seconds
 	return s
@@ -325,11 +893,62 @@ func (s *StatementImpl) Timestamp(microseconds int64) Statement {
 	return s
 }
 
+// Consistency sets the consistency level of the statement, overriding the
+// default of the type.
+func (s *StatementImpl) Consistency(c gocql.Consistency) Statement {
+	s.ConsistencyValue = &c
+	return s
+}
+
+// SerialConsistency sets the consistency level for the serial phase of
+// conditional statements, overriding the default of the type.
+func (s *StatementImpl) SerialConsistency(c gocql.SerialConsistency) Statement {
+	s.SerialConsistencyValue = &c
+	return s
+}
+
+// Idempotent marks the statement as idempotent, so it can be retried or
+// speculatively executed by gocql.
+func (s *StatementImpl) Idempotent(value bool) Statement {
+	s.IdempotentValue = value
+	return s
+}
+
+// RetryPolicy sets the gocql retry policy used by the statement.
+func (s *StatementImpl) RetryPolicy(policy gocql.RetryPolicy) Statement {
+	s.RetryPolicyValue = policy
+	return s
+}
+
+// Timeout sets the maximum duration of the statement, after it the context
+// of the query will be canceled. On iterators the timeout includes the time
+// until Close is called.
+func (s *StatementImpl) Timeout(d time.Duration) Statement {
+	s.TimeoutValue = d
+	return s
+}
+
 func (s *StatementImpl) AllowFiltering() Statement {
 	s.AllowFilteringValue = true
 	return s
 }
 
+// If adds an IF clause to UPDATE or DELETE statements, conditions are
+// implicitly And with each other. If the statement is not applied Exec
+// will return a *NotAppliedError.
+func (s *StatementImpl) If(cond ...Condition) Statement {
+	if len(cond) == 0 {
+		s.setError(ErrEmptyCondition, "IF")
+		return s
+	}
+	and := And(cond[0], cond[1:]...)
+	if and.err != nil {
+		s.setError(and.err, and.detail)
+	}
+	s.IfConditions = &and
+	return s
+}
+
 func (s *StatementImpl) IfExists() Statement {
 	s.IfExistsValue = true
 	return s
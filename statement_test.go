@@ -0,0 +1,474 @@
+package ecql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildQueryIf(t *testing.T) {
+	var tests = []struct {
+		stmt Statement
+		cql  string
+		args []interface{}
+	}{
+		{
+			NewStatement(nil).Do(UpdateCmd).From("tweet").Set("text", "foo").Where(Eq("id", 1)).If(Eq("version", 2)),
+			"UPDATE tweet SET text = ? WHERE id = ? IF version = ?",
+			[]interface{}{"foo", 1, 2},
+		},
+		{
+			NewStatement(nil).Do(UpdateCmd).From("tweet").Set("text", "foo").Where(Eq("id", 1)).If(Eq("version", 2), Eq("text", "bar")),
+			"UPDATE tweet SET text = ? WHERE id = ? IF version = ? AND text = ?",
+			[]interface{}{"foo", 1, 2, "bar"},
+		},
+		{
+			NewStatement(nil).Do(DeleteCmd).From("tweet").Where(Eq("id", 1)).If(In("status", "a", "b")),
+			"DELETE FROM tweet WHERE id = ? IF status IN (?,?)",
+			[]interface{}{1, "a", "b"},
+		},
+		{
+			NewStatement(nil).Do(DeleteCmd).From("tweet").Where(Eq("id", 1)).If(Eq("version", 2)).IfExists(),
+			"DELETE FROM tweet WHERE id = ? IF EXISTS",
+			[]interface{}{1},
+		},
+	}
+
+	for _, tc := range tests {
+		cql, args := tc.stmt.BuildQuery()
+		assert.Equal(t, tc.cql, cql)
+		assert.Equal(t, tc.args, args)
+	}
+}
+
+func TestBuildQuerySelect(t *testing.T) {
+	DeleteRegistry()
+
+	sess := &SessionImpl{}
+	var tests = []struct {
+		stmt Statement
+		cql  string
+		args []interface{}
+	}{
+		{
+			sess.Select(testStruct{}).Columns("f1", Max("f22")).Where(Eq("f1", "foo")).GroupBy("f1"),
+			"SELECT f1, MAX(f22) FROM mytable WHERE f1 = ? GROUP BY f1",
+			[]interface{}{"foo"},
+		},
+		{
+			sess.Select(testStruct{}).Distinct(),
+			"SELECT DISTINCT f1 FROM mytable",
+			nil,
+		},
+		{
+			sess.Select(testStruct{}).Columns("f1", "f4").Distinct().Limit(10),
+			"SELECT DISTINCT f1, f4 FROM mytable LIMIT 10",
+			nil,
+		},
+		{
+			sess.Select(testStruct{}).Columns("f1").OrderBy(Desc("f22")).PerPartitionLimit(2).Limit(10).AllowFiltering(),
+			"SELECT f1 FROM mytable ORDER BY f22 DESC PER PARTITION LIMIT 2 LIMIT 10 ALLOW FILTERING",
+			nil,
+		},
+		{
+			sess.Count(testStruct{}).Where(Eq("f22", 1)).AllowFiltering(),
+			"SELECT COUNT(1) FROM mytable WHERE f22 = ? ALLOW FILTERING",
+			[]interface{}{1},
+		},
+	}
+
+	for _, tc := range tests {
+		cql, args := tc.stmt.BuildQuery()
+		assert.Equal(t, tc.cql, cql)
+		assert.Equal(t, tc.args, args)
+	}
+}
+
+func TestBuildQueryOperators(t *testing.T) {
+	var tests = []struct {
+		value interface{}
+		cql   string
+		args  []interface{}
+	}{
+		{Inc(2), "UPDATE users SET c = c + ? WHERE id = ?", []interface{}{int64(2), 1}},
+		{Dec(2), "UPDATE users SET c = c - ? WHERE id = ?", []interface{}{int64(2), 1}},
+		{Append([]string{"a"}), "UPDATE users SET c = c + ? WHERE id = ?", []interface{}{[]string{"a"}, 1}},
+		{Prepend([]string{"a"}), "UPDATE users SET c = ? + c WHERE id = ?", []interface{}{[]string{"a"}, 1}},
+		{Add([]string{"a"}), "UPDATE users SET c = c + ? WHERE id = ?", []interface{}{[]string{"a"}, 1}},
+		{Put(map[string]int{"a": 1}), "UPDATE users SET c = c + ? WHERE id = ?", []interface{}{map[string]int{"a": 1}, 1}},
+		{Remove([]string{"a"}), "UPDATE users SET c = c - ? WHERE id = ?", []interface{}{[]string{"a"}, 1}},
+		{RemoveKeys([]string{"a"}), "UPDATE users SET c = c - ? WHERE id = ?", []interface{}{[]string{"a"}, 1}},
+		{Index(2, "a"), "UPDATE users SET c[?] = ? WHERE id = ?", []interface{}{2, "a", 1}},
+		{Key("a", 3), "UPDATE users SET c[?] = ? WHERE id = ?", []interface{}{"a", 3, 1}},
+	}
+
+	for _, tc := range tests {
+		cql, args := NewStatement(nil).Do(UpdateCmd).From("users").Set("c", tc.value).Where(Eq("id", 1)).BuildQuery()
+		assert.Equal(t, tc.cql, cql)
+		assert.Equal(t, tc.args, args)
+	}
+}
+
+func TestBuildQueryVersion(t *testing.T) {
+	DeleteRegistry()
+
+	sess := &SessionImpl{}
+	v := testVersionStruct{ID: "foo", Text: "bar", Version: 2}
+
+	cql, args := sess.Update(v).Set("text", "zar").BuildQuery()
+	assert.Equal(t, "UPDATE versioned SET text = ?, version = ? WHERE id = ? IF version = ?", cql)
+	assert.Equal(t, []interface{}{"zar", 3, "foo", 2}, args)
+
+	cql, args = sess.Update(v).Columns("text", "version").If(Eq("text", "bar")).IfExists().BuildQuery()
+	assert.Equal(t, "UPDATE versioned SET text = ?, version = ? WHERE id = ? IF version = ? AND text = ?", cql)
+	assert.Equal(t, []interface{}{"bar", 3, "foo", 2, "bar"}, args)
+}
+
+// optionsExecutor is an Executor that records the options of the queries.
+type optionsExecutor struct {
+	options map[string]interface{}
+	entries []gocql.BatchEntry
+}
+
+func (e *optionsExecutor) Query(ctx context.Context, stmt string, args ...interface{}) Query {
+	e.options = make(map[string]interface{})
+	if deadline, ok := ctx.Deadline(); ok {
+		e.options["deadline"] = deadline
+	}
+	return optionsQuery{e}
+}
+
+func (e *optionsExecutor) Batch(ctx context.Context, typ gocql.BatchType, entries []gocql.BatchEntry) BatchQuery {
+	e.Query(ctx, "")
+	e.entries = entries
+	return optionsBatch{optionsQuery{e}}
+}
+
+type optionsQuery struct {
+	*optionsExecutor
+}
+
+func (q optionsQuery) Exec() error                                          { return nil }
+func (q optionsQuery) Scan(dest ...interface{}) error                       { return nil }
+func (q optionsQuery) MapScan(m map[string]interface{}) error               { return nil }
+func (q optionsQuery) ScanCAS(dest ...interface{}) (bool, error)            { return true, nil }
+func (q optionsQuery) MapScanCAS(dest map[string]interface{}) (bool, error) { return true, nil }
+func (q optionsQuery) Iter() Rows                                           { return nil }
+func (q optionsQuery) PageSize(n int) Query                                 { return q }
+func (q optionsQuery) PageState(state []byte) Query                         { return q }
+
+func (q optionsQuery) set(name string, value interface{}) optionsQuery {
+	q.options[name] = value
+	return q
+}
+
+func (q optionsQuery) Consistency(c gocql.Consistency) Query {
+	return q.set("consistency", c)
+}
+
+func (q optionsQuery) SerialConsistency(c gocql.SerialConsistency) Query {
+	return q.set("serial", c)
+}
+
+func (q optionsQuery) Idempotent(value bool) Query {
+	return q.set("idempotent", value)
+}
+
+func (q optionsQuery) RetryPolicy(policy gocql.RetryPolicy) Query {
+	return q.set("retry", policy)
+}
+
+type optionsBatch struct {
+	optionsQuery
+}
+
+func (b optionsBatch) MapExecCAS(dest map[string]interface{}) (bool, Rows, error) {
+	return true, nil, nil
+}
+
+func (b optionsBatch) Consistency(c gocql.Consistency) BatchQuery {
+	b.set("consistency", c)
+	return b
+}
+
+func (b optionsBatch) SerialConsistency(c gocql.SerialConsistency) BatchQuery {
+	b.set("serial", c)
+	return b
+}
+
+func (b optionsBatch) RetryPolicy(policy gocql.RetryPolicy) BatchQuery {
+	b.set("retry", policy)
+	return b
+}
+
+func (b optionsBatch) WithTimestamp(timestamp int64) BatchQuery {
+	b.set("timestamp", timestamp)
+	return b
+}
+
+type testConsistencyStruct struct {
+	ID   string `cql:"id" cqltable:"consistent" cqlconsistency:"local_quorum,local_serial"`
+	Text string `cql:"text"`
+}
+
+func TestStatementOptions(t *testing.T) {
+	DeleteRegistry()
+
+	e := &optionsExecutor{}
+	sess := NewWithExecutor(e).(*SessionImpl)
+	v := testConsistencyStruct{ID: "foo", Text: "bar"}
+
+	// Without options
+	assert.NoError(t, NewStatement(sess).Do(DeleteCmd).From("consistent").Where(Eq("id", "foo")).Exec())
+	assert.Empty(t, e.options)
+
+	// Defaults of the type
+	for _, stmt := range []Statement{sess.Select(v), sess.Insert(v), sess.Update(v).Columns("text"), sess.Delete(v), sess.Count(v)} {
+		assert.NoError(t, stmt.Exec())
+		assert.Equal(t, map[string]interface{}{"consistency": gocql.LocalQuorum, "serial": gocql.LocalSerial}, e.options)
+	}
+	assert.NoError(t, sess.Set(v))
+	assert.Equal(t, map[string]interface{}{"consistency": gocql.LocalQuorum, "serial": gocql.LocalSerial}, e.options)
+	assert.NoError(t, sess.Get(&v, "foo"))
+	assert.Equal(t, map[string]interface{}{"consistency": gocql.LocalQuorum, "serial": gocql.LocalSerial}, e.options)
+
+	// Statement options
+	policy := &gocql.SimpleRetryPolicy{NumRetries: 3}
+	assert.NoError(t, sess.Select(v).Consistency(gocql.One).SerialConsistency(gocql.Serial).Idempotent(true).RetryPolicy(policy).Timeout(time.Minute).Exec())
+	deadline, ok := e.options["deadline"].(time.Time)
+	if assert.True(t, ok) {
+		assert.WithinDuration(t, time.Now().Add(time.Minute), deadline, time.Second)
+	}
+	delete(e.options, "deadline")
+	assert.Equal(t, map[string]interface{}{"consistency": gocql.One, "serial": gocql.Serial, "idempotent": true, "retry": policy}, e.options)
+	assert.NoError(t, NewStatement(sess).From("consistent").Consistency(gocql.Two).Exec())
+	assert.Equal(t, map[string]interface{}{"consistency": gocql.Two}, e.options)
+
+	// Batch options
+	assert.NoError(t, sess.Batch().Add(sess.Insert(v).Idempotent(true), sess.Delete(v)).Apply())
+	assert.Empty(t, e.options)
+	assert.True(t, e.entries[0].Idempotent)
+	assert.False(t, e.entries[1].Idempotent)
+
+	b := sess.Batch().Add(sess.Insert(v), sess.Delete(v))
+	_, err := b.Consistency(gocql.Quorum).SerialConsistency(gocql.LocalSerial).Idempotent(true).RetryPolicy(policy).Timeout(time.Minute).Timestamp(1462800000000000).ApplyCAS()
+	assert.NoError(t, err)
+	_, ok = e.options["deadline"].(time.Time)
+	assert.True(t, ok)
+	delete(e.options, "deadline")
+	assert.Equal(t, map[string]interface{}{"consistency": gocql.Quorum, "serial": gocql.LocalSerial, "retry": policy, "timestamp": int64(1462800000000000)}, e.options)
+	assert.True(t, e.entries[0].Idempotent)
+	assert.True(t, e.entries[1].Idempotent)
+}
+
+func TestStatementErr(t *testing.T) {
+	DeleteRegistry()
+
+	sess := &SessionImpl{}
+	v := testStruct{F1: "foo"}
+	var tests = []struct {
+		stmt   Statement
+		err    error
+		detail string
+	}{
+		{sess.Select(v), nil, ""},
+		{sess.Select(v).Columns("f1", Max("f22"), "f4").Where(Eq("f1", "foo")).Limit(1), nil, ""},
+		{sess.Insert(v).Columns("f1").IfNotExists().TTL(60), nil, ""},
+		{sess.Update(v).Columns("f22").TTL(60).Timestamp(1), nil, ""},
+		{sess.Update(v).Set("f22", Inc(1)).If(Eq("f22", 1)), nil, ""},
+		{sess.Delete(v).Columns("f4").IfExists(), nil, ""},
+		{sess.Count(v).Where(Eq("f1", "foo")).AllowFiltering(), nil, ""},
+		{NewStatement(sess).Do(SelectCmd).From("mytable").Columns("unknown"), nil, ""},
+		{NewStatement(sess).Do(Command(99)).From("mytable"), ErrInvalidCommand, ""},
+		{NewStatement(sess).Do(SelectCmd), ErrMissingTable, ""},
+		{sess.Select("not a struct"), ErrInvalidType, "string"},
+		{sess.Insert(nil), ErrInvalidType, "<nil>"},
+		{sess.Update(1), ErrInvalidType, "int"},
+		{sess.Delete([]string{}), ErrInvalidType, "[]string"},
+		{sess.Select(v).Where(), ErrEmptyCondition, "WHERE"},
+		{sess.Update(v).Columns("f22").If(), ErrEmptyCondition, "IF"},
+		{NewStatement(sess).Do(DeleteCmd).FromType(v), ErrMissingWhere, ""},
+		{NewStatement(sess).Do(UpdateCmd).FromType(v).Set("f22", 1), ErrMissingWhere, ""},
+		{sess.Update(v), ErrMissingAssignments, ""},
+		{sess.Insert(v).Limit(10), ErrInvalidClause, "LIMIT"},
+		{sess.Insert(v).Where(Eq("f1", "foo")), ErrInvalidClause, "WHERE"},
+		{sess.Insert(v).IfExists(), ErrInvalidClause, "IF EXISTS"},
+		{sess.Delete(v).TTL(60), ErrInvalidClause, "TTL"},
+		{sess.Select(v).TTL(60), ErrInvalidClause, "TTL"},
+		{sess.Select(v).Timestamp(1), ErrInvalidClause, "USING TIMESTAMP"},
+		{sess.Select(v).IfNotExists(), ErrInvalidClause, "IF NOT EXISTS"},
+		{sess.Update(v).Columns("f22").IfNotExists(), ErrInvalidClause, "IF NOT EXISTS"},
+		{sess.Update(v).Columns("f22").IfExists().If(Eq("f22", 1)), ErrInvalidClause, "IF EXISTS"},
+		{sess.Delete(v).OrderBy(Asc("f1")), ErrInvalidClause, "ORDER BY"},
+		{sess.Delete(v).JSON(), ErrInvalidClause, "JSON"},
+		{sess.Count(v).GroupBy("f1"), ErrInvalidClause, "GROUP BY"},
+		{sess.Count(v).Distinct(), ErrInvalidClause, "DISTINCT"},
+		{sess.Count(v).PerPartitionLimit(1), ErrInvalidClause, "PER PARTITION LIMIT"},
+		{sess.Insert(v).AllowFiltering(), ErrInvalidClause, "ALLOW FILTERING"},
+		{sess.Select(v).Set("f22", 1), ErrInvalidClause, "SET"},
+		{sess.Select(v).Columns("f1", "unknown"), ErrUnknownColumn, "unknown"},
+		{sess.Insert(v).Columns("f5"), ErrUnknownColumn, "f5"},
+		{sess.Update(v).Set("unknown", 1), ErrUnknownColumn, "unknown"},
+	}
+
+	for _, tc := range tests {
+		err := tc.stmt.Err()
+		if tc.err == nil {
+			assert.NoError(t, err)
+			continue
+		}
+		if assert.Error(t, err) {
+			assert.True(t, errors.Is(err, tc.err), err.Error())
+			if assert.IsType(t, &StatementError{}, err) {
+				assert.Equal(t, tc.detail, err.(*StatementError).Detail)
+			}
+		}
+
+		cql, args, err2 := tc.stmt.BuildQueryE()
+		assert.Equal(t, err, err2)
+		assert.Empty(t, cql)
+		assert.Nil(t, args)
+	}
+}
+
+func TestStatementError(t *testing.T) {
+	err := &StatementError{Command: DeleteCmd, Table: "mytable", Err: ErrMissingWhere}
+	assert.Equal(t, "invalid DELETE statement on mytable: missing WHERE clause", err.Error())
+	err = &StatementError{Command: InsertCmd, Table: "mytable", Detail: "LIMIT", Err: ErrInvalidClause}
+	assert.Equal(t, "invalid INSERT statement on mytable: invalid clause LIMIT", err.Error())
+	err = &StatementError{Command: Command(99), Err: ErrInvalidCommand}
+	assert.Equal(t, "invalid Command(99) statement: invalid cql command", err.Error())
+	assert.True(t, errors.Is(err, ErrInvalidCommand))
+}
+
+func TestStatementErrNotExecuted(t *testing.T) {
+	DeleteRegistry()
+
+	e := &optionsExecutor{}
+	sess := NewWithExecutor(e).(*SessionImpl)
+	v := testConsistencyStruct{ID: "foo", Text: "bar"}
+
+	// Invalid statements are not executed
+	stmt := NewStatement(sess).Do(DeleteCmd).FromType(v)
+	assert.True(t, errors.Is(stmt.Exec(), ErrMissingWhere))
+	assert.True(t, errors.Is(stmt.Scan(), ErrMissingWhere))
+	assert.True(t, errors.Is(sess.Select(v).TTL(1).TypeScan(), ErrInvalidClause))
+	iter := sess.Select(v).Columns("unknown").Iter()
+	assert.False(t, iter.Scan())
+	assert.True(t, errors.Is(iter.Close(), ErrUnknownColumn))
+	assert.Nil(t, e.options)
+
+	// Batches return the first error
+	err := sess.Batch().Add(sess.Insert(v), sess.Update(v), sess.Delete(v).TTL(1)).Apply()
+	assert.True(t, errors.Is(err, ErrMissingAssignments))
+	_, err = sess.Batch().Add(sess.Insert(v).Limit(1)).ApplyCAS()
+	assert.True(t, errors.Is(err, ErrInvalidClause))
+	assert.Nil(t, e.options)
+	assert.Nil(t, e.entries)
+
+	// BuildQuery still panics on invalid commands
+	assert.Panics(t, func() { NewStatement(sess).Do(Command(99)).BuildQuery() })
+}
+
+func TestStatementClone(t *testing.T) {
+	DeleteRegistry()
+
+	sess := &SessionImpl{}
+	v := testStruct{F1: "foo", F2: 1}
+	stmt := sess.Select(v).Columns("f1").Where(Eq("f1", "foo")).OrderBy(Asc("f22")).Consistency(gocql.One)
+	cql, args := stmt.BuildQuery()
+
+	c := stmt.Clone()
+	assert.Equal(t, stmt, c)
+	c.Columns("f1", "f22").Where(Eq("f1", "bar")).OrderBy(Desc("f22")).Limit(1).Consistency(gocql.All)
+	c.(*StatementImpl).Conditions.Values[0] = "zar"
+	c.(*StatementImpl).ColumnNames[0] = "f4"
+
+	cql2, args2 := stmt.BuildQuery()
+	assert.Equal(t, cql, cql2)
+	assert.Equal(t, args, args2)
+	assert.Equal(t, gocql.One, *stmt.(*StatementImpl).ConsistencyValue)
+	cql, args = c.BuildQuery()
+	assert.Equal(t, "SELECT f4, f22 FROM mytable WHERE f1 = ? ORDER BY f22 DESC LIMIT 1", cql)
+	assert.Equal(t, []interface{}{"zar"}, args)
+
+	// Updates and errors
+	upd := sess.Update(v).Set("f22", Inc(1)).If(Eq("f22", 1))
+	c = upd.Clone()
+	c.Set("f4", "bar").If(Eq("f22", 2))
+	cql, args = upd.BuildQuery()
+	assert.Equal(t, "UPDATE mytable SET f22 = f22 + ? WHERE f1 = ? IF f22 = ?", cql)
+	assert.Equal(t, []interface{}{int64(1), "foo", 1}, args)
+
+	invalid := sess.Select(v).Where()
+	assert.Equal(t, invalid.Err(), invalid.Clone().Err())
+}
+
+func TestBuildQueryOmitEmpty(t *testing.T) {
+	DeleteRegistry()
+
+	sess := &SessionImpl{}
+	s := "foo"
+	unset := gocql.UnsetValue
+	var tests = []struct {
+		stmt Statement
+		cql  string
+		args []interface{}
+	}{
+		{
+			sess.Insert(testStruct{F1: "bar", F4: &s}).OmitEmpty(),
+			"INSERT INTO mytable (f1,f22,f3,f4) VALUES (?,?,?,?)",
+			[]interface{}{"bar", unset, unset, &s},
+		},
+		{
+			sess.Insert(testStruct{F2: 1}).Columns("f1", "f22", "f4").OmitEmpty(),
+			"INSERT INTO mytable (f1, f22, f4) VALUES (?,?,?)",
+			[]interface{}{"", 1, unset},
+		},
+		{
+			sess.Update(testStruct{F1: "bar", F3: map[string]string{}}).Columns("f22", "f3").OmitEmpty(),
+			"UPDATE mytable SET f22 = ?, f3 = ? WHERE f1 = ?",
+			[]interface{}{unset, unset, "bar"},
+		},
+		{
+			sess.Update(testStruct{F1: "bar"}).Columns("f22").Set("f4", nil).OmitEmpty(),
+			"UPDATE mytable SET f22 = ?, f4 = ? WHERE f1 = ?",
+			[]interface{}{unset, nil, "bar"},
+		},
+		{
+			sess.Insert(testStruct{F1: "bar", F2: 3}).JSON().OmitEmpty(),
+			"INSERT INTO mytable JSON ? DEFAULT UNSET",
+			[]interface{}{`{"f1":"bar","f22":3}`},
+		},
+		{
+			sess.Insert(testOmitEmptyStruct{ID: "id", Name: "name"}).JSON(),
+			"INSERT INTO omit JSON ? DEFAULT UNSET",
+			[]interface{}{`{"count":0,"id":"id","name":"name","version":0}`},
+		},
+	}
+
+	for _, tc := range tests {
+		cql, args := tc.stmt.BuildQuery()
+		assert.Equal(t, tc.cql, cql)
+		assert.Equal(t, tc.args, args)
+	}
+}
+
+func TestSessionInvalidType(t *testing.T) {
+	sess := &SessionImpl{}
+	n := 42
+	for _, i := range []interface{}{nil, 42, &n, "text", []testStruct{}, (*testStruct)(nil)} {
+		detail := fmt.Sprintf("%T", i)
+		assert.Equal(t, &StatementError{Command: SelectCmd, Detail: detail, Err: ErrInvalidType}, sess.Get(i, 1))
+		assert.Equal(t, &StatementError{Command: InsertCmd, Detail: detail, Err: ErrInvalidType}, sess.Set(i))
+		assert.Equal(t, &StatementError{Command: DeleteCmd, Detail: detail, Err: ErrInvalidType}, sess.Del(i))
+		ok, err := sess.Exists(i)
+		assert.False(t, ok)
+		assert.Equal(t, &StatementError{Command: CountCmd, Detail: detail, Err: ErrInvalidType}, err)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"strings"
 
 	"fmt"
+
+	"github.com/gocql/gocql"
 )
 
 type queryType int
@@ -16,25 +18,58 @@ const (
 	countQuery
 )
 
-// Table contains the information of a table in cassandra.
+// Table contains the information of a table in cassandra. KeyColumns
+// contains all the columns in the primary key, PartitionKey and
+// ClusteringColumns split them in the two parts of the key.
+//
+// Selectors are read-only columns computed from other columns, like their
+// write time, they are only used in SELECT statements.
+//
+// Consistency and SerialConsistency are the defaults used in the statements
+// of the table, nil values use the defaults of the session. If the tag
+// cqlconsistency is not valid, the statements of the table return an error
+// wrapping ErrInvalidConsistency.
 type Table struct {
-	Name       string
-	KeyColumns []string
-	Columns    []Column
+	Name              string
+	KeyColumns        []string
+	PartitionKey      []string
+	ClusteringColumns []string
+	Columns           []Column
+	Selectors         []Column
+	VersionColumn     string
+	Consistency       *gocql.Consistency
+	SerialConsistency *gocql.SerialConsistency
+	err               error
+	errDetail         string
 }
 
 // Column contains the information of a column in a table required
-// to create a map for it.
+// to create a map for it. Position is the index sequence of the field
+// in the struct as used by reflect.Value.FieldByIndex.
+//
+// Type, Static and Order are only used to generate the schema of the table.
+// Selector is the expression used to select the column, if it is not a
+// regular column. OmitEmpty columns are not set if the field is empty.
 type Column struct {
-	Name     string
-	Position int
+	Name      string
+	Position  []int
+	Type      string
+	Static    bool
+	Order     OrderType
+	Selector  string
+	OmitEmpty bool
 }
 
 func (t *Table) BuildQuery(qt queryType) (string, error) {
+	// Query types are defined in the same order as the commands.
+	if t.err != nil {
+		return "", &StatementError{Command: Command(qt), Table: t.Name, Detail: t.errDetail, Err: t.err}
+	}
+
 	var cql string
 	switch qt {
 	case selectQuery:
-		cql = fmt.Sprintf("SELECT %s FROM %s WHERE %s", t.getCols(), t.Name, appendCols(t.KeyColumns))
+		cql = fmt.Sprintf("SELECT %s FROM %s WHERE %s", t.getSelectCols(), t.Name, appendCols(t.KeyColumns))
 	case insertQuery:
 		cql = fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", t.Name, t.getCols(), t.getQms())
 	case deleteQuery:
@@ -51,6 +86,34 @@ func (t *Table) BuildQuery(qt queryType) (string, error) {
 	return cql, nil
 }
 
+func (t *Table) isKey(name string) bool {
+	for _, key := range t.KeyColumns {
+		if key == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *Table) isClusteringColumn(name string) bool {
+	for _, key := range t.ClusteringColumns {
+		if key == name {
+			return true
+		}
+	}
+	return false
+}
+
+// hasColumn returns true if name is one of the mapped columns of the table.
+func (t *Table) hasColumn(name string) bool {
+	for i := range t.Columns {
+		if t.Columns[i].Name == name {
+			return true
+		}
+	}
+	return false
+}
+
 func (t *Table) getCols() string {
 	names := make([]string, len(t.Columns))
 	for i := range t.Columns {
@@ -59,6 +122,16 @@ func (t *Table) getCols() string {
 	return strings.Join(names, ",")
 }
 
+// getSelectCols returns the columns and the selectors with their aliases
+// used in SELECT statements.
+func (t *Table) getSelectCols() string {
+	cols := t.getCols()
+	for _, col := range t.Selectors {
+		cols += "," + As(col.Selector, col.Name)
+	}
+	return cols
+}
+
 func (t *Table) getQms() string {
 	return qms(len(t.Columns))
 }
@@ -70,3 +143,20 @@ func appendCols(cols []string) string {
 	}
 	return strings.Join(parts, " AND ")
 }
+
+// isIdentifier returns true if name is an unquoted CQL identifier, and not a
+// selector like COUNT(*) or a quoted name.
+func isIdentifier(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		switch {
+		case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,60 @@
+package ecql
+
+// Template is a statement built once that can be executed multiple times
+// with different values. The query of the statement is built and validated
+// when the template is created, and only the values of the bind markers are
+// given on each execution. A template is safe for concurrent use.
+// 	tmpl, err := ecql.NewTemplate(sess.Select(Tweet{}).Where(ecql.Eq("id", nil)))
+// 	...
+// 	var tw Tweet
+// 	err = tmpl.Bind(id).Map(&tw).TypeScan()
+type Template struct {
+	stmt  *StatementImpl
+	cql   string
+	binds int
+}
+
+// NewTemplate creates a template from the given statement, the values in the
+// statement are only used to count the number of bind markers. It returns
+// the error of Statement.Err if the statement is not valid.
+func NewTemplate(stmt Statement) (*Template, error) {
+	impl, ok := stmt.(*StatementImpl)
+	if !ok {
+		return nil, ErrInvalidQueryType
+	}
+
+	cql, args, err := impl.BuildQueryE()
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Template{cql: cql, binds: len(args)}
+	t.stmt = impl.Clone().(*StatementImpl)
+	t.stmt.template = t
+	t.stmt.args = nil
+	t.stmt.values = nil
+	// Versioned statements will still return ErrConcurrentModification,
+	// but the version cannot be incremented on the original struct.
+	if t.stmt.version != nil {
+		t.stmt.version = &version{Column: t.stmt.version.Column}
+	}
+	return t, nil
+}
+
+// CQL returns the query of the template.
+func (t *Template) CQL() string {
+	return t.cql
+}
+
+// Bind returns a new statement with the query of the template and the given
+// values for its bind markers, in the order they appear in the query. The
+// statement will return an error if the number of values is not valid.
+//
+// Options like PageSize, Consistency or Timeout can be set on the returned
+// statement, but methods that modify the query, like Where or Columns, have
+// no effect.
+func (t *Template) Bind(values ...interface{}) Statement {
+	stmt := t.stmt.Clone().(*StatementImpl)
+	stmt.args = values
+	return stmt
+}
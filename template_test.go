@@ -0,0 +1,94 @@
+package ecql
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemplate(t *testing.T) {
+	DeleteRegistry()
+
+	sess := &SessionImpl{}
+	stmt := sess.Select(testStruct{}).Columns("f1", "f22").Where(Eq("f1", nil)).Limit(1)
+	tmpl, err := NewTemplate(stmt)
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT f1, f22 FROM mytable WHERE f1 = ? LIMIT 1", tmpl.CQL())
+
+	// Changes in the original statement do not modify the template
+	stmt.Where(Eq("f22", 1)).Limit(10)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := fmt.Sprintf("key-%d", i)
+			s := tmpl.Bind(key).PageSize(i + 1)
+			cql, args, err := s.BuildQueryE()
+			assert.NoError(t, err)
+			assert.Equal(t, "SELECT f1, f22 FROM mytable WHERE f1 = ? LIMIT 1", cql)
+			assert.Equal(t, []interface{}{key}, args)
+			assert.Equal(t, i+1, s.(*StatementImpl).PageSizeValue)
+		}(i)
+	}
+	wg.Wait()
+
+	// Builder methods do not change the query
+	cql, args := tmpl.Bind("foo").Where(Eq("f22", 1)).Columns("f4").BuildQuery()
+	assert.Equal(t, "SELECT f1, f22 FROM mytable WHERE f1 = ? LIMIT 1", cql)
+	assert.Equal(t, []interface{}{"foo"}, args)
+
+	// Invalid number of values
+	for _, values := range [][]interface{}{nil, {"foo", "bar"}} {
+		s := tmpl.Bind(values...)
+		err := s.Err()
+		assert.True(t, errors.Is(err, ErrBindCount))
+		_, _, err = s.BuildQueryE()
+		assert.True(t, errors.Is(err, ErrBindCount))
+	}
+
+	// Invalid statements
+	_, err = NewTemplate(sess.Insert(testStruct{}).Limit(1))
+	assert.True(t, errors.Is(err, ErrInvalidClause))
+	_, err = NewTemplate(&struct{ Statement }{stmt})
+	assert.Equal(t, ErrInvalidQueryType, err)
+}
+
+func TestTemplateUpdate(t *testing.T) {
+	DeleteRegistry()
+
+	sess := &SessionImpl{}
+	tmpl, err := NewTemplate(sess.Update(testStruct{}).Set("f22", Inc(1)).If(Eq("f4", nil)).TTL(60))
+	assert.NoError(t, err)
+	assert.Equal(t, "UPDATE mytable USING TTL 60 SET f22 = f22 + ? WHERE f1 = ? IF f4 = ?", tmpl.CQL())
+
+	cql, args, err := tmpl.Bind(int64(2), "foo", "bar").BuildQueryE()
+	assert.NoError(t, err)
+	assert.Equal(t, tmpl.CQL(), cql)
+	assert.Equal(t, []interface{}{int64(2), "foo", "bar"}, args)
+}
+
+func TestTemplateAssignmentOrder(t *testing.T) {
+	DeleteRegistry()
+
+	sess := &SessionImpl{}
+	for i := 0; i < 50; i++ {
+		stmt := sess.Update(testStruct{}).Set("f4", nil).Set("f22", nil).Set("f3", nil)
+		stmt.Set("f4", 1)
+		tmpl, err := NewTemplate(stmt)
+		assert.NoError(t, err)
+		assert.Equal(t, "UPDATE mytable SET f4 = ?, f22 = ?, f3 = ? WHERE f1 = ?", tmpl.CQL())
+	}
+
+	// Columns added directly to the map are sorted after the others
+	stmt := sess.Update(testStruct{}).Set("f4", 1).(*StatementImpl)
+	stmt.Assignments["f3"] = 3
+	stmt.Assignments["f22"] = 2
+	cql, args := stmt.BuildQuery()
+	assert.Equal(t, "UPDATE mytable SET f4 = ?, f22 = ?, f3 = ? WHERE f1 = ?", cql)
+	assert.Equal(t, []interface{}{1, 2, 3, ""}, args)
+}
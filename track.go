@@ -0,0 +1,205 @@
+package ecql
+
+import (
+	"context"
+	"reflect"
+)
+
+// Tracker keeps a snapshot of a struct to detect the columns modified after
+// it was loaded, so an UPDATE statement only sets those columns:
+// 	var tw Tweet
+// 	if err := sess.Get(&tw, id); err != nil {
+// 		...
+// 	}
+// 	tracker, err := ecql.Track(&tw)
+// 	if err != nil {
+// 		...
+// 	}
+// 	tw.Text = "new text"
+// 	err := tracker.Save(sess) // UPDATE tweet SET text = ? WHERE id = ?
+//
+// The primary key columns identify the row, so they are never updated and
+// Save and Update return an error wrapping ErrKeyModified if they change.
+// Version columns are handled by the UPDATE statement.
+type Tracker struct {
+	ptr      interface{}
+	value    reflect.Value
+	snapshot reflect.Value
+	table    Table
+}
+
+// Track returns a Tracker with a snapshot of the current values of i. It
+// returns ErrNotPointer if i is not a pointer, and ErrInvalidType if it does
+// not point to a struct.
+func Track(i interface{}) (*Tracker, error) {
+	v := reflect.ValueOf(i)
+	if v.Kind() != reflect.Ptr {
+		return nil, ErrNotPointer
+	}
+	if v.Elem().Kind() != reflect.Struct {
+		return nil, ErrInvalidType
+	}
+
+	t := &Tracker{
+		ptr:   i,
+		value: v.Elem(),
+		table: GetTable(i),
+	}
+	t.Reset()
+	return t, nil
+}
+
+// Reset takes a new snapshot of the struct, it is called after a successful
+// Save.
+func (t *Tracker) Reset() {
+	t.snapshot = deepCopy(t.value)
+}
+
+// Changes returns the columns modified since the snapshot was taken in the
+// order they are defined in the struct.
+func (t *Tracker) Changes() []string {
+	var columns []string
+	for _, col := range t.changes() {
+		columns = append(columns, col.Name)
+	}
+	return columns
+}
+
+// changes returns the regular columns modified since the snapshot was taken.
+func (t *Tracker) changes() []Column {
+	var columns []Column
+	for _, col := range t.table.Columns {
+		if t.table.isKey(col.Name) || col.Name == t.table.VersionColumn {
+			continue
+		}
+		if t.modified(col) {
+			columns = append(columns, col)
+		}
+	}
+	return columns
+}
+
+// keyError returns a *StatementError if a primary key column has been
+// modified since the snapshot was taken.
+func (t *Tracker) keyError() error {
+	for _, col := range t.table.Columns {
+		if t.table.isKey(col.Name) && t.modified(col) {
+			return &StatementError{
+				Command: UpdateCmd,
+				Table:   t.table.Name,
+				Detail:  col.Name,
+				Err:     ErrKeyModified,
+			}
+		}
+	}
+	return nil
+}
+
+func (t *Tracker) modified(col Column) bool {
+	current := t.value.FieldByIndex(col.Position).Interface()
+	previous := t.snapshot.FieldByIndex(col.Position).Interface()
+	return !reflect.DeepEqual(current, previous)
+}
+
+// Update returns an UPDATE statement of the tracked struct that only sets
+// the modified columns. The modified columns are set even if they are empty
+// and use the option omitempty. The statement will not be valid if there are
+// no changes and the type does not define a version column, or if a primary
+// key column has been modified.
+func (t *Tracker) Update(sess Session) Statement {
+	changes := t.changes()
+	columns := make([]string, len(changes))
+	for i, col := range changes {
+		columns[i] = col.Name
+	}
+
+	stmt := sess.Update(t.ptr).Columns(columns...)
+	if s, ok := stmt.(*StatementImpl); ok {
+		if err := t.keyError(); err != nil && s.err == nil {
+			s.err = err
+		}
+		for _, col := range changes {
+			s.mapping[col.Name] = valueOf(t.value.FieldByIndex(col.Position))
+		}
+	}
+	return stmt
+}
+
+// Save executes the UPDATE statement returned by Update if any column has
+// been modified, and takes a new snapshot on success.
+func (t *Tracker) Save(sess Session) error {
+	return t.SaveContext(context.Background(), sess)
+}
+
+// SaveContext is like Save but the query will be executed with the given
+// context.
+func (t *Tracker) SaveContext(ctx context.Context, sess Session) error {
+	if err := t.keyError(); err != nil {
+		return err
+	}
+	if len(t.Changes()) == 0 {
+		return nil
+	}
+	if err := t.Update(sess).ExecContext(ctx); err != nil {
+		return err
+	}
+	t.Reset()
+	return nil
+}
+
+// deepCopy returns a copy of v that does not share pointers, slices or maps
+// with it. Unexported fields are copied as they are.
+func deepCopy(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type().Elem())
+		c.Elem().Set(deepCopy(v.Elem()))
+		return c
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type()).Elem()
+		c.Set(deepCopy(v.Elem()))
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(deepCopy(v.Index(i)))
+		}
+		return c
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			c.SetMapIndex(deepCopy(iter.Key()), deepCopy(iter.Value()))
+		}
+		return c
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if f := c.Field(i); f.CanSet() {
+				f.Set(deepCopy(v.Field(i)))
+			}
+		}
+		return c
+	case reflect.Array:
+		c := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(deepCopy(v.Index(i)))
+		}
+		return c
+	default:
+		return v
+	}
+}
@@ -0,0 +1,129 @@
+package ecql
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+)
+
+type testTrackStruct struct {
+	ID      string            `cql:"id" cqltable:"tracked" cqlkey:"id"`
+	Name    string            `cql:"name"`
+	Tags    []string          `cql:"tags"`
+	Details map[string]string `cql:"details"`
+	Ptr     *int              `cql:"ptr"`
+	Time    time.Time         `cql:"time"`
+	UUID    gocql.UUID        `cql:"uuid"`
+	Address testAddress       `cql:"address"`
+	Skip    string            `cql:"-"`
+}
+
+func TestTrack(t *testing.T) {
+	DeleteRegistry()
+
+	n := 1
+	v := testTrackStruct{
+		ID:      "id",
+		Name:    "name",
+		Tags:    []string{"a", "b"},
+		Details: map[string]string{"a": "b"},
+		Ptr:     &n,
+		Time:    time.Now(),
+		UUID:    gocql.TimeUUID(),
+		Address: testAddress{Street: "street", Geo: testGeo{Lat: 1}},
+	}
+	tracker, err := Track(&v)
+	assert.NoError(t, err)
+	assert.Empty(t, tracker.Changes())
+
+	// Modifications in place
+	v.Tags[0] = "c"
+	v.Details["a"] = "c"
+	*v.Ptr = 2
+	v.Address.Geo.Lat = 2
+	v.Skip = "skip"
+	assert.Equal(t, []string{"tags", "details", "ptr", "address"}, tracker.Changes())
+
+	tracker.Reset()
+	assert.Empty(t, tracker.Changes())
+
+	v.Name = "other"
+	v.Time = v.Time.Add(time.Second)
+	v.UUID = gocql.TimeUUID()
+	assert.Equal(t, []string{"name", "time", "uuid"}, tracker.Changes())
+
+	sess := &SessionImpl{}
+	cql, args := tracker.Update(sess).BuildQuery()
+	assert.Equal(t, "UPDATE tracked SET name = ?, time = ?, uuid = ? WHERE id = ?", cql)
+	assert.Equal(t, []interface{}{"other", v.Time, v.UUID, &v.ID}, args)
+
+	// Keys cannot be updated
+	v.ID = "other"
+	assert.Equal(t, []string{"name", "time", "uuid"}, tracker.Changes())
+	err = tracker.Update(sess).Err()
+	assert.True(t, errors.Is(err, ErrKeyModified))
+	assert.Equal(t, "invalid UPDATE statement on tracked: primary key modified id", err.Error())
+	assert.Equal(t, err, tracker.Save(sess))
+	v.ID = "id"
+
+	// Nil values
+	v.Tags = nil
+	v.Ptr = nil
+	assert.Equal(t, []string{"name", "tags", "ptr", "time", "uuid"}, tracker.Changes())
+
+	_, err = Track(v)
+	assert.Equal(t, ErrNotPointer, err)
+	_, err = Track(&n)
+	assert.Equal(t, ErrInvalidType, err)
+	_, err = Track((*testTrackStruct)(nil))
+	assert.Equal(t, ErrInvalidType, err)
+	_, err = Track(nil)
+	assert.Equal(t, ErrNotPointer, err)
+}
+
+type testTrackOmitEmptyStruct struct {
+	ID   string `cql:"id" cqltable:"tracked_omitempty" cqlkey:"id"`
+	Name string `cql:"name,omitempty"`
+	Bio  string `cql:"bio,omitempty"`
+}
+
+func TestTrackOmitEmpty(t *testing.T) {
+	DeleteRegistry()
+
+	v := testTrackOmitEmptyStruct{ID: "id", Name: "name", Bio: "bio"}
+	tracker, err := Track(&v)
+	assert.NoError(t, err)
+
+	// Cleared fields are set to the empty value instead of unset
+	v.Name = ""
+	sess := &SessionImpl{}
+	cql, args := tracker.Update(sess).BuildQuery()
+	assert.Equal(t, "UPDATE tracked_omitempty SET name = ? WHERE id = ?", cql)
+	assert.Equal(t, []interface{}{"", &v.ID}, args)
+}
+
+func TestDeepCopy(t *testing.T) {
+	n := 1
+	var i interface{} = []int{1}
+	values := []interface{}{
+		nil, 1, "string", &n, []string{"a"}, []string(nil), map[string][]int{"a": {1}},
+		[2][]int{{1}, {2}}, testAddress{Street: "street"}, time.Now(), &i,
+	}
+	for _, value := range values {
+		v := reflect.ValueOf(value)
+		if !v.IsValid() {
+			continue
+		}
+		c := deepCopy(v)
+		assert.Equal(t, value, c.Interface())
+	}
+
+	s := []*int{&n}
+	c := deepCopy(reflect.ValueOf(s)).Interface().([]*int)
+	*c[0] = 2
+	assert.Equal(t, 1, n)
+}
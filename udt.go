@@ -0,0 +1,128 @@
+package ecql
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+var (
+	timeType           = reflect.TypeOf(time.Time{})
+	durationType       = reflect.TypeOf(gocql.Duration{})
+	marshalerType      = reflect.TypeOf((*gocql.Marshaler)(nil)).Elem()
+	unmarshalerType    = reflect.TypeOf((*gocql.Unmarshaler)(nil)).Elem()
+	udtMarshalerType   = reflect.TypeOf((*gocql.UDTMarshaler)(nil)).Elem()
+	udtUnmarshalerType = reflect.TypeOf((*gocql.UDTUnmarshaler)(nil)).Elem()
+)
+
+// UDT wraps a struct to marshal and unmarshal it as a CQL user-defined type
+// using the same rules used to map tables: the fields are mapped using the
+// tag 'cql' or the lowercase of the field name, and embedded structs are
+// flattened.
+//
+// Struct fields in mapped types are wrapped automatically, so a field of type
+// Address can be stored in a frozen<address> column without implementing
+// gocql.UDTMarshaler and gocql.UDTUnmarshaler. If the column is not a
+// user-defined type, like a tuple, the struct is marshaled by gocql as is.
+type UDT struct {
+	value reflect.Value
+}
+
+// NewUDT returns the UDT wrapper for i. To be able to unmarshal values, i must
+// be a pointer to a struct.
+func NewUDT(i interface{}) *UDT {
+	return &UDT{value: structOf(i)}
+}
+
+// MarshalCQL implements the gocql.Marshaler interface. User-defined types are
+// marshaled field by field, other types like tuples use the wrapped value.
+func (u UDT) MarshalCQL(info gocql.TypeInfo) ([]byte, error) {
+	if info.Type() == gocql.TypeUDT {
+		return gocql.Marshal(info, udtValue{u: &u})
+	}
+	return gocql.Marshal(info, u.value.Interface())
+}
+
+// UnmarshalCQL implements the gocql.Unmarshaler interface. User-defined types
+// are unmarshaled field by field, other types like tuples use the wrapped
+// value.
+func (u *UDT) UnmarshalCQL(info gocql.TypeInfo, data []byte) error {
+	if info.Type() == gocql.TypeUDT {
+		return gocql.Unmarshal(info, data, udtValue{u: u})
+	}
+	if !u.value.CanAddr() {
+		return nil
+	}
+	return gocql.Unmarshal(info, data, u.value.Addr().Interface())
+}
+
+// MarshalUDT implements the gocql.UDTMarshaler interface.
+func (u UDT) MarshalUDT(name string, info gocql.TypeInfo) ([]byte, error) {
+	field, ok := u.field(name)
+	if !ok {
+		return nil, nil
+	}
+	return gocql.Marshal(info, valueOf(field))
+}
+
+// UnmarshalUDT implements the gocql.UDTUnmarshaler interface.
+func (u *UDT) UnmarshalUDT(name string, info gocql.TypeInfo, data []byte) error {
+	field, ok := u.field(name)
+	if !ok || !field.CanAddr() {
+		return nil
+	}
+	return gocql.Unmarshal(info, data, addrOf(field))
+}
+
+// udtValue only implements gocql.UDTMarshaler and gocql.UDTUnmarshaler, so
+// gocql marshals the wrapped UDT field by field instead of calling MarshalCQL
+// and UnmarshalCQL again.
+type udtValue struct {
+	u *UDT
+}
+
+func (v udtValue) MarshalUDT(name string, info gocql.TypeInfo) ([]byte, error) {
+	return v.u.MarshalUDT(name, info)
+}
+
+func (v udtValue) UnmarshalUDT(name string, info gocql.TypeInfo, data []byte) error {
+	return v.u.UnmarshalUDT(name, info, data)
+}
+
+func (u UDT) field(name string) (reflect.Value, bool) {
+	table := getUDT(u.value.Type())
+	for _, col := range table.Columns {
+		if col.Name == name {
+			return u.value.FieldByIndex(col.Position), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// isUDT returns if a field of type t must be mapped as a user-defined type.
+func isUDT(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct || t == timeType || t == durationType {
+		return false
+	}
+
+	pt := reflect.PtrTo(t)
+	return !pt.Implements(marshalerType) && !pt.Implements(unmarshalerType) &&
+		!pt.Implements(udtMarshalerType) && !pt.Implements(udtUnmarshalerType)
+}
+
+// valueOf returns the value of field to bind in a query.
+func valueOf(field reflect.Value) interface{} {
+	if isUDT(field.Type()) {
+		return UDT{value: field}
+	}
+	return field.Interface()
+}
+
+// addrOf returns a reference to field to use it as a destination of a scan.
+func addrOf(field reflect.Value) interface{} {
+	if isUDT(field.Type()) {
+		return &UDT{value: field}
+	}
+	return field.Addr().Interface()
+}
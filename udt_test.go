@@ -0,0 +1,119 @@
+package ecql
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+)
+
+type testGeo struct {
+	Lat float64 `cql:"lat"`
+	Lon float64 `cql:"lon"`
+}
+
+type testAddress struct {
+	Street  string `cql:"street"`
+	Zip     int
+	Geo     testGeo `cql:"geo"`
+	Private string  `cql:"-"`
+}
+
+type testUDTStruct struct {
+	ID      string      `cql:"id" cqltable:"udt" cqlkey:"id"`
+	Address testAddress `cql:"address"`
+	Time    time.Time   `cql:"time"`
+}
+
+func TestIsUDT(t *testing.T) {
+	assert.True(t, isUDT(reflect.TypeOf(testAddress{})))
+	assert.False(t, isUDT(reflect.TypeOf(time.Time{})))
+	assert.False(t, isUDT(reflect.TypeOf(gocql.Duration{})))
+	assert.False(t, isUDT(reflect.TypeOf(&testAddress{})))
+	assert.False(t, isUDT(reflect.TypeOf("string")))
+}
+
+func TestUDT(t *testing.T) {
+	DeleteRegistry()
+
+	native := func(typ gocql.Type) gocql.TypeInfo {
+		return gocql.NewNativeType(4, typ, "")
+	}
+	info := gocql.UDTTypeInfo{
+		NativeType: gocql.NewNativeType(4, gocql.TypeUDT, ""),
+		Name:       "address",
+		Elements: []gocql.UDTField{
+			{Name: "street", Type: native(gocql.TypeText)},
+			{Name: "zip", Type: native(gocql.TypeInt)},
+			{Name: "geo", Type: gocql.UDTTypeInfo{
+				NativeType: gocql.NewNativeType(4, gocql.TypeUDT, ""),
+				Name:       "geo",
+				Elements: []gocql.UDTField{
+					{Name: "lat", Type: native(gocql.TypeDouble)},
+					{Name: "lon", Type: native(gocql.TypeDouble)},
+				},
+			}},
+			{Name: "country", Type: native(gocql.TypeText)},
+		},
+	}
+
+	v := testUDTStruct{
+		ID: "foo",
+		Address: testAddress{
+			Street:  "Main St",
+			Zip:     94105,
+			Geo:     testGeo{37.79, -122.39},
+			Private: "private",
+		},
+	}
+
+	values := Bind(v)
+	assert.IsType(t, UDT{}, values[1])
+	assert.IsType(t, time.Time{}, values[2])
+
+	data, err := gocql.Marshal(info, values[1])
+	assert.NoError(t, err)
+
+	var vv testUDTStruct
+	m := Map(&vv)
+	assert.NoError(t, gocql.Unmarshal(info, data, m["address"]))
+
+	v.Address.Private = ""
+	assert.Equal(t, v.Address, vv.Address)
+}
+
+type testPoint struct {
+	X int
+	Y int
+}
+
+type testTupleStruct struct {
+	ID    string    `cql:"id" cqltable:"tuples" cqlkey:"id"`
+	Point testPoint `cql:"point" cqltype:"frozen<tuple<int, int>>"`
+}
+
+func TestUDTTuple(t *testing.T) {
+	DeleteRegistry()
+
+	native := gocql.NewNativeType(4, gocql.TypeInt, "")
+	info := gocql.TupleTypeInfo{
+		NativeType: gocql.NewNativeType(4, gocql.TypeTuple, ""),
+		Elems:      []gocql.TypeInfo{native, native},
+	}
+
+	v := testTupleStruct{ID: "foo", Point: testPoint{1, 2}}
+	values := Bind(v)
+	data, err := gocql.Marshal(info, values[1])
+	assert.NoError(t, err)
+
+	expected, err := gocql.Marshal(info, v.Point)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, data)
+
+	var vv testTupleStruct
+	m := Map(&vv)
+	assert.NoError(t, gocql.Unmarshal(info, data, m["point"]))
+	assert.Equal(t, v.Point, vv.Point)
+}
@@ -0,0 +1,298 @@
+package ecql
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// SchemaError is the error returned by Session.ValidateSchema if the
+// registered types do not match the tables in the database.
+type SchemaError struct {
+	Diffs []SchemaDiff
+}
+
+func (e *SchemaError) Error() string {
+	parts := make([]string, len(e.Diffs))
+	for i := range e.Diffs {
+		parts[i] = e.Diffs[i].String()
+	}
+	return "schema mismatch: " + strings.Join(parts, "; ")
+}
+
+// SchemaDiff contains the differences between a registered type and its table
+// in the database.
+type SchemaDiff struct {
+	Table             string
+	MissingTable      bool
+	MissingColumns    []string
+	UnmappedColumns   []string
+	TypeMismatches    []TypeMismatch
+	PartitionKey      *KeyMismatch
+	ClusteringColumns *KeyMismatch
+}
+
+// TypeMismatch describes a column with a type in the database not compatible
+// with the type of the mapped field.
+type TypeMismatch struct {
+	Column   string
+	Expected string
+	Actual   string
+}
+
+// KeyMismatch describes a partition key or clustering columns that are not
+// the same in the registered type and in the database.
+type KeyMismatch struct {
+	Expected []string
+	Actual   []string
+}
+
+// IsEmpty returns true if there are no differences.
+func (d SchemaDiff) IsEmpty() bool {
+	return !d.MissingTable && len(d.MissingColumns) == 0 && len(d.UnmappedColumns) == 0 &&
+		len(d.TypeMismatches) == 0 && d.PartitionKey == nil && d.ClusteringColumns == nil
+}
+
+func (d SchemaDiff) String() string {
+	if d.MissingTable {
+		return fmt.Sprintf("table %s: missing table", d.Table)
+	}
+
+	var parts []string
+	if len(d.MissingColumns) > 0 {
+		parts = append(parts, fmt.Sprintf("missing columns %s", strings.Join(d.MissingColumns, ", ")))
+	}
+	if len(d.UnmappedColumns) > 0 {
+		parts = append(parts, fmt.Sprintf("unmapped columns %s", strings.Join(d.UnmappedColumns, ", ")))
+	}
+	for _, m := range d.TypeMismatches {
+		parts = append(parts, fmt.Sprintf("column %s is %s, expected %s", m.Column, m.Actual, m.Expected))
+	}
+	if d.PartitionKey != nil {
+		parts = append(parts, fmt.Sprintf("partition key is (%s), expected (%s)",
+			strings.Join(d.PartitionKey.Actual, ", "), strings.Join(d.PartitionKey.Expected, ", ")))
+	}
+	if d.ClusteringColumns != nil {
+		parts = append(parts, fmt.Sprintf("clustering columns are (%s), expected (%s)",
+			strings.Join(d.ClusteringColumns.Actual, ", "), strings.Join(d.ClusteringColumns.Expected, ", ")))
+	}
+	return fmt.Sprintf("table %s: %s", d.Table, strings.Join(parts, ", "))
+}
+
+// schemaColumn contains the information of a column in system_schema.columns.
+type schemaColumn struct {
+	Name     string
+	Type     string
+	Kind     string
+	Position int
+}
+
+// ValidateSchema reads the schema of the tables of all the types registered
+// using Register in the given keyspace and returns a *SchemaError with the
+// differences found. Types registered on the fly, like ad-hoc result structs,
+// and types used as user-defined types are not validated.
+func (s *SessionImpl) ValidateSchema(keyspace string) error {
+	tables := registry.tables()
+	types := make([]reflect.Type, 0, len(tables))
+	for t := range tables {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		return tables[types[i]].Name < tables[types[j]].Name
+	})
+
+	ctx := context.Background()
+	var diffs []SchemaDiff
+	for _, t := range types {
+		table := tables[t]
+		name := strings.ToLower(table.Name)
+
+		var tableName string
+		iter := s.exec().Query(ctx, "SELECT table_name FROM system_schema.tables WHERE keyspace_name = ? AND table_name = ?", keyspace, name).Iter()
+		exists := iter.Scan(&tableName)
+		if err := iter.Close(); err != nil {
+			return err
+		}
+
+		var columns []schemaColumn
+		if exists {
+			var col schemaColumn
+			iter = s.exec().Query(ctx, "SELECT column_name, type, kind, position FROM system_schema.columns WHERE keyspace_name = ? AND table_name = ?", keyspace, name).Iter()
+			for iter.Scan(&col.Name, &col.Type, &col.Kind, &col.Position) {
+				columns = append(columns, col)
+			}
+			if err := iter.Close(); err != nil {
+				return err
+			}
+		}
+
+		if diff := diffTable(t, table, exists, columns); !diff.IsEmpty() {
+			diffs = append(diffs, diff)
+		}
+	}
+
+	if len(diffs) > 0 {
+		return &SchemaError{Diffs: diffs}
+	}
+	return nil
+}
+
+// diffTable compares the registered table for the type t with the columns
+// read from system_schema.
+func diffTable(t reflect.Type, table Table, exists bool, columns []schemaColumn) SchemaDiff {
+	diff := SchemaDiff{Table: table.Name}
+	if !exists {
+		diff.MissingTable = true
+		return diff
+	}
+
+	actual := make(map[string]schemaColumn)
+	var partition, clustering []schemaColumn
+	for _, col := range columns {
+		actual[col.Name] = col
+		switch col.Kind {
+		case "partition_key":
+			partition = append(partition, col)
+		case "clustering":
+			clustering = append(clustering, col)
+		}
+	}
+
+	mapped := make(map[string]bool)
+	for _, col := range table.Columns {
+		name := strings.ToLower(col.Name)
+		mapped[name] = true
+
+		c, ok := actual[name]
+		if !ok {
+			diff.MissingColumns = append(diff.MissingColumns, col.Name)
+			continue
+		}
+
+		expected := col.Type
+		if expected == "" {
+			expected, _ = cqlTypeOf(t.FieldByIndex(col.Position).Type)
+		}
+		if expected != "" && !compatibleTypes(expected, c.Type) {
+			diff.TypeMismatches = append(diff.TypeMismatches, TypeMismatch{
+				Column:   col.Name,
+				Expected: expected,
+				Actual:   c.Type,
+			})
+		}
+	}
+
+	for _, col := range columns {
+		if !mapped[col.Name] {
+			diff.UnmappedColumns = append(diff.UnmappedColumns, col.Name)
+		}
+	}
+	sort.Strings(diff.UnmappedColumns)
+
+	diff.PartitionKey = diffKey(table.PartitionKey, partition)
+	diff.ClusteringColumns = diffKey(table.ClusteringColumns, clustering)
+	return diff
+}
+
+// diffKey compares the expected key columns with the ones in the database.
+func diffKey(expected []string, columns []schemaColumn) *KeyMismatch {
+	sort.Slice(columns, func(i, j int) bool {
+		return columns[i].Position < columns[j].Position
+	})
+
+	actual := make([]string, len(columns))
+	for i := range columns {
+		actual[i] = columns[i].Name
+	}
+
+	if len(expected) != len(actual) {
+		return &KeyMismatch{Expected: expected, Actual: actual}
+	}
+	for i := range expected {
+		if strings.ToLower(expected[i]) != actual[i] {
+			return &KeyMismatch{Expected: expected, Actual: actual}
+		}
+	}
+	return nil
+}
+
+// compatibleTypes returns if a field with the expected CQL type can be stored
+// in a column with the actual CQL type.
+func compatibleTypes(expected, actual string) bool {
+	en, ep := splitType(expected)
+	an, ap := splitType(actual)
+
+	// Frozen collections and user-defined types use the same Go types.
+	if en == "frozen" && len(ep) == 1 {
+		return compatibleTypes(ep[0], actual)
+	}
+	if an == "frozen" && len(ap) == 1 {
+		return compatibleTypes(expected, ap[0])
+	}
+
+	switch en {
+	case "text":
+		if an != "text" && an != "varchar" && an != "ascii" {
+			return false
+		}
+	case "uuid":
+		if an != "uuid" && an != "timeuuid" {
+			return false
+		}
+	case "tinyint", "smallint", "int", "bigint":
+		// gocql converts any Go integer to any CQL integer type.
+		switch an {
+		case "tinyint", "smallint", "int", "bigint", "varint", "counter":
+		default:
+			return false
+		}
+	case "list":
+		if an != "list" && an != "set" {
+			return false
+		}
+	default:
+		if en != an {
+			return false
+		}
+	}
+
+	if len(ep) != len(ap) {
+		return false
+	}
+	for i := range ep {
+		if !compatibleTypes(ep[i], ap[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// splitType splits a CQL type like map<text, frozen<list<int>>> in the
+// lowercase name of the type and its parameters.
+func splitType(typ string) (string, []string) {
+	typ = strings.ToLower(strings.TrimSpace(typ))
+	i := strings.Index(typ, "<")
+	if i < 0 || !strings.HasSuffix(typ, ">") {
+		return typ, nil
+	}
+
+	var params []string
+	depth, start := 0, i+1
+	for j := start; j < len(typ)-1; j++ {
+		switch typ[j] {
+		case '<':
+			depth++
+		case '>':
+			depth--
+		case ',':
+			if depth == 0 {
+				params = append(params, typ[start:j])
+				start = j + 1
+			}
+		}
+	}
+	params = append(params, typ[start:len(typ)-1])
+	return strings.TrimSpace(typ[:i]), params
+}
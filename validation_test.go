@@ -0,0 +1,123 @@
+package ecql
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testValidationStruct struct {
+	Tenant  string            `cql:"tenant" cqltable:"validation" cqlkey:"(tenant,bucket),time"`
+	Bucket  int32             `cql:"bucket"`
+	Time    time.Time         `cql:"time"`
+	Text    string            `cql:"text"`
+	Tags    []string          `cql:"tags"`
+	Count   int64             `cql:"count"`
+	Address testAddress       `cql:"address"`
+	Details map[string]string `cql:"details"`
+	Missing string            `cql:"missing"`
+}
+
+func TestDiffTable(t *testing.T) {
+	DeleteRegistry()
+
+	typ := reflect.TypeOf(testValidationStruct{})
+	table := GetTable(testValidationStruct{})
+
+	diff := diffTable(typ, table, false, nil)
+	assert.Equal(t, SchemaDiff{Table: "validation", MissingTable: true}, diff)
+	assert.False(t, diff.IsEmpty())
+
+	columns := []schemaColumn{
+		{"tenant", "text", "partition_key", 0},
+		{"bucket", "int", "partition_key", 1},
+		{"time", "timestamp", "clustering", 0},
+		{"text", "varchar", "regular", -1},
+		{"tags", "set<text>", "regular", -1},
+		{"count", "counter", "regular", -1},
+		{"address", "frozen<testaddress>", "regular", -1},
+		{"details", "map<text, text>", "regular", -1},
+		{"missing", "text", "regular", -1},
+	}
+	diff = diffTable(typ, table, true, columns)
+	assert.True(t, diff.IsEmpty(), diff.String())
+
+	columns = []schemaColumn{
+		{"bucket", "int", "partition_key", 0},
+		{"tenant", "text", "partition_key", 1},
+		{"time", "timestamp", "clustering", 0},
+		{"id", "uuid", "clustering", 1},
+		{"text", "int", "regular", -1},
+		{"tags", "list<int>", "regular", -1},
+		{"count", "bigint", "regular", -1},
+		{"address", "frozen<testaddress>", "regular", -1},
+		{"details", "map<text, text>", "regular", -1},
+		{"extra", "text", "regular", -1},
+	}
+	diff = diffTable(typ, table, true, columns)
+	assert.Equal(t, SchemaDiff{
+		Table:           "validation",
+		MissingColumns:  []string{"missing"},
+		UnmappedColumns: []string{"extra", "id"},
+		TypeMismatches: []TypeMismatch{
+			{"text", "text", "int"},
+			{"tags", "list<text>", "list<int>"},
+		},
+		PartitionKey: &KeyMismatch{
+			Expected: []string{"tenant", "bucket"},
+			Actual:   []string{"bucket", "tenant"},
+		},
+		ClusteringColumns: &KeyMismatch{
+			Expected: []string{"time"},
+			Actual:   []string{"time", "id"},
+		},
+	}, diff)
+	assert.Equal(t, "table validation: missing columns missing, unmapped columns extra, id, "+
+		"column text is int, expected text, column tags is list<int>, expected list<text>, "+
+		"partition key is (bucket, tenant), expected (tenant, bucket), "+
+		"clustering columns are (time, id), expected (time)", diff.String())
+}
+
+func TestCompatibleTypes(t *testing.T) {
+	var tests = []struct {
+		expected string
+		actual   string
+		ok       bool
+	}{
+		{"text", "text", true},
+		{"text", "varchar", true},
+		{"text", "int", false},
+		{"uuid", "timeuuid", true},
+		{"bigint", "counter", true},
+		{"bigint", "int", true},
+		{"int", "bigint", true},
+		{"smallint", "varint", true},
+		{"tinyint", "counter", true},
+		{"bigint", "text", false},
+		{"varint", "bigint", false},
+		{"list<text>", "set<text>", true},
+		{"list<text>", "map<text, text>", false},
+		{"frozen<address>", "address", true},
+		{"frozen<Address>", "frozen<address>", true},
+		{"map<text, frozen<list<bigint>>>", "map<text, frozen<list<bigint>>>", true},
+		{"map<text, frozen<list<bigint>>>", "map<text, list<int>>", true},
+		{"map<text, frozen<list<bigint>>>", "map<text, list<text>>", false},
+	}
+
+	for _, tc := range tests {
+		assert.Equal(t, tc.ok, compatibleTypes(tc.expected, tc.actual), tc.expected+" "+tc.actual)
+	}
+}
+
+func TestRegistryTables(t *testing.T) {
+	DeleteRegistry()
+
+	Register(testUDTStruct{})
+	Register(testAddress{})
+	GetTable(testValidationStruct{})
+	tables := registry.tables()
+	assert.Len(t, tables, 1)
+	assert.Equal(t, "udt", tables[reflect.TypeOf(testUDTStruct{})].Name)
+}
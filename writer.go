@@ -0,0 +1,450 @@
+package ecql
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+const (
+	// defaultMaxStatements is the default number of statements in the
+	// batches of a BatchWriter.
+	defaultMaxStatements = 100
+
+	// defaultMaxSize is the default size of the batches of a BatchWriter, it
+	// matches the default batch_size_warn_threshold in Cassandra (5KiB).
+	defaultMaxSize = 5 * 1024
+
+	// defaultConcurrency is the default number of batches executed at the
+	// same time by a BatchWriter.
+	defaultConcurrency = 4
+)
+
+// BatchWriter writes a large number of statements using UNLOGGED batches.
+// The statements are grouped by partition key, so each batch only touches one
+// partition, and a batch is flushed when it reaches the maximum number of
+// statements or size:
+// 	w := ecql.NewBatchWriter(sess).MaxStatements(50).Concurrency(8)
+// 	for _, tw := range tweets {
+// 		w.Write(sess.Insert(tw))
+// 	}
+// 	if err := w.Close(); err != nil {
+// 		for _, e := range err.(ecql.WriteErrors) {
+// 			...
+// 		}
+// 	}
+//
+// Statements on the same partition are applied in the order they are written.
+// The partition key is taken from the bound struct on INSERT statements and
+// from the WHERE clause on UPDATE and DELETE statements. Counter updates are
+// written using COUNTER batches. Statements without a partition key, like the
+// ones created from templates, conditional statements and statements with a
+// retry policy or a timeout are executed one by one, so their errors are the
+// ones returned by Statement.Exec.
+//
+// Batches are executed with the consistency of their statements, the one set
+// with Statement.Consistency or the default of the type, statements with
+// different consistencies are not batched together.
+//
+// The statements are built when they are flushed, so values bound by pointer,
+// like the keys in sess.Update(&v), must not be modified until then.
+type BatchWriter struct {
+	session       Session
+	ctx           context.Context
+	maxStatements int
+	maxSize       int
+	concurrency   int
+
+	mu      sync.Mutex
+	groups  map[string]*writeGroup
+	workers []chan *writeGroup
+	closed  bool
+
+	// doneMu protects the number of groups sent to the workers and the
+	// errors of the statements, done is signaled when all the groups have
+	// been executed.
+	doneMu  sync.Mutex
+	done    *sync.Cond
+	pending int
+	errs    WriteErrors
+}
+
+// writeGroup is a group of statements on the same partition executed in a
+// batch, or a single statement executed on its own.
+type writeGroup struct {
+	key         string
+	stmts       []Statement
+	size        int
+	counter     bool
+	single      bool
+	consistency *gocql.Consistency
+}
+
+// NewBatchWriter creates a BatchWriter that executes the batches using the
+// given session.
+func NewBatchWriter(sess Session) *BatchWriter {
+	w := &BatchWriter{
+		session:       sess,
+		ctx:           context.Background(),
+		maxStatements: defaultMaxStatements,
+		maxSize:       defaultMaxSize,
+		concurrency:   defaultConcurrency,
+		groups:        make(map[string]*writeGroup),
+	}
+	w.done = sync.NewCond(&w.doneMu)
+	return w
+}
+
+// MaxStatements sets the maximum number of statements in a batch, values lower
+// than 1 use the default of 100 statements.
+func (w *BatchWriter) MaxStatements(n int) *BatchWriter {
+	if n < 1 {
+		n = defaultMaxStatements
+	}
+	w.maxStatements = n
+	return w
+}
+
+// MaxSize sets the maximum size in bytes of a batch, values lower than 1 use
+// the default of 5KiB. The size is estimated using the CQL and the values of
+// the statements, a statement larger than the maximum is written alone.
+func (w *BatchWriter) MaxSize(bytes int) *BatchWriter {
+	if bytes < 1 {
+		bytes = defaultMaxSize
+	}
+	w.maxSize = bytes
+	return w
+}
+
+// Concurrency sets the maximum number of batches executed at the same time,
+// values lower than 1 use the default of 4. It must be set before the first
+// batch is flushed.
+func (w *BatchWriter) Concurrency(n int) *BatchWriter {
+	if n < 1 {
+		n = defaultConcurrency
+	}
+	w.concurrency = n
+	return w
+}
+
+// WithContext sets the context used to execute the batches.
+func (w *BatchWriter) WithContext(ctx context.Context) *BatchWriter {
+	w.ctx = ctx
+	return w
+}
+
+// Write adds the statements to the batches of their partitions, the batches
+// that reach the limits are flushed in the background. Write blocks if all
+// the workers are busy. The errors of the statements, including the invalid
+// ones, are returned by Flush and Close; Write only returns ErrWriterClosed
+// if the writer has been closed.
+func (w *BatchWriter) Write(stmts ...Statement) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return ErrWriterClosed
+	}
+
+	for _, stmt := range stmts {
+		if err := stmt.Err(); err != nil {
+			w.doneMu.Lock()
+			w.addErrors([]Statement{stmt}, err)
+			w.doneMu.Unlock()
+			continue
+		}
+
+		g := newWriteGroup(stmt)
+		if g.single {
+			// Keep the order with the previous statements of the partition.
+			if prev, ok := w.groups[g.key]; ok {
+				w.send(prev)
+			}
+			w.send(g)
+			continue
+		}
+
+		if prev, ok := w.groups[g.key]; ok {
+			if len(prev.stmts) < w.maxStatements && prev.size+g.size <= w.maxSize && prev.sameOptions(g) {
+				prev.stmts = append(prev.stmts, stmt)
+				prev.size += g.size
+				g = prev
+			} else {
+				w.send(prev)
+			}
+		}
+		w.groups[g.key] = g
+		if len(g.stmts) >= w.maxStatements || g.size >= w.maxSize {
+			w.send(g)
+		}
+	}
+	return nil
+}
+
+// Flush writes all the pending batches and waits until all of them are
+// executed. It returns a WriteErrors with the statements that failed since
+// the previous call to Flush, or nil if all of them succeeded.
+func (w *BatchWriter) Flush() error {
+	w.mu.Lock()
+	for _, g := range w.groups {
+		w.send(g)
+	}
+	w.mu.Unlock()
+
+	w.doneMu.Lock()
+	defer w.doneMu.Unlock()
+	for w.pending > 0 {
+		w.done.Wait()
+	}
+	if len(w.errs) == 0 {
+		return nil
+	}
+	errs := w.errs
+	w.errs = nil
+	return errs
+}
+
+// Close flushes the pending batches and stops the workers, the writer cannot
+// be used after it. It returns the same errors as Flush.
+func (w *BatchWriter) Close() error {
+	err := w.Flush()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.closed {
+		w.closed = true
+		for _, queue := range w.workers {
+			close(queue)
+		}
+	}
+	return err
+}
+
+// send queues the group in the worker of its partition, it must be called
+// with the lock held.
+func (w *BatchWriter) send(g *writeGroup) {
+	if w.groups[g.key] == g {
+		delete(w.groups, g.key)
+	}
+	if w.workers == nil {
+		w.workers = make([]chan *writeGroup, w.concurrency)
+		for i := range w.workers {
+			w.workers[i] = make(chan *writeGroup, 1)
+			go w.run(w.workers[i])
+		}
+	}
+
+	w.doneMu.Lock()
+	w.pending++
+	w.doneMu.Unlock()
+
+	h := fnv.New32a()
+	h.Write([]byte(g.key))
+	w.workers[h.Sum32()%uint32(len(w.workers))] <- g
+}
+
+// run executes the groups sent to a worker.
+func (w *BatchWriter) run(queue chan *writeGroup) {
+	for g := range queue {
+		err := w.exec(g)
+
+		w.doneMu.Lock()
+		if err != nil {
+			w.addErrors(g.stmts, err)
+		}
+		if w.pending--; w.pending == 0 {
+			w.done.Broadcast()
+		}
+		w.doneMu.Unlock()
+	}
+}
+
+// exec executes the statements of the group.
+func (w *BatchWriter) exec(g *writeGroup) error {
+	if g.single {
+		return g.stmts[0].ExecContext(w.ctx)
+	}
+
+	typ := gocql.UnloggedBatch
+	if g.counter {
+		typ = gocql.CounterBatch
+	}
+	b := NewBatch(w.session, typ).Add(g.stmts...)
+	if g.consistency != nil {
+		b.Consistency(*g.consistency)
+	}
+	return b.ApplyContext(w.ctx)
+}
+
+// addErrors records the error of the statements, it must be called with
+// doneMu held.
+func (w *BatchWriter) addErrors(stmts []Statement, err error) {
+	for _, stmt := range stmts {
+		w.errs = append(w.errs, &WriteError{Statement: stmt, Err: err})
+	}
+}
+
+// sameOptions returns true if the statements of both groups can be executed
+// in the same batch.
+func (g *writeGroup) sameOptions(o *writeGroup) bool {
+	if g.consistency == nil || o.consistency == nil {
+		return g.consistency == o.consistency
+	}
+	return *g.consistency == *o.consistency
+}
+
+// newWriteGroup returns the group for a statement. The statements that are
+// not INSERT, UPDATE or DELETE statements created by ecql, the ones without a
+// partition key, conditional statements, and statements with options that
+// cannot be applied to a batch are executed on their own.
+func newWriteGroup(stmt Statement) *writeGroup {
+	s, ok := stmt.(*StatementImpl)
+	if !ok {
+		return &writeGroup{stmts: []Statement{stmt}, single: true}
+	}
+
+	g := &writeGroup{
+		key:         s.Table.Name,
+		stmts:       []Statement{stmt},
+		counter:     s.isCounter(),
+		consistency: s.ConsistencyValue,
+	}
+	if g.consistency == nil {
+		g.consistency = s.Table.Consistency
+	}
+	values, hasKey := s.partitionKey()
+	if hasKey {
+		g.key += fmt.Sprintf("%#v", values)
+	}
+	if g.counter {
+		g.key = "counter:" + g.key
+	}
+
+	switch {
+	case s.Command != InsertCmd && s.Command != UpdateCmd && s.Command != DeleteCmd:
+		g.single = true
+	case !hasKey:
+		g.single = true
+	case s.IfExistsValue || s.IfNotExistsValue || s.IfConditions != nil:
+		g.single = true
+	case s.version != nil && s.Command == UpdateCmd:
+		g.single = true
+	case s.RetryPolicyValue != nil || s.TimeoutValue > 0:
+		g.single = true
+	default:
+		if cql, args, err := s.BuildQueryE(); err == nil {
+			g.size = len(cql)
+			for _, arg := range args {
+				g.size += valueSize(reflect.ValueOf(arg))
+			}
+		}
+	}
+	return g
+}
+
+// partitionKey returns the values of the partition key of an INSERT statement
+// with a bound struct, or the ones in the WHERE clause of UPDATE and DELETE
+// statements. Only the relations created with Eq are used in the WHERE
+// clause. INSERT statements with a raw JSON document are not supported.
+func (s *StatementImpl) partitionKey() ([]interface{}, bool) {
+	if len(s.Table.PartitionKey) == 0 || s.template != nil {
+		return nil, false
+	}
+
+	values := make(map[string]interface{})
+	switch {
+	case s.Command == InsertCmd && s.mapping != nil && s.JSONData == nil:
+		values = s.mapping
+	case s.Command != InsertCmd && s.Conditions != nil:
+		for _, eq := range s.Conditions.equals {
+			values[eq.column] = eq.value
+		}
+	}
+
+	key := make([]interface{}, len(s.Table.PartitionKey))
+	for i, col := range s.Table.PartitionKey {
+		v, ok := values[col]
+		if !ok {
+			return nil, false
+		}
+		key[i] = indirect(v)
+	}
+	return key, true
+}
+
+// isCounter returns true if the statement updates a counter.
+func (s *StatementImpl) isCounter() bool {
+	for _, col := range s.Table.Columns {
+		if col.Type == "counter" {
+			return true
+		}
+	}
+	for _, v := range s.Assignments {
+		switch v.(type) {
+		case increaseType, decreaseType:
+			return true
+		}
+	}
+	return false
+}
+
+// indirect returns the value pointed by v if it is a non-nil pointer.
+func indirect(v interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		return rv.Elem().Interface()
+	}
+	return v
+}
+
+// valueSize returns an estimation of the size in bytes of a value once it is
+// serialized.
+func valueSize(v reflect.Value) int {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return 0
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Invalid:
+		return 0
+	case reflect.String:
+		return v.Len()
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Len()
+		}
+		n := 0
+		for i := 0; i < v.Len(); i++ {
+			n += valueSize(v.Index(i))
+		}
+		return n
+	case reflect.Map:
+		n := 0
+		iter := v.MapRange()
+		for iter.Next() {
+			n += valueSize(iter.Key()) + valueSize(iter.Value())
+		}
+		return n
+	case reflect.Struct:
+		if v.Type() == reflect.TypeOf(time.Time{}) {
+			return 8
+		}
+		n := 0
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).PkgPath == "" {
+				n += valueSize(v.Field(i))
+			}
+		}
+		return n
+	default:
+		return int(v.Type().Size())
+	}
+}
@@ -0,0 +1,286 @@
+package ecql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/assert"
+)
+
+var errWriteTimeout = errors.New("write timeout")
+
+// writerExecutor is an Executor that records the batches and statements
+// executed by a BatchWriter. Batches with the value "fail" return an error.
+type writerExecutor struct {
+	mu      sync.Mutex
+	batches []*writerBatch
+	queries []string
+}
+
+func (e *writerExecutor) Query(ctx context.Context, stmt string, args ...interface{}) Query {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.queries = append(e.queries, stmt)
+	return writerQuery{}
+}
+
+func (e *writerExecutor) Batch(ctx context.Context, typ gocql.BatchType, entries []gocql.BatchEntry) BatchQuery {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	b := &writerBatch{typ: typ, entries: entries}
+	e.batches = append(e.batches, b)
+	return b
+}
+
+type writerQuery struct{}
+
+func (q writerQuery) Exec() error                                          { return nil }
+func (q writerQuery) Scan(dest ...interface{}) error                       { return nil }
+func (q writerQuery) MapScan(m map[string]interface{}) error               { return nil }
+func (q writerQuery) ScanCAS(dest ...interface{}) (bool, error)            { return true, nil }
+func (q writerQuery) MapScanCAS(dest map[string]interface{}) (bool, error) { return true, nil }
+func (q writerQuery) Iter() Rows                                           { return nil }
+func (q writerQuery) PageSize(n int) Query                                 { return q }
+func (q writerQuery) PageState(state []byte) Query                         { return q }
+func (q writerQuery) Consistency(c gocql.Consistency) Query                { return q }
+func (q writerQuery) SerialConsistency(c gocql.SerialConsistency) Query    { return q }
+func (q writerQuery) Idempotent(value bool) Query                          { return q }
+func (q writerQuery) RetryPolicy(policy gocql.RetryPolicy) Query           { return q }
+
+type writerBatch struct {
+	typ         gocql.BatchType
+	entries     []gocql.BatchEntry
+	consistency *gocql.Consistency
+}
+
+func (b *writerBatch) Exec() error {
+	for _, entry := range b.entries {
+		for _, arg := range entry.Args {
+			if indirect(arg) == "fail" {
+				return errWriteTimeout
+			}
+		}
+	}
+	return nil
+}
+
+func (b *writerBatch) MapExecCAS(dest map[string]interface{}) (bool, Rows, error) {
+	return true, nil, b.Exec()
+}
+
+func (b *writerBatch) Consistency(c gocql.Consistency) BatchQuery {
+	b.consistency = &c
+	return b
+}
+
+func (b *writerBatch) SerialConsistency(c gocql.SerialConsistency) BatchQuery { return b }
+func (b *writerBatch) RetryPolicy(policy gocql.RetryPolicy) BatchQuery        { return b }
+func (b *writerBatch) WithTimestamp(timestamp int64) BatchQuery               { return b }
+
+type testWriterStruct struct {
+	A string `cql:"a" cqltable:"writes" cqlkey:"(a,b),c"`
+	B int    `cql:"b"`
+	C int    `cql:"c"`
+	D string `cql:"d"`
+}
+
+func TestBatchWriterGroups(t *testing.T) {
+	DeleteRegistry()
+
+	e := &writerExecutor{}
+	sess := NewWithExecutor(e)
+	w := NewBatchWriter(sess).MaxStatements(3).Concurrency(2)
+
+	for i := 0; i < 4; i++ {
+		for _, id := range []string{"a", "b"} {
+			if i == 3 && id == "b" {
+				continue
+			}
+			assert.NoError(t, w.Write(sess.Insert(testConsistencyStruct{ID: id, Text: fmt.Sprintf("%s%d", id, i)})))
+		}
+	}
+	assert.NoError(t, w.Flush())
+
+	// Batches are grouped by partition and keep the order of the statements
+	texts := make(map[string][]interface{})
+	sizes := make(map[string][]int)
+	for _, b := range e.batches {
+		assert.Equal(t, gocql.UnloggedBatch, b.typ)
+		assert.Equal(t, gocql.LocalQuorum, *b.consistency)
+		id := b.entries[0].Args[0]
+		for _, entry := range b.entries {
+			assert.Equal(t, id, entry.Args[0])
+			texts[id.(string)] = append(texts[id.(string)], entry.Args[1])
+		}
+		sizes[id.(string)] = append(sizes[id.(string)], len(b.entries))
+	}
+	assert.Equal(t, map[string][]int{"a": {3, 1}, "b": {3}}, sizes)
+	assert.Equal(t, []interface{}{"a0", "a1", "a2", "a3"}, texts["a"])
+	assert.Equal(t, []interface{}{"b0", "b1", "b2"}, texts["b"])
+
+	// Counters use COUNTER batches, and conditional statements and
+	// statements without a known partition key are executed on their own
+	e.batches = nil
+	assert.NoError(t, w.Write(
+		sess.Update(testCounterStruct{ID: "a"}).Set("n", Inc(1)),
+		sess.Update(testCounterStruct{ID: "a"}).Set("n", Inc(2)),
+		NewStatement(sess.(*SessionImpl)).Do(UpdateCmd).From("counters").Set("n", Inc(1)).Where(Eq("id", "a")),
+		sess.Delete(testConsistencyStruct{ID: "a"}).IfExists(),
+	))
+	assert.NoError(t, w.Close())
+	if assert.Len(t, e.batches, 1) {
+		assert.Equal(t, gocql.CounterBatch, e.batches[0].typ)
+		assert.Len(t, e.batches[0].entries, 2)
+	}
+	assert.ElementsMatch(t, []string{
+		"UPDATE counters SET n = n + ? WHERE id = ?",
+		"DELETE FROM consistent WHERE id = ? IF EXISTS",
+	}, e.queries)
+
+	assert.Equal(t, ErrWriterClosed, w.Write(sess.Insert(testConsistencyStruct{ID: "a"})))
+}
+
+type testCounterStruct struct {
+	ID string `cql:"id" cqltable:"counters" cqlkey:"id"`
+	N  int64  `cql:"n" cqltype:"counter"`
+}
+
+func TestBatchWriterOptions(t *testing.T) {
+	DeleteRegistry()
+
+	e := &writerExecutor{}
+	sess := NewWithExecutor(e)
+	w := NewBatchWriter(sess).Concurrency(1)
+
+	// Statements with different consistencies are not batched together
+	assert.NoError(t, w.Write(
+		sess.Insert(testConsistencyStruct{ID: "a", Text: "a0"}),
+		sess.Insert(testConsistencyStruct{ID: "a", Text: "a1"}).Consistency(gocql.One),
+		sess.Insert(testConsistencyStruct{ID: "a", Text: "a2"}).Consistency(gocql.One),
+		sess.Insert(testConsistencyStruct{ID: "a", Text: "a3"}).Consistency(gocql.LocalQuorum),
+		sess.Insert(testConsistencyStruct{ID: "a", Text: "a4"}).RetryPolicy(&gocql.SimpleRetryPolicy{NumRetries: 1}),
+		sess.Insert(testConsistencyStruct{ID: "a", Text: "a5"}).Timeout(time.Second),
+	))
+	assert.NoError(t, w.Close())
+
+	var sizes []int
+	var consistencies []gocql.Consistency
+	for _, b := range e.batches {
+		sizes = append(sizes, len(b.entries))
+		consistencies = append(consistencies, *b.consistency)
+	}
+	assert.Equal(t, []int{1, 2, 1}, sizes)
+	assert.Equal(t, []gocql.Consistency{gocql.LocalQuorum, gocql.One, gocql.LocalQuorum}, consistencies)
+	assert.Len(t, e.queries, 2)
+}
+
+func TestBatchWriterMaxSize(t *testing.T) {
+	DeleteRegistry()
+
+	e := &writerExecutor{}
+	sess := NewWithExecutor(e)
+	w := NewBatchWriter(sess).MaxSize(120)
+
+	// Each statement is around 50 bytes, the last one is larger than the
+	// maximum size.
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, w.Write(sess.Insert(testConsistencyStruct{ID: "a", Text: "text"})))
+	}
+	assert.NoError(t, w.Write(sess.Insert(testConsistencyStruct{ID: "a", Text: string(make([]byte, 300))})))
+	assert.NoError(t, w.Close())
+
+	var sizes []int
+	for _, b := range e.batches {
+		sizes = append(sizes, len(b.entries))
+	}
+	assert.Equal(t, []int{2, 2, 1, 1}, sizes)
+}
+
+func TestBatchWriterErrors(t *testing.T) {
+	DeleteRegistry()
+
+	e := &writerExecutor{}
+	sess := NewWithExecutor(e)
+	w := NewBatchWriter(sess)
+
+	invalid := sess.Update(testConsistencyStruct{ID: "a"})
+	fail1 := sess.Insert(testConsistencyStruct{ID: "fail"})
+	fail2 := sess.Update(testConsistencyStruct{ID: "fail", Text: "text"}).Columns("text")
+	assert.NoError(t, w.Write(sess.Insert(testConsistencyStruct{ID: "a"}), invalid, fail1, fail2))
+
+	err := w.Flush()
+	errs, ok := err.(WriteErrors)
+	if assert.True(t, ok) && assert.Len(t, errs, 3) {
+		assert.Equal(t, invalid, errs[0].Statement)
+		assert.True(t, errors.Is(errs[0], ErrMissingAssignments))
+		assert.Equal(t, fail1, errs[1].Statement)
+		assert.Equal(t, errWriteTimeout, errs[1].Err)
+		assert.Equal(t, fail2, errs[2].Statement)
+		assert.Equal(t, errWriteTimeout, errs[2].Err)
+	}
+
+	// Errors are only returned once
+	assert.NoError(t, w.Close())
+}
+
+func TestPartitionKey(t *testing.T) {
+	DeleteRegistry()
+
+	sess := &SessionImpl{}
+	v := testWriterStruct{A: "foo", B: 1, C: 2, D: "bar"}
+	var tests = []struct {
+		stmt Statement
+		key  []interface{}
+		ok   bool
+	}{
+		{sess.Insert(v), []interface{}{"foo", 1}, true},
+		{sess.Insert(&v), []interface{}{"foo", 1}, true},
+		{sess.Update(&v).Columns("d"), []interface{}{"foo", 1}, true},
+		{sess.Delete(v), []interface{}{"foo", 1}, true},
+		{sess.Delete(v).Where(Eq("c", 2), In("d", "x", "y"), Eq("b", 1), Eq("a", "foo")), []interface{}{"foo", 1}, true},
+		{sess.Delete(v).Where(In("a", "foo", "bar"), Eq("b", 1)), nil, false},
+		{sess.Delete(v).Where(Eq("a", "foo")), nil, false},
+		{sess.Delete(v).Where(Condition{CQLFragment: "d = 'x = ?'"}, Eq("a", "foo"), Eq("b", 1)), []interface{}{"foo", 1}, true},
+		{sess.Delete(v).Where(Condition{CQLFragment: "a = ? AND b = ?", Values: []interface{}{"foo", 1}}), nil, false},
+		{sess.Insert(testWriterStruct{}).BindJSON([]byte(`{"a":"foo","b":1}`)), nil, false},
+		{NewStatement(sess).Do(DeleteCmd).From("writes").Where(Eq("a", "foo"), Eq("b", 1)), nil, false},
+	}
+
+	for i, tc := range tests {
+		key, ok := tc.stmt.(*StatementImpl).partitionKey()
+		assert.Equal(t, tc.ok, ok, "case %d", i)
+		assert.Equal(t, tc.key, key, "case %d", i)
+	}
+}
+
+func TestValueSize(t *testing.T) {
+	s := "text"
+	var tests = []struct {
+		value interface{}
+		size  int
+	}{
+		{nil, 0},
+		{"text", 4},
+		{&s, 4},
+		{(*string)(nil), 0},
+		{[]byte{1, 2, 3}, 3},
+		{int64(1), 8},
+		{int32(1), 4},
+		{true, 1},
+		{gocql.TimeUUID(), 16},
+		{time.Now(), 8},
+		{[]string{"a", "bc"}, 3},
+		{map[string]int32{"a": 1, "bc": 2}, 11},
+		{testAddress{Street: "Main St", Zip: 94107}, 7 + 8 + 16},
+	}
+
+	for _, tc := range tests {
+		assert.Equal(t, tc.size, valueSize(reflect.ValueOf(tc.value)), "%#v", tc.value)
+	}
+}